@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/thorbenw/docker-volume-plugin/proc"
+)
+
+const (
+	// The name of the volume option specifying the user (and group) the
+	// volume process runs as, in the form `user[:group]` with names or numeric
+	// IDs (e.g. `docker volume create -o user=1000:1000 ...`).
+	VolumeOptionUser = "user"
+	// The name of the volume option specifying the supplementary groups of the
+	// volume process as a comma separated list of names or numeric IDs (e.g.
+	// `docker volume create -o groups=fuse,1001 ...`).
+	VolumeOptionGroups = "groups"
+	// The name of the volume option specifying the ambient capabilities of the
+	// volume process as a comma separated list (e.g. `docker volume create -o
+	// capabilities=cap_sys_admin ...`).
+	VolumeOptionCapabilities = "capabilities"
+	// The name of the volume option specifying whether the volume process is
+	// prevented from gaining privileges (e.g. `docker volume create -o
+	// no-new-privileges=true ...`).
+	VolumeOptionNoNewPrivileges = "no-new-privileges"
+	// The name of the volume option specifying the signal the volume process
+	// receives if the plugin terminates (e.g. `docker volume create -o
+	// parent-death-signal=term ...`).
+	VolumeOptionParentDeathSignal = "parent-death-signal"
+)
+
+// Applies the process attribute volume options present in [options] (see
+// VolumeOptionUser, VolumeOptionGroups, VolumeOptionCapabilities,
+// VolumeOptionNoNewPrivileges and VolumeOptionParentDeathSignal) to
+// [defaultAttributes].
+//
+// Specifying the user resets the supplementary groups, unless they are
+// specified as well, while supplementary groups cannot be specified without a
+// user.
+//
+// The options can only restrict the privileges of [defaultAttributes] further
+// (see processAttributes_Restricts()), so the hardening of the plugin cannot be
+// undone by volume options.
+func ProcessAttributesParse(options map[string]string, defaultAttributes proc.ProcessAttributes) (proc.ProcessAttributes, error) {
+	attributes := defaultAttributes
+	if attributes.Credential != nil {
+		credential := *attributes.Credential
+		attributes.Credential = &credential
+	}
+
+	if value, ok := options[VolumeOptionUser]; ok && strings.TrimSpace(value) != "" {
+		uid, gid, err := proc.UserParse(value)
+		if err != nil {
+			return defaultAttributes, fmt.Errorf("user [%s] is not valid: %w", value, err)
+		}
+		attributes.Credential = &syscall.Credential{Uid: uid, Gid: gid, Groups: []uint32{}}
+	}
+	if value, ok := options[VolumeOptionGroups]; ok {
+		groups, err := proc.GroupsParse(value)
+		if err != nil {
+			return defaultAttributes, fmt.Errorf("groups [%s] are not valid: %w", value, err)
+		}
+		if attributes.Credential != nil {
+			attributes.Credential.Groups = groups
+		} else if len(groups) > 0 {
+			return defaultAttributes, fmt.Errorf("groups [%s] require a user to be specified", value)
+		}
+	}
+	if value, ok := options[VolumeOptionCapabilities]; ok {
+		caps, err := proc.CapabilitiesParse(value)
+		if err != nil {
+			return defaultAttributes, err
+		}
+		attributes.AmbientCaps = caps
+	}
+	if value, ok := options[VolumeOptionNoNewPrivileges]; ok {
+		noNewPrivs, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return defaultAttributes, fmt.Errorf("%s [%s] is not valid: %w", VolumeOptionNoNewPrivileges, value, err)
+		}
+		attributes.NoNewPrivs = noNewPrivs
+	}
+	if value, ok := options[VolumeOptionParentDeathSignal]; ok {
+		attributes.Pdeathsig = 0
+		if strings.TrimSpace(value) != "" {
+			signal, err := proc.SignalParse(value)
+			if err != nil {
+				return defaultAttributes, err
+			}
+			attributes.Pdeathsig = signal
+		}
+	}
+
+	if err := attributes.Validate(); err != nil {
+		return defaultAttributes, err
+	}
+	if err := processAttributes_Restricts(attributes, defaultAttributes); err != nil {
+		return defaultAttributes, err
+	}
+
+	return attributes, nil
+}
+
+// Returns an error if [attributes] grant privileges [defaultAttributes] don't,
+// i.e. if they clear no_new_privs, or if they switch to root, add
+// supplementary groups or add ambient capabilities while [defaultAttributes]
+// specify a non-root user. Without a user, or with root, [defaultAttributes]
+// have all privileges, so only no_new_privs is checked then.
+func processAttributes_Restricts(attributes proc.ProcessAttributes, defaultAttributes proc.ProcessAttributes) error {
+	if defaultAttributes.NoNewPrivs && !attributes.NoNewPrivs {
+		return fmt.Errorf("%s cannot be disabled, since the plugin enables it", VolumeOptionNoNewPrivileges)
+	}
+
+	if defaultAttributes.Credential == nil || defaultAttributes.Credential.Uid == 0 || attributes.Credential == nil {
+		return nil
+	}
+	defaultCredential := defaultAttributes.Credential
+	credential := attributes.Credential
+
+	if credential.Uid == 0 || credential.Gid == 0 {
+		return fmt.Errorf("%s [%d:%d] cannot be root, since the plugin runs volume processes as [%d:%d]", VolumeOptionUser, credential.Uid, credential.Gid, defaultCredential.Uid, defaultCredential.Gid)
+	}
+	for _, group := range credential.Groups {
+		if group != defaultCredential.Gid && !slices.Contains(defaultCredential.Groups, group) {
+			return fmt.Errorf("%s cannot include group [%d], since the plugin doesn't grant it", VolumeOptionGroups, group)
+		}
+	}
+	for _, capability := range attributes.AmbientCaps {
+		if !slices.Contains(defaultAttributes.AmbientCaps, capability) {
+			return fmt.Errorf("%s cannot include capability [%s], since the plugin doesn't grant it", VolumeOptionCapabilities, proc.Capability(capability))
+		}
+	}
+
+	return nil
+}
+
+// region pluginDriverVolume process attributes
+
+// Returns the identity and privileges the volume process is started with,
+// which are taken from the volume options (see ProcessAttributesParse()) if
+// present, or from the driver otherwise.
+func (v *pluginDriverVolume) ProcessAttributes(d *pluginDriver) (proc.ProcessAttributes, error) {
+	if v.Options == nil {
+		return ProcessAttributesParse(nil, d.VolumeProcessAttributes)
+	}
+
+	return ProcessAttributesParse(*v.Options, d.VolumeProcessAttributes)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func TestProcessAttributesParse(t *testing.T) {
+	defaultAttributes := proc.ProcessAttributes{Credential: &syscall.Credential{Uid: 12345, Gid: 23456, Groups: []uint32{34567}}, AmbientCaps: []uintptr{uintptr(proc.CAP_SYS_ADMIN)}, Pdeathsig: syscall.SIGTERM}
+
+	tests := []struct {
+		name    string
+		args    map[string]string
+		want    proc.ProcessAttributes
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Defaults", args: map[string]string{}, want: defaultAttributes},
+		{name: "User", args: map[string]string{VolumeOptionUser: "1:2"}, want: proc.ProcessAttributes{Credential: &syscall.Credential{Uid: 1, Gid: 2, Groups: []uint32{}}, AmbientCaps: defaultAttributes.AmbientCaps, Pdeathsig: syscall.SIGTERM}},
+		{name: "UserAndGroups", args: map[string]string{VolumeOptionUser: "1:2", VolumeOptionGroups: "34567,23456"}, want: proc.ProcessAttributes{Credential: &syscall.Credential{Uid: 1, Gid: 2, Groups: []uint32{34567, 23456}}, AmbientCaps: defaultAttributes.AmbientCaps, Pdeathsig: syscall.SIGTERM}},
+		{name: "Privileges", args: map[string]string{VolumeOptionCapabilities: "", VolumeOptionNoNewPrivileges: "true", VolumeOptionParentDeathSignal: " "}, want: proc.ProcessAttributes{Credential: defaultAttributes.Credential, AmbientCaps: []uintptr{}, NoNewPrivs: true}},
+		{name: "InvalidUser", args: map[string]string{VolumeOptionUser: "no-such-user"}, wantErr: true},
+		{name: "InvalidGroups", args: map[string]string{VolumeOptionGroups: "no-such-group"}, wantErr: true},
+		{name: "InvalidCapabilities", args: map[string]string{VolumeOptionCapabilities: "cap_everything"}, wantErr: true},
+		{name: "InvalidNoNewPrivileges", args: map[string]string{VolumeOptionNoNewPrivileges: "test"}, wantErr: true},
+		{name: "InvalidParentDeathSignal", args: map[string]string{VolumeOptionParentDeathSignal: "test"}, wantErr: true},
+		{name: "NoNewPrivilegesAndParentDeathSignal", args: map[string]string{VolumeOptionNoNewPrivileges: "true"}, wantErr: true},
+		// The privileges of the defaults cannot be extended.
+		{name: "RootUser", args: map[string]string{VolumeOptionUser: "0"}, wantErr: true},
+		{name: "RootGroup", args: map[string]string{VolumeOptionUser: "1:0"}, wantErr: true},
+		{name: "OtherGroups", args: map[string]string{VolumeOptionGroups: "34567,daemon"}, wantErr: true},
+		{name: "OtherCapabilities", args: map[string]string{VolumeOptionCapabilities: "cap_sys_admin,cap_net_admin"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ProcessAttributesParse(tt.args, defaultAttributes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProcessAttributesParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.DeepEqual(t, got, tt.want)
+			}
+		})
+	}
+
+	// Groups cannot be specified without a user.
+	_, err := ProcessAttributesParse(map[string]string{VolumeOptionGroups: "1"}, proc.ProcessAttributes{})
+	assert.ErrorContains(t, err, "require a user")
+	// The credential of the defaults is not modified.
+	_, err = ProcessAttributesParse(map[string]string{VolumeOptionGroups: "23456"}, defaultAttributes)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, defaultAttributes.Credential.Groups, []uint32{34567})
+
+	// no_new_privs cannot be cleared.
+	_, err = ProcessAttributesParse(map[string]string{VolumeOptionNoNewPrivileges: "false"}, proc.ProcessAttributes{NoNewPrivs: true})
+	assert.ErrorContains(t, err, "cannot be disabled")
+	// Without a user (or with root), the defaults have all privileges.
+	got, err := ProcessAttributesParse(map[string]string{VolumeOptionUser: "0", VolumeOptionCapabilities: "cap_net_admin"}, proc.ProcessAttributes{AmbientCaps: defaultAttributes.AmbientCaps})
+	assert.NilError(t, err)
+	assert.Assert(t, got.Credential.Uid == 0 && len(got.AmbientCaps) == 1)
+}
+
+func Test_pluginDriver_ProcessAttributes(t *testing.T) {
+	proc.Logger = logger
+
+	propagatedMount := t.TempDir()
+
+	driver, err := pluginDriver_New(propagatedMount, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	for _, options := range []map[string]string{
+		{VolumeOptionUser: "no-such-user"},
+		{VolumeOptionGroups: "0"},
+		{VolumeOptionNoNewPrivileges: "true", VolumeOptionParentDeathSignal: "term"},
+	} {
+		if err := driver.Create(&volume.CreateRequest{Name: "test_invalid", Options: options}); err == nil {
+			t.Errorf("Creating a volume with options %v succeeded unexpectedly.", options)
+		}
+	}
+	assert.Assert(t, len(driver.Volumes) == 0)
+
+	// The hardening of the plugin cannot be undone by volume options.
+	hardened := *driver
+	hardened.VolumeProcessAttributes = proc.ProcessAttributes{Credential: &syscall.Credential{Uid: 12345, Gid: 23456, Groups: []uint32{}}, AmbientCaps: []uintptr{}, NoNewPrivs: true}
+	for _, options := range []map[string]string{
+		{VolumeOptionUser: "0"},
+		{VolumeOptionCapabilities: "cap_sys_admin"},
+		{VolumeOptionNoNewPrivileges: "false"},
+		{VolumeOptionUser: "0", VolumeOptionCapabilities: "cap_sys_admin", VolumeOptionNoNewPrivileges: "false"},
+	} {
+		if err := hardened.Create(&volume.CreateRequest{Name: "test_escalated", Options: options}); err == nil {
+			t.Errorf("Creating a volume with options %v undoing the hardening of the plugin succeeded unexpectedly.", options)
+		}
+	}
+	assert.Assert(t, len(driver.Volumes) == 0)
+
+	volumeName := "test_volume"
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"c": "-v", VolumeOptionNoNewPrivileges: "true"}}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := driver.Get(&volume.GetRequest{Name: volumeName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, res.Volume.Status["User"] == nil, "User = %v", res.Volume.Status["User"])
+	status, err := os.ReadFile(filepath.Join(proc.ProcPath, strconv.FormatUint(res.Volume.Status["Pid"].(uint64), 10), "status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, strings.Contains(string(status), "\nNoNewPrivs:\t1\n"), "The volume process is not running with no_new_privs.")
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Error(err)
+	}
+
+	if os.Geteuid() != 0 {
+		t.Skip("Running volume processes as another user requires root privileges.")
+	}
+
+	// The volume process user needs to be able to reach the mount points.
+	for _, path := range []string{filepath.Dir(propagatedMount), propagatedMount} {
+		if err := os.Chmod(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// New folders are handed over to the volume process user.
+	userName := "test_user"
+	if err := driver.Create(&volume.CreateRequest{Name: userName, Options: map[string]string{"c": "-v", VolumeOptionUser: "12345:23456"}}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = driver.Get(&volume.GetRequest{Name: userName}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, res.Volume.Status["User"] == "12345:23456", "User = %v", res.Volume.Status["User"])
+	assert.Assert(t, res.Volume.Status["Pid"] != nil, "The volume process is not running.")
+	if err := driver.Remove(&volume.RemoveRequest{Name: userName}); err != nil {
+		t.Error(err)
+	}
+
+	// Volume processes aren't started if their user cannot access the mount
+	// point.
+	denied := pluginDriverVolume{BasePath: propagatedMount, Path: "test_denied", Options: &map[string]string{"c": "-v", VolumeOptionUser: "12345:23456"}}
+	if err := os.Mkdir(denied.MountPoint(), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := denied.SetupProcess(driver); err == nil {
+		t.Error("Setting up a volume process whose user cannot access the mount point succeeded unexpectedly.")
+	} else {
+		assert.ErrorContains(t, err, "cannot access the mount point")
+	}
+}
@@ -1,31 +1,58 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/docker/go-plugins-helpers/volume"
 	"github.com/thorbenw/docker-volume-plugin/metric"
 	"github.com/thorbenw/docker-volume-plugin/mount"
 	"github.com/thorbenw/docker-volume-plugin/proc"
+	"github.com/thorbenw/docker-volume-plugin/semver"
 	"github.com/thorbenw/docker-volume-plugin/utils"
 )
 
 const (
-	DefaultControlFileName  = "volumes.json"
-	DefaultControlFileMode  = 0o664
-	MinimumVolumeFolderMode = os.ModeDir | 0o700
-	DefaultVolumeFolderMode = os.ModeDir | 0o764
+	DefaultControlFileName        = "volumes.json"
+	DefaultControlFileMode        = 0o664
+	DefaultControlFileGenerations = 3
+	MinimumVolumeFolderMode       = os.ModeDir | 0o700
+	DefaultVolumeFolderMode       = os.ModeDir | 0o764
+	DefaultMountPollInterval      = 250 * time.Millisecond
+	// The name of the volume option specifying how long Mount() waits for the
+	// volume process to mount a file system at the mount point (e.g.
+	// `docker volume create -o mount-timeout=30s ...`).
+	VolumeOptionMountTimeout = "mount-timeout"
+	// The name of the volume option specifying whether Remove() removes the
+	// volume even if it has active mounts (e.g. `docker volume create -o
+	// force-remove=true ...`).
+	VolumeOptionForceRemove = "force-remove"
+	// The name of the volume option specifying the backoff policy the volume
+	// process is restarted according to with proc.RecoveryModeBackoff (e.g.
+	// `docker volume create -o recovery-backoff=initial=5s,max=10m ...`).
+	VolumeOptionRecoveryBackoff = "recovery-backoff"
+	// The name of the volume option specifying how to behave if the volume
+	// process terminates unexpectedly (e.g. `docker volume create -o
+	// recovery-mode=restart ...`).
+	VolumeOptionRecoveryMode = "recovery-mode"
+	// The name of the volume option specifying how many times the volume
+	// process is restarted within a minute before giving up with
+	// proc.RecoveryModeRestart (e.g. `docker volume create -o
+	// recovery-max-per-min=10 ...`).
+	VolumeOptionRecoveryMaxPerMin = "recovery-max-per-min"
 )
 
 var (
@@ -35,14 +62,100 @@ var (
 	// If process monitors were stored as a field in a volume object, their
 	// goroutines continue running even if a driver object is recreated (and
 	// thus all volume objects).
-	processMonitors map[string]*proc.ProcessMonitor = make(map[string]*proc.ProcessMonitor)
+	//
+	// Must only be accessed while holding processMonitorsMutex.
+	processMonitors      map[string]*proc.ProcessMonitor = make(map[string]*proc.ProcessMonitor)
+	processMonitorsMutex sync.Mutex
 )
 
+// Returns the process monitor for [puid], starting one using [monitor] if there
+// is none yet. Concurrent calls for the same [puid] start one monitor only.
+func processMonitors_LoadOrStart(puid string, monitor func() (*proc.ProcessMonitor, error)) (*proc.ProcessMonitor, error) {
+	processMonitorsMutex.Lock()
+	defer processMonitorsMutex.Unlock()
+
+	if processMonitor, ok := processMonitors[puid]; ok {
+		return processMonitor, nil
+	}
+
+	processMonitor, err := monitor()
+	if err != nil {
+		return nil, err
+	}
+	processMonitors[puid] = processMonitor
+
+	return processMonitor, nil
+}
+
+// Returns the process monitor for [puid], if there is one.
+func processMonitors_Load(puid string) (*proc.ProcessMonitor, bool) {
+	processMonitorsMutex.Lock()
+	defer processMonitorsMutex.Unlock()
+
+	processMonitor, ok := processMonitors[puid]
+
+	return processMonitor, ok
+}
+
+// Removes the process monitor for [puid] from the registry and returns it, if
+// there is one.
+func processMonitors_LoadAndDelete(puid string) (*proc.ProcessMonitor, bool) {
+	processMonitorsMutex.Lock()
+	defer processMonitorsMutex.Unlock()
+
+	processMonitor, ok := processMonitors[puid]
+	delete(processMonitors, puid)
+
+	return processMonitor, ok
+}
+
+// Registers the process monitor for [from] for [to] instead, e.g. because it
+// has restarted the process.
+func processMonitors_Move(from string, to string) {
+	processMonitorsMutex.Lock()
+	defer processMonitorsMutex.Unlock()
+
+	if processMonitor, ok := processMonitors[from]; ok {
+		delete(processMonitors, from)
+		processMonitors[to] = processMonitor
+	}
+}
+
+// Logs the events of [processMonitor], which monitors the volume process of the
+// volume in [folder], until it terminates. The records (`event`, `folder`,
+// `pid`, `exitCode` and `detail` attributes) are meant to be turned into
+// metrics by log processing.
+func processMonitors_LogEvents(logger slog.Logger, folder string, processMonitor *proc.ProcessMonitor) {
+	events, _ := processMonitor.Subscribe(0)
+	go func() {
+		for event := range events {
+			level := slog.LevelInfo
+			if event.Kind == proc.ProcessEventGaveUp || event.Kind == proc.ProcessEventKilled || event.Kind == proc.ProcessEventFailed {
+				level = slog.LevelWarn
+			}
+			logger.Log(context.Background(), level, "Volume process event.", "event", event.Kind.String(), "folder", folder, "pid", event.ProcessInfo.Pid, "exitCode", event.ExitCode, "detail", event.Detail)
+		}
+	}()
+}
+
 type GetVolumeProcess func() (*exec.Cmd, *proc.Options, *mount.Options)
 type SetVolumeProcessOptions func(*exec.Cmd, *proc.Options, *mount.Options, string) error
 
+// A mount of a volume, keyed by Docker's mount ID.
+//
+// Since Docker never calls Unmount() for mounts it has forgotten about (e.g.
+// because dockerd crashed), each mount is leased and expires if it has not been
+// renewed (i.e. mounted or unmounted again) within the driver's MountLease.
 type pluginDriverMount struct {
 	ReferenceCount int
+	CreatedAt      time.Time
+	RenewedAt      time.Time
+}
+
+// Returns whether the lease of the mount has expired at [now]. Mounts never
+// expire if [lease] is not positive.
+func (m pluginDriverMount) Expired(lease time.Duration, now time.Time) bool {
+	return lease > 0 && now.Sub(m.RenewedAt) > lease
 }
 
 type pluginDriverVolume struct {
@@ -53,6 +166,10 @@ type pluginDriverVolume struct {
 	Mounts     *map[string]pluginDriverMount
 	Options    *map[string]string
 	Puid       string
+	// Why and when the volume process terminated with proc.RecoveryModeFail
+	// (see pluginDriverVolume.Failed()).
+	Failure  string     `json:",omitempty"`
+	FailedAt *time.Time `json:",omitempty"`
 }
 
 func (v *pluginDriverVolume) MountPoint() string {
@@ -63,7 +180,389 @@ func (v *pluginDriverVolume) MountPoint() string {
 	return v.mountPoint
 }
 
+// Splits [command] like volume process options, replacing the mount point
+// placeholder with the mount point of the volume and omitting empty arguments.
+func (v *pluginDriverVolume) CommandLine(command string) []string {
+	argv := []string{}
+	for _, arg := range strings.Split(command, VOLUME_PROCESS_OPTIONS_SEPARATOR) {
+		if arg = strings.TrimSpace(arg); arg != "" {
+			argv = append(argv, strings.ReplaceAll(arg, VOLUME_PROCESS_OPTIONS_MOUNTPOINT_PLACEHOLDER, v.MountPoint()))
+		}
+	}
+
+	return argv
+}
+
+// Returns the total reference count of all mounts of the volume.
+func (v *pluginDriverVolume) ReferenceCount() (count int) {
+	if v.Mounts != nil {
+		for _, mount := range *v.Mounts {
+			count += mount.ReferenceCount
+		}
+	}
+
+	return
+}
+
+// Unregisters all mounts of the volume whose lease has expired at [now] and
+// returns their IDs.
+func (v *pluginDriverVolume) PruneMounts(lease time.Duration, now time.Time) []string {
+	pruned := []string{}
+	if v.Mounts == nil {
+		return pruned
+	}
+
+	mounts := *v.Mounts
+	for id, mount := range mounts {
+		if mount.Expired(lease, now) {
+			delete(mounts, id)
+			pruned = append(pruned, id)
+		}
+	}
+	slices.Sort(pruned)
+
+	return pruned
+}
+
+// Returns whether Remove() removes the volume even if it has active mounts,
+// which is taken from the volume option VolumeOptionForceRemove if present, or
+// from the driver otherwise.
+func (v *pluginDriverVolume) ForceRemove(d *pluginDriver) (bool, error) {
+	if v.Options != nil {
+		if value, ok := (*v.Options)[VolumeOptionForceRemove]; ok {
+			if force, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+				return false, fmt.Errorf("force remove [%s] is not valid: %w", value, err)
+			} else {
+				return force, nil
+			}
+		}
+	}
+
+	return d.ForceRemove, nil
+}
+
+// Returns the volume process lifecycle of the volume, which is taken from the
+// volume option VolumeOptionLifecycle if present, or from the driver
+// otherwise.
+func (v *pluginDriverVolume) Lifecycle(d *pluginDriver) (VolumeProcessLifecycle, error) {
+	if v.Options != nil {
+		if name, ok := (*v.Options)[VolumeOptionLifecycle]; ok {
+			invalidLifecycle := VolumeProcessLifecycle(-1)
+			if lifecycle := VolumeProcessLifecycleParse(name, invalidLifecycle); lifecycle != invalidLifecycle {
+				return lifecycle, nil
+			}
+			return invalidLifecycle, fmt.Errorf("volume process lifecycle [%s] is not valid", name)
+		}
+	}
+
+	return d.VolumeProcessLifecycle, nil
+}
+
+// Returns how long to wait for the volume process to mount a file system at the
+// mount point, which is taken from the volume option VolumeOptionMountTimeout
+// if present, or from the driver otherwise. 0 means not to wait at all.
+func (v *pluginDriverVolume) MountTimeout(d *pluginDriver) (time.Duration, error) {
+	if v.Options != nil {
+		if value, ok := (*v.Options)[VolumeOptionMountTimeout]; ok {
+			if timeout, err := time.ParseDuration(strings.TrimSpace(value)); err != nil {
+				return 0, fmt.Errorf("mount timeout [%s] is not valid: %w", value, err)
+			} else if timeout < 0 {
+				return 0, fmt.Errorf("mount timeout [%s] must not be negative", value)
+			} else {
+				return timeout, nil
+			}
+		}
+	}
+
+	return d.MountTimeout, nil
+}
+
+// Returns how to behave if the volume process terminates unexpectedly, which is
+// taken from the volume option VolumeOptionRecoveryMode if present, or from the
+// driver otherwise.
+func (v *pluginDriverVolume) RecoveryMode(d *pluginDriver) (proc.RecoveryMode, error) {
+	if v.Options != nil {
+		if name, ok := (*v.Options)[VolumeOptionRecoveryMode]; ok {
+			invalidRecoveryMode := proc.RecoveryMode(-1)
+			if recoveryMode := proc.RecoveryModeParse(name, invalidRecoveryMode); recoveryMode != invalidRecoveryMode {
+				return recoveryMode, nil
+			}
+			return invalidRecoveryMode, fmt.Errorf("recovery mode [%s] is not valid", name)
+		}
+	}
+
+	return d.VolumeProcessRecoveryMode, nil
+}
+
+// Returns when to give up restarting the volume process with
+// proc.RecoveryModeRestart, which is taken from the volume option
+// VolumeOptionRecoveryMaxPerMin if present, or from the driver otherwise (nil
+// meaning the default of the proc package).
+func (v *pluginDriverVolume) RecoveryRateLimit(d *pluginDriver) (*metric.MetricRateLimit, error) {
+	if v.Options != nil {
+		if value, ok := (*v.Options)[VolumeOptionRecoveryMaxPerMin]; ok {
+			if limit, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32); err != nil {
+				return nil, fmt.Errorf("recovery max per min [%s] is not valid: %w", value, err)
+			} else if limit < 1 {
+				return nil, fmt.Errorf("recovery max per min [%s] must not be less than 1", value)
+			} else {
+				return &metric.MetricRateLimit{Limit: uint(limit), Duration: time.Minute}, nil
+			}
+		}
+	}
+
+	return d.VolumeProcessRecoveryRateLimit, nil
+}
+
+// Returns the backoff policy the volume process is restarted according to with
+// proc.RecoveryModeBackoff, which is taken from the volume option
+// VolumeOptionRecoveryBackoff if present, or from the driver otherwise. Keys
+// not specified by the volume option are taken from the driver as well.
+func (v *pluginDriverVolume) RecoveryBackoff(d *pluginDriver) (proc.BackoffPolicy, error) {
+	backoff := d.VolumeProcessRecoveryBackoff
+	if backoff == (proc.BackoffPolicy{}) {
+		backoff = proc.DefaultBackoffPolicy
+	}
+
+	if v.Options != nil {
+		if value, ok := (*v.Options)[VolumeOptionRecoveryBackoff]; ok {
+			if policy, err := proc.BackoffPolicyParse(value, backoff); err != nil {
+				return backoff, fmt.Errorf("recovery backoff [%s] is not valid: %w", value, err)
+			} else {
+				return policy, nil
+			}
+		}
+	}
+
+	return backoff, nil
+}
+
+// Returns an error if any of the volume options is not valid, i.e. if any of
+// the accessors taking them into account fails.
+func (v *pluginDriverVolume) ValidateOptions(d *pluginDriver) error {
+	if _, err := v.Lifecycle(d); err != nil {
+		return err
+	}
+	if _, err := v.MountTimeout(d); err != nil {
+		return err
+	}
+	if _, err := v.ForceRemove(d); err != nil {
+		return err
+	}
+	if _, err := v.RecoveryMode(d); err != nil {
+		return err
+	}
+	if _, err := v.RecoveryRateLimit(d); err != nil {
+		return err
+	}
+	if _, err := v.RecoveryBackoff(d); err != nil {
+		return err
+	}
+	if _, err := v.LivenessPolicy(d); err != nil {
+		return err
+	}
+	if _, err := v.RemovePolicy(d); err != nil {
+		return err
+	}
+	if _, err := v.ProcessAttributes(d); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Waits for the volume process to mount a file system at the mount point (see
+// MountTimeout()).
+//
+// Fails if the volume process terminates or nothing has been mounted when the
+// timeout elapses. Volumes without a volume process are never waited for.
+func (v *pluginDriverVolume) WaitForMount(d *pluginDriver) error {
+	timeout, err := v.MountTimeout(d)
+	if err != nil {
+		return err
+	}
+	if timeout < 1 || strings.TrimSpace(v.Puid) == "" {
+		return nil
+	}
+
+	mountInfo, err := proc.WaitForMountWithTimeout(timeout, DefaultMountPollInterval, v.MountPoint(), func() error {
+		// After restarts, the monitored process differs from the one the PUID
+		// refers to.
+		puid := v.Puid
+		if processMonitor, ok := processMonitors_Load(v.Puid); ok {
+			processInfo := processMonitor.Status().ProcessInfo
+			puid = processInfo.UniqueId()
+		}
+		if _, err := proc.GetProcessInfoFromUniqueId(puid); err != nil {
+			return fmt.Errorf("volume process [%s] terminated before mounting [%s]: %w", puid, v.MountPoint(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.Logger.Debug("Volume process has mounted the mount point.", "volume", v, "mountInfo", mountInfo)
+	return nil
+}
+
+// Returns copies of the plugin level options [volumeProcessOptions] and
+// [mountOptions] (either of which may be nil) with the volume level options
+// (volume options `c` and `o`) applied.
+//
+// The plugin level options are left untouched, since they are shared by all
+// volumes.
+func (v *pluginDriverVolume) EffectiveOptions(volumeProcessOptions *proc.Options, mountOptions *mount.Options) (*proc.Options, *mount.Options, error) {
+	if volumeProcessOptions != nil {
+		clone := volumeProcessOptions.Clone()
+		volumeProcessOptions = &clone
+	}
+	if mountOptions != nil {
+		clone := mountOptions.Clone()
+		mountOptions = &clone
+	}
+
+	var len_volumeOptions int
+	if v.Options != nil {
+		len_volumeOptions = len(*v.Options)
+	}
+	if len_volumeOptions > 0 {
+		if volumeProcessOptionsOption, ok := (*v.Options)["c"]; ok {
+			if volumeProcessOptions == nil {
+				mnt := proc.NewOptions(len_volumeOptions, VOLUME_PROCESS_OPTIONS_SEPARATOR, true)
+				volumeProcessOptions = &mnt
+			}
+
+			if err := volumeProcessOptions.Set(volumeProcessOptionsOption); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if mountOptionsOption, ok := (*v.Options)["o"]; ok {
+			if mountOptions == nil {
+				mnt := mount.NewOptions(len_volumeOptions)
+				mountOptions = &mnt
+			}
+
+			if err := mountOptions.Set(mountOptionsOption); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return volumeProcessOptions, mountOptions, nil
+}
+
+// Returns status information on the volume as shown by
+// `docker volume inspect`.
+func (v *pluginDriverVolume) Status(d *pluginDriver) map[string]interface{} {
+	status := map[string]interface{}{}
+
+	mounts := map[string]int{}
+	renewedAt := map[string]string{}
+	if v.Mounts != nil {
+		for id, mount := range *v.Mounts {
+			mounts[id] = mount.ReferenceCount
+			renewedAt[id] = mount.RenewedAt.Format(time.RFC3339)
+		}
+	}
+	status["Mounts"] = mounts
+	status["MountsRenewedAt"] = renewedAt
+
+	if lifecycle, err := v.Lifecycle(d); err == nil {
+		status["Lifecycle"] = lifecycle.String()
+	}
+
+	var volumeProcessOptions *proc.Options
+	var mountOptions *mount.Options
+	if d.GetVolumeProcess != nil {
+		_, volumeProcessOptions, mountOptions = d.GetVolumeProcess()
+	}
+	if volumeProcessOptions, mountOptions, err := v.EffectiveOptions(volumeProcessOptions, mountOptions); err != nil {
+		status["OptionsError"] = err.Error()
+	} else {
+		if volumeProcessOptions != nil {
+			status["VolumeProcessOptions"] = volumeProcessOptions.Slice()
+		}
+		if mountOptions != nil {
+			status["MountOptions"] = mountOptions.String()
+		}
+	}
+
+	if recoveryMode, err := v.RecoveryMode(d); err == nil {
+		status["RecoveryMode"] = recoveryMode.String()
+	}
+	if attributes, err := v.ProcessAttributes(d); err == nil && attributes.Credential != nil {
+		status["User"] = fmt.Sprintf("%d:%d", attributes.Credential.Uid, attributes.Credential.Gid)
+	}
+	if v.FailedAt != nil {
+		status["Failure"] = v.Failure
+		status["FailedAt"] = v.FailedAt.Format(time.RFC3339)
+	}
+	if strings.TrimSpace(v.Puid) == "" {
+		return status
+	}
+	status["Puid"] = v.Puid
+
+	// After restarts, the monitored process differs from the one the PUID
+	// refers to.
+	pid := -1
+	if processMonitor, ok := processMonitors_Load(v.Puid); ok {
+		monitorStatus := processMonitor.Status()
+		pid = int(monitorStatus.ProcessInfo.Pid)
+		status["RecoveryMode"] = monitorStatus.RecoveryMode.String()
+		status["Restarts"] = monitorStatus.Restarts
+		status["RestartRate"] = fmt.Sprintf("%d within the last %s", monitorStatus.RestartRate, monitorStatus.RestartRateDuration)
+		events := []map[string]interface{}{}
+		for _, event := range processMonitor.Events() {
+			events = append(events, map[string]interface{}{
+				"Time":     event.Time.Format(time.RFC3339),
+				"Event":    event.Kind.String(),
+				"Pid":      event.ProcessInfo.Pid,
+				"ExitCode": event.ExitCode,
+				"Detail":   event.Detail,
+			})
+		}
+		status["Events"] = events
+		if liveness, err := v.LivenessPolicy(d); err == nil && liveness != nil {
+			status["LivenessFailures"] = monitorStatus.LivenessFailures
+			status["LivenessKills"] = monitorStatus.LivenessKills
+		}
+		if monitorStatus.RecoveryMode == proc.RecoveryModeBackoff {
+			status["Attempts"] = monitorStatus.Attempts
+			if !monitorStatus.NextRestart.IsZero() {
+				status["NextRestart"] = monitorStatus.NextRestart.Format(time.RFC3339)
+			}
+		}
+	} else if prc, err := proc.GetProcessInfoFromUniqueId(v.Puid); err == nil {
+		pid = int(prc.Pid)
+	}
+
+	if pid < 0 {
+		status["State"] = "Unknown"
+	} else if prc, err := proc.GetProcessInfo(pid); err != nil {
+		status["Pid"] = pid
+		status["State"] = "Unknown"
+		status["Error"] = err.Error()
+	} else {
+		status["Pid"] = prc.Pid
+		status["State"] = prc.State.String()
+		status["StartTime"] = prc.StartTime.Format(time.RFC3339)
+	}
+
+	return status
+}
+
 func (v *pluginDriverVolume) SetupProcess(d *pluginDriver) error {
+	// The launch specification of a volume process started here. Processes
+	// picked up otherwise are restarted according to a launch specification
+	// derived from the running process.
+	var spec *proc.LaunchSpec
+
+	if err := v.Failed(); err != nil {
+		return d.Tee(err)
+	}
+
 	if strings.TrimSpace(v.Puid) == "" && d.GetVolumeProcess != nil {
 		// Create and detach process
 
@@ -79,32 +578,9 @@ func (v *pluginDriverVolume) SetupProcess(d *pluginDriver) error {
 			return d.Tee(fmt.Errorf("command has already been started or run"))
 		}
 
-		var len_volumeOptions int
-		if v.Options != nil {
-			len_volumeOptions = len(*v.Options)
-		}
-		if len_volumeOptions > 0 {
-			if volumeProcessOptionsOption, ok := (*v.Options)["c"]; ok {
-				if volumeProcessOptions == nil {
-					mnt := proc.NewOptions(len_volumeOptions, VOLUME_PROCESS_OPTIONS_SEPARATOR, true)
-					volumeProcessOptions = &mnt
-				}
-
-				if err := volumeProcessOptions.Set(volumeProcessOptionsOption); err != nil {
-					return d.Tee(err)
-				}
-			}
-
-			if mountOptionsOption, ok := (*v.Options)["o"]; ok {
-				if mountOptions == nil {
-					mnt := mount.NewOptions(len_volumeOptions)
-					mountOptions = &mnt
-				}
-
-				if err := mountOptions.Set(mountOptionsOption); err != nil {
-					return d.Tee(err)
-				}
-			}
+		volumeProcessOptions, mountOptions, err := v.EffectiveOptions(volumeProcessOptions, mountOptions)
+		if err != nil {
+			return d.Tee(err)
 		}
 
 		d.Logger.Debug("Processed options.", "volumeProcessOptions", proc.OptionsString(volumeProcessOptions, true), "mountOptions", mount.OptionsString(mountOptions, true))
@@ -125,13 +601,45 @@ func (v *pluginDriverVolume) SetupProcess(d *pluginDriver) error {
 			}
 		}
 
-		attr := os.ProcAttr{
+		attributes, err := v.ProcessAttributes(d)
+		if err != nil {
+			return d.Tee(err)
+		}
+		if attributes.Credential != nil {
+			if err := utils.CheckAccessCredential(attributes.Credential, os.FileMode(0o7), v.MountPoint()); err != nil {
+				return d.Tee(fmt.Errorf("volume process user %d:%d cannot access the mount point: %w", attributes.Credential.Uid, attributes.Credential.Gid, err))
+			}
+		}
+
+		stdout, stderr := os.Stdout, os.Stderr
+		if d.VolumeLogs {
+			logFile, err := v.OpenLogFile(d)
+			if err != nil {
+				return d.Tee(err)
+			}
+			stdout, stderr = logFile, logFile
+		}
+
+		// Kept by the process monitor for restarts, which closes it's files once
+		// it terminates.
+		spec = &proc.LaunchSpec{
+			Path:  cmd.Path,
+			Args:  cmd.Args,
 			Dir:   cmd.Dir,
 			Env:   cmd.Env,
-			Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, cmd.ExtraFiles...),
+			Files: append([]*os.File{os.Stdin, stdout, stderr}, cmd.ExtraFiles...),
 			Sys:   cmd.SysProcAttr,
 		}
-		if pid, err := os.StartProcess(cmd.Path, cmd.Args, &attr); err != nil {
+		attributes.Apply(spec)
+		defer func() {
+			if spec != nil {
+				if err := spec.Close(); err != nil {
+					d.Logger.Warn("Failed to close the files of the volume process.", "err", err, "volume", v)
+				}
+			}
+		}()
+
+		if pid, err := spec.Start(); err != nil {
 			return d.Tee(err)
 		} else {
 			wpid := pid.Pid
@@ -156,14 +664,40 @@ func (v *pluginDriverVolume) SetupProcess(d *pluginDriver) error {
 			if pid, err := os.FindProcess(int(prc.Pid)); err != nil {
 				d.Logger.Warn("PID is invalid.", "err", err, "volume", v, "prc", prc)
 			} else {
-				if _, ok := processMonitors[v.Puid]; !ok {
-					if processMonitor, err := proc.MonitorProcess(pid.Pid, d.VolumeProcessRecoveryMode, d.VolumeProcessRecoveryRateLimit); err != nil {
-						d.Logger.Warn("Faild to monitor process.", "err", err, "volume", v, "prc", prc, "pid", pid)
-					} else {
-						processMonitors[v.Puid] = processMonitor
+				if _, err := processMonitors_LoadOrStart(v.Puid, func() (*proc.ProcessMonitor, error) {
+					recoveryMode, err := v.RecoveryMode(d)
+					if err != nil {
+						return nil, err
+					}
+					rateLimit, err := v.RecoveryRateLimit(d)
+					if err != nil {
+						return nil, err
+					}
+					backoff, err := v.RecoveryBackoff(d)
+					if err != nil {
+						return nil, err
+					}
+					liveness, err := v.LivenessPolicy(d)
+					if err != nil {
+						return nil, err
 					}
-				}
 
+					processMonitor, err := proc.MonitorProcessWithOptions(pid.Pid, spec, proc.MonitorOptions{
+						RecoveryMode: recoveryMode,
+						RateLimit:    rateLimit,
+						Backoff:      &backoff,
+						Liveness:     liveness,
+					})
+					if err == nil {
+						// Owned by the process monitor now.
+						spec = nil
+						processMonitors_LogEvents(d.Logger, v.Path, processMonitor)
+						pluginDriver_WatchFailure(d, v.Path, processMonitor)
+					}
+					return processMonitor, err
+				}); err != nil {
+					d.Logger.Warn("Faild to monitor process.", "err", err, "volume", v, "prc", prc, "pid", pid)
+				}
 			}
 		}
 	}
@@ -171,16 +705,135 @@ func (v *pluginDriverVolume) SetupProcess(d *pluginDriver) error {
 	return nil
 }
 
+// Cancels the volume process of the volume (if any) and forgets about it.
+func (v *pluginDriverVolume) StopProcess(d *pluginDriver) (fail error) {
+	if processMonitor, ok := processMonitors_LoadAndDelete(v.Puid); ok {
+		if err := proc.CancelProcess(processMonitor, 2*time.Second); err != nil {
+			fail = err
+		}
+	}
+
+	v.Puid = ""
+	return
+}
+
+// Driver wide settings, which don't have to be passed to the constructors
+// individually. The zero value provides the defaults.
+type pluginDriverOptions struct {
+	// The volume process lifecycle of volumes not specifying the volume option
+	// VolumeOptionLifecycle.
+	VolumeProcessLifecycle VolumeProcessLifecycle
+	// How long Mount() waits for the volume process to mount a file system at
+	// the mount point of volumes not specifying the volume option
+	// VolumeOptionMountTimeout (0 disables waiting).
+	MountTimeout time.Duration
+	// The scope reported by Capabilities(). With VolumeScopeGlobal, Create()
+	// adopts existing volume folders and Remove() succeeds for unknown volumes,
+	// since Docker calls them on every node.
+	Scope VolumeScope
+	// How long mounts stay registered without being renewed (see
+	// pluginDriverMount), 0 disables expiry.
+	MountLease time.Duration
+	// Whether Remove() removes volumes not specifying the volume option
+	// VolumeOptionForceRemove even if they have active mounts.
+	ForceRemove bool
+	// What Remove() does with the folders of volumes not specifying the volume
+	// option VolumeOptionRemovePolicy.
+	RemovePolicy RemovePolicy
+	// How the folders of new volumes are named.
+	FolderNaming FolderNaming
+	// What to do if there is no control file, or none can be loaded.
+	ControlFileRecovery ControlFileRecovery
+	// Whether the output of new volume processes is written to a log file per
+	// volume (see pluginDriverVolume.LogFile()) rather than to the plugin's
+	// stdout and stderr.
+	VolumeLogs bool
+	// The size in bytes volume process log files are rotated at (0 disables
+	// rotation).
+	VolumeLogMaxSize uint
+	// How many rotated volume process log files to keep per volume.
+	VolumeLogMaxFiles uint
+	// Whether lines written to volume process log files are forwarded to the
+	// plugin's logger.
+	VolumeLogForward bool
+	// The backoff policy volume processes not specifying the volume option
+	// VolumeOptionRecoveryBackoff are restarted according to with
+	// proc.RecoveryModeBackoff (the zero value means
+	// proc.DefaultBackoffPolicy).
+	VolumeProcessRecoveryBackoff proc.BackoffPolicy
+	// The liveness probes of volume processes not specifying the volume option
+	// VolumeOptionLivenessProbe (none disables probing).
+	LivenessProbes []LivenessProbeKind
+	// The command of the exec liveness probe of volume processes not
+	// specifying the volume option VolumeOptionLivenessCommand.
+	LivenessCommand string
+	// Interval, timeout and failure threshold of liveness probes of volume
+	// processes not specifying the volume option VolumeOptionLivenessPolicy (the
+	// zero value means proc.DefaultLivenessPolicy).
+	LivenessPolicy proc.LivenessPolicy
+	// The identity and privileges of volume processes not specifying the
+	// according volume options (see ProcessAttributesParse()).
+	VolumeProcessAttributes proc.ProcessAttributes
+	// The command run when a volume process terminates with
+	// proc.RecoveryModeFail, separated like volume process options (none
+	// disables running a command, see pluginDriver_RunFailHook()).
+	FailHook string
+	// The names of failed volumes whose failure is reset when the driver is
+	// created (see pluginDriverVolume.Failed()).
+	ResetFailedVolumes []string
+}
+
+// Returns the sorted keys of all volume options that differ between [a] and
+// [b], i.e. are present in only one of them or have different values. Nil and
+// empty options are treated alike.
+func pluginDriver_OptionsDiff(a *map[string]string, b *map[string]string) []string {
+	var ma, mb map[string]string
+	if a != nil {
+		ma = *a
+	}
+	if b != nil {
+		mb = *b
+	}
+
+	diff := []string{}
+	for k, va := range ma {
+		if vb, ok := mb[k]; !ok || va != vb {
+			diff = append(diff, k)
+		}
+	}
+	for k := range mb {
+		if _, ok := ma[k]; !ok {
+			diff = append(diff, k)
+		}
+	}
+	slices.Sort(diff)
+
+	return diff
+}
+
+// The plugin's volume.Driver implementation.
+//
+// All handlers may be called concurrently. Handlers only reading Volumes hold
+// the read lock of RWMutex, handlers modifying Volumes or the mounts of any
+// volume hold the write lock for the whole request, including looking up the
+// volume and persisting the change. Only Mount() releases the write lock while
+// waiting for the volume process to mount (see mounting).
 type pluginDriver struct {
 	PropagatedMount string
 	slog.Logger
 	Volumes map[string]pluginDriverVolume
-	*sync.Mutex
-	ControlFile *os.File
+	*sync.RWMutex
+	Store StateStore
 	GetVolumeProcess
 	SetVolumeProcessOptions
 	VolumeProcessRecoveryMode      proc.RecoveryMode
 	VolumeProcessRecoveryRateLimit *metric.MetricRateLimit
+	pluginDriverOptions
+	// Mount() requests waiting for the volume process without holding the
+	// lock, which Shutdown() waits for.
+	mounting *sync.WaitGroup
+	// Set by Shutdown(), so no Mount() request starts waiting anymore.
+	shuttingDown *atomic.Bool
 }
 
 func pluginDriver_New(propagatedMount string, logger slog.Logger) (*pluginDriver, error) {
@@ -188,6 +841,20 @@ func pluginDriver_New(propagatedMount string, logger slog.Logger) (*pluginDriver
 }
 
 func pluginDriver_NewWithVolumeProcess(propagatedMount string, logger slog.Logger, getVolumeProcess GetVolumeProcess, setVolumeProcessOptions SetVolumeProcessOptions, recoveryMode proc.RecoveryMode, recoveryRateLimit *metric.MetricRateLimit) (*pluginDriver, error) {
+	return pluginDriver_NewWithStore(propagatedMount, logger, nil, getVolumeProcess, setVolumeProcessOptions, recoveryMode, recoveryRateLimit)
+}
+
+func pluginDriver_NewWithStore(propagatedMount string, logger slog.Logger, store StateStore, getVolumeProcess GetVolumeProcess, setVolumeProcessOptions SetVolumeProcessOptions, recoveryMode proc.RecoveryMode, recoveryRateLimit *metric.MetricRateLimit) (*pluginDriver, error) {
+	return pluginDriver_NewWithOptions(propagatedMount, logger, store, getVolumeProcess, setVolumeProcessOptions, recoveryMode, recoveryRateLimit, pluginDriverOptions{})
+}
+
+// Creates a new driver persisting volume information using [store]. If [store]
+// is nil, a log state store keeping it's files in [propagatedMount] is used.
+//
+// Loading the store replays any mutations journaled since the last compaction,
+// and recovers a missing or corrupt control file according to
+// options.ControlFileRecovery.
+func pluginDriver_NewWithOptions(propagatedMount string, logger slog.Logger, store StateStore, getVolumeProcess GetVolumeProcess, setVolumeProcessOptions SetVolumeProcessOptions, recoveryMode proc.RecoveryMode, recoveryRateLimit *metric.MetricRateLimit, options pluginDriverOptions) (*pluginDriver, error) {
 	if fileInfo, err := os.Lstat(propagatedMount); err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			if err := os.MkdirAll(propagatedMount, os.ModeDir); err != nil {
@@ -202,43 +869,93 @@ func pluginDriver_NewWithVolumeProcess(propagatedMount string, logger slog.Logge
 		}
 	}
 
-	controlFileName := DefaultControlFileName
-	controlFile, err := os.OpenFile(filepath.Join(propagatedMount, controlFileName), os.O_RDWR|os.O_CREATE, DefaultControlFileMode)
-	if err != nil {
+	if err := utils.CheckAccess(utils.CheckAccessCurrentUser, os.FileMode(0o3), propagatedMount); err != nil {
 		return nil, err
 	}
 
-	volumes, err := pluginDriver_Load(*controlFile)
+	if store == nil {
+		var err error
+		if store, err = stateStore_New(StateStoreKindLog, propagatedMount, DefaultControlFileGenerations, DefaultJournalCompactionThreshold, DefaultJournalCompactionInterval, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	volumes, err := pluginDriver_LoadWithRecovery(store, propagatedMount, options.ControlFileRecovery, logger)
 	if err != nil {
-		controlFile.Close()
-		return nil, err
+		return nil, errors.Join(err, store.Close())
 	}
 
 	d := &pluginDriver{
 		PropagatedMount: propagatedMount,
 		Logger:          logger,
 		//Volumes:               volumes,
-		Mutex:                          &sync.Mutex{},
-		ControlFile:                    controlFile,
+		RWMutex:                        &sync.RWMutex{},
+		mounting:                       &sync.WaitGroup{},
+		shuttingDown:                   &atomic.Bool{},
+		Store:                          store,
 		GetVolumeProcess:               getVolumeProcess,
 		SetVolumeProcessOptions:        setVolumeProcessOptions,
 		VolumeProcessRecoveryMode:      recoveryMode,
 		VolumeProcessRecoveryRateLimit: recoveryRateLimit,
+		pluginDriverOptions:            options,
 	}
 
 	mountCount := 0
+	now := time.Now()
 	for name, vol := range volumes {
 		//filepath.EvalSymlinks()
 		if err := utils.CheckAccess(utils.CheckAccessCurrentUser, os.FileMode(0o7), vol.MountPoint()); err != nil {
-			return nil, err
+			return nil, errors.Join(err, store.Close())
 		}
 		mountCount += len(*vol.Mounts)
 
-		if err := vol.SetupProcess(d); err != nil {
+		// Mounts registered before leases were introduced start their lease
+		// now.
+		stamped := false
+		for id, mount := range *vol.Mounts {
+			if mount.RenewedAt.IsZero() {
+				if mount.CreatedAt.IsZero() {
+					mount.CreatedAt = now
+				}
+				mount.RenewedAt = now
+				(*vol.Mounts)[id] = mount
+				stamped = true
+			}
+		}
+
+		reset := false
+		if err := vol.Failed(); err != nil && slices.Contains(options.ResetFailedVolumes, name) {
+			vol.Reset()
+			reset = true
+			d.Logger.Info(fmt.Sprintf("Reset failed volume [%s].", name), "failure", err)
+		}
+
+		puid := vol.Puid
+		lifecycle, err := vol.Lifecycle(d)
+		if err != nil {
+			d.Logger.Warn("Volume process lifecycle is invalid, using the default.", "err", err, "volume", vol)
+			lifecycle = d.VolumeProcessLifecycle
+		}
+		if lifecycle == VolumeProcessLifecycleMount && vol.ReferenceCount() < 1 {
+			if strings.TrimSpace(vol.Puid) != "" {
+				// Pick up a process left running, just to stop it.
+				if err := vol.SetupProcess(d); err != nil {
+					d.Logger.Warn("Setting up the volume process failed.", "volume", vol)
+				}
+				if err := vol.StopProcess(d); err != nil {
+					d.Logger.Warn("Stopping the volume process of an unmounted volume failed.", "err", err, "volume", vol)
+				}
+			}
+		} else if err := vol.SetupProcess(d); err != nil {
 			d.Logger.Warn("Setting up the volume process failed.", "volume", vol)
 		}
 
 		volumes[name] = vol
+		if vol.Puid != puid || stamped || reset {
+			if err := store.Put(name, vol); err != nil {
+				return nil, errors.Join(err, store.Close())
+			}
+		}
 	}
 	logger.Debug("Loaded volume information.", "volumeCount", len(volumes), "mountCount", mountCount)
 
@@ -246,45 +963,119 @@ func pluginDriver_NewWithVolumeProcess(propagatedMount string, logger slog.Logge
 	return d, nil
 }
 
-func pluginDriver_Load(file os.File) (data map[string]pluginDriverVolume, err error) {
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return nil, err
+// Returns the file name of the [generation]th previous version of the control
+// file [fileName], or [fileName] itself if [generation] is 0.
+func pluginDriver_Generation(fileName string, generation uint) string {
+	if generation < 1 {
+		return fileName
 	}
 
-	bytes, err := io.ReadAll(&file)
-	if err != nil {
-		return nil, err
+	return fmt.Sprintf("%s.%d", fileName, generation)
+}
+
+// Loads the volume information from the control file [fileName].
+//
+// If the control file cannot be read, migrated or unmarshalled, the previous
+// generations written by pluginDriver_Save() are probed in order, and the first
+// one that can be loaded successfully is used. The returned [loadedFrom] tells
+// which file the data has actually been loaded from.
+//
+// Documents of an older schema version are upgraded using
+// pluginDriver_Migrate(), after having written a backup of the original
+// document (see pluginDriver_MigrationBackup()).
+//
+// If neither the control file nor any generation exists (or all of them are
+// empty), an empty control file is returned.
+func pluginDriver_Load(fileName string) (controlFile *pluginDriverControlFile, loadedFrom string, fail error) {
+	errs := []error{}
+
+	for generation := uint(0); ; generation++ {
+		name := pluginDriver_Generation(fileName, generation)
+
+		bytes, err := os.ReadFile(name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				if generation < 1 {
+					continue
+				}
+				break
+			}
+
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(bytes) < 1 {
+			continue
+		}
+
+		migrated, migratedFrom, err := pluginDriver_Migrate(bytes)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		controlFile = &pluginDriverControlFile{}
+		if err := json.Unmarshal(migrated, controlFile); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if controlFile.Volumes == nil {
+			controlFile.Volumes = map[string]pluginDriverVolume{}
+		}
+
+		if migratedFrom != nil {
+			if err := pluginDriver_WriteMigrationBackup(name, *migratedFrom, bytes); err != nil {
+				return nil, "", err
+			}
+			controlFile.migratedFrom = migratedFrom
+		}
+
+		return controlFile, name, nil
 	}
 
-	if len(bytes) < 1 {
-		return map[string]pluginDriverVolume{}, nil
+	if len(errs) > 0 {
+		return nil, "", errors.Join(errs...)
 	}
-	if err := json.Unmarshal(bytes, &data); err != nil {
-		return nil, err
+
+	version, err := semver.Parse(ControlFileVersion)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return
+	return &pluginDriverControlFile{Version: *version, Volumes: map[string]pluginDriverVolume{}}, fileName, nil
 }
 
-func pluginDriver_Save(file os.File, data map[string]pluginDriverVolume) error {
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return err
+// Saves the volume information to the control file [fileName], using the
+// envelope of schema version ControlFileVersion.
+//
+// Before the new contents are written, the current control file is shifted to
+// become the most recent of up to [generations] previous versions, which
+// pluginDriver_Load() can fall back to. The new contents are then written using
+// utils.WriteFileAtomic(), so the control file is never left truncated or half
+// written.
+func pluginDriver_Save(fileName string, generations uint, data map[string]pluginDriverVolume) error {
+	if fileInfo, err := os.Lstat(fileName); err == nil && !fileInfo.Mode().IsRegular() {
+		return fmt.Errorf("path [%s] is not a regular file", fileName)
 	}
 
-	if err := file.Truncate(0); err != nil {
+	version, err := semver.Parse(ControlFileVersion)
+	if err != nil {
 		return err
 	}
 
-	bytes, err := json.MarshalIndent(data, "", "  ")
+	bytes, err := json.MarshalIndent(pluginDriverControlFile{Version: *version, Volumes: data}, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	if _, err := file.Write(bytes); err != nil {
-		return err
+	for generation := generations; generation > 0; generation-- {
+		if err := os.Rename(pluginDriver_Generation(fileName, generation-1), pluginDriver_Generation(fileName, generation)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
 	}
 
-	return nil
+	return utils.WriteFileAtomic(fileName, bytes, DefaultControlFileMode)
 }
 
 func (d pluginDriver) Tee(err error, args ...any) error {
@@ -298,6 +1089,9 @@ func (d pluginDriver) Tee(err error, args ...any) error {
 func (d pluginDriver) Get(req *volume.GetRequest) (*volume.GetResponse, error) {
 	d.Logger.Debug("Get() has been called.", "req", req)
 
+	d.RWMutex.RLock()
+	defer d.RWMutex.RUnlock()
+
 	if vol, ok := d.Volumes[req.Name]; !ok {
 		return nil, d.Tee(fmt.Errorf("volume [%s] could not be found", req.Name))
 	} else {
@@ -306,7 +1100,7 @@ func (d pluginDriver) Get(req *volume.GetRequest) (*volume.GetResponse, error) {
 				Name:       req.Name,
 				Mountpoint: vol.MountPoint(),
 				CreatedAt:  vol.CreatedAt.Format(time.RFC3339),
-				//Status: map[string]slog.Attr{"key":"value"},
+				Status:     vol.Status(&d),
 			},
 		}
 
@@ -318,41 +1112,81 @@ func (d pluginDriver) Get(req *volume.GetRequest) (*volume.GetResponse, error) {
 func (d pluginDriver) Create(req *volume.CreateRequest) error {
 	d.Logger.Debug("Create() has been called.", "req", req)
 
-	if _, ok := d.Volumes[req.Name]; ok {
-		return d.Tee(fmt.Errorf("volume [%s] already exists", req.Name))
+	d.RWMutex.Lock()
+	defer d.RWMutex.Unlock()
+
+	// Docker re-issues creating volumes (e.g. with compose and swarm), which
+	// is fine as long as the options don't change.
+	if vol, ok := d.Volumes[req.Name]; ok {
+		if diff := pluginDriver_OptionsDiff(vol.Options, &req.Options); len(diff) > 0 {
+			return d.Tee(fmt.Errorf("volume [%s] already exists with different options (%s)", req.Name, strings.Join(diff, ", ")))
+		}
+		d.Logger.Debug(fmt.Sprintf("Create() found volume [%s] to already exist with identical options.", req.Name))
+		return nil
+	}
+
+	res := pluginDriverVolume{
+		BasePath:  d.PropagatedMount,
+		Path:      folderNaming_FolderName(d.FolderNaming, req.Name),
+		CreatedAt: time.Now(),
+		Mounts:    &map[string]pluginDriverMount{},
+		Options:   &req.Options,
+	}
+	if err := res.ValidateOptions(&d); err != nil {
+		return d.Tee(err)
 	}
-	d.Mutex.Lock()
-	defer d.Mutex.Unlock()
+	// Both can't fail anymore, since the options have been validated.
+	lifecycle, _ := res.Lifecycle(&d)
+	attributes, _ := res.ProcessAttributes(&d)
 
-	volumePathRel := utils.SHA256StringToString(req.Name)
-	volumePathAbs := filepath.Join(d.PropagatedMount, volumePathRel)
+	volumePathAbs := res.MountPoint()
+	adopted := false
 	if _, err := os.Lstat(volumePathAbs); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			if err := os.MkdirAll(volumePathAbs, DefaultVolumeFolderMode); err != nil {
 				return d.Tee(err)
 			}
+			// The volume process needs to access the mount point.
+			if attributes.Credential != nil {
+				if err := os.Chown(volumePathAbs, int(attributes.Credential.Uid), int(attributes.Credential.Gid)); err != nil {
+					os.Remove(volumePathAbs)
+					return d.Tee(err)
+				}
+			}
 		} else {
 			return d.Tee(err)
 		}
+	} else if d.Scope == VolumeScopeGlobal {
+		// E.g. the propagated mount is shared across nodes, but sanitized
+		// volume names may also collide.
+		if marker, err := pluginDriverVolumeMarker_Read(volumePathAbs); err == nil && marker.Name != req.Name {
+			return d.Tee(fmt.Errorf("path [%s] already exists for volume [%s]", volumePathAbs, marker.Name))
+		}
+		adopted = true
+		d.Logger.Info(fmt.Sprintf("Create() adopts the existing path [%s] for volume [%s].", volumePathAbs, req.Name))
 	} else {
 		return d.Tee(fmt.Errorf("path [%s] already exists", volumePathAbs))
 	}
 
-	res := pluginDriverVolume{
-		BasePath:  d.PropagatedMount,
-		Path:      volumePathRel,
-		CreatedAt: time.Now(),
-		Mounts:    &map[string]pluginDriverMount{},
-		Options:   &req.Options,
+	// An adopted folder keeps the marker of the node that created it.
+	if marker, err := pluginDriverVolumeMarker_Read(volumePathAbs); !adopted || err != nil || marker.RemovedAt != nil {
+		if err := res.Marker(req.Name).Write(volumePathAbs); err != nil {
+			if !adopted {
+				os.Remove(volumePathAbs)
+			}
+			return d.Tee(err)
+		}
 	}
 
-	if err := res.SetupProcess(&d); err != nil {
-		d.Logger.Warn("Setting up the volume process failed.", "volume", res)
+	if lifecycle == VolumeProcessLifecycleVolume {
+		if err := res.SetupProcess(&d); err != nil {
+			d.Logger.Warn("Setting up the volume process failed.", "volume", res)
+		}
 	}
 
 	d.Volumes[req.Name] = res
 
-	if err := pluginDriver_Save(*d.ControlFile, d.Volumes); err != nil {
+	if err := d.Store.Put(req.Name, res); err != nil {
 		return d.Tee(err)
 	}
 
@@ -363,29 +1197,52 @@ func (d pluginDriver) Create(req *volume.CreateRequest) error {
 func (d pluginDriver) Remove(req *volume.RemoveRequest) error {
 	d.Logger.Debug("Remove() has been called.", "req", req)
 
+	d.RWMutex.Lock()
+	defer d.RWMutex.Unlock()
+
 	if vol, ok := d.Volumes[req.Name]; !ok {
+		if d.Scope == VolumeScopeGlobal {
+			d.Logger.Debug(fmt.Sprintf("Remove() didn't find volume [%s], which may have been created on another node only.", req.Name))
+			return nil
+		}
 		return d.Tee(fmt.Errorf("volume [%s] could not be found", req.Name))
 	} else {
-		if l := len(*vol.Mounts); l > 0 {
-			return d.Tee(fmt.Errorf("volume [%s] has %d active mounts", req.Name, l))
+		if pruned := vol.PruneMounts(d.MountLease, time.Now()); len(pruned) > 0 {
+			d.Logger.Warn(fmt.Sprintf("Remove() unregistered %d mounts of volume [%s] whose lease has expired.", len(pruned), req.Name), "ids", pruned, "lease", d.MountLease)
+			if err := d.Store.Put(req.Name, vol); err != nil {
+				return d.Tee(err)
+			}
 		}
 
-		d.Mutex.Lock()
-		defer d.Mutex.Unlock()
-
-		if processMonitor, ok := processMonitors[vol.Puid]; ok {
-			if err := proc.CancelProcess(processMonitor, 2*time.Second); err != nil {
-				d.Logger.Warn("Failed terminating volume process.", "err", err)
+		if l := len(*vol.Mounts); l > 0 {
+			if force, err := vol.ForceRemove(&d); err != nil {
+				return d.Tee(err)
+			} else if !force {
+				return d.Tee(fmt.Errorf("volume [%s] has %d active mounts", req.Name, l))
 			}
-			delete(processMonitors, vol.Puid)
+			d.Logger.Warn(fmt.Sprintf("Remove() forcibly removes volume [%s] despite %d active mounts.", req.Name, l), "mounts", *vol.Mounts)
 		}
 
-		if err := os.Remove(vol.MountPoint()); err != nil {
+		policy, err := vol.RemovePolicy(&d)
+		if err != nil {
 			return d.Tee(err)
 		}
+
+		if err := vol.StopProcess(&d); err != nil {
+			d.Logger.Warn("Failed terminating volume process.", "err", err)
+		}
+
+		if err := vol.RemoveFolder(&d, req.Name, policy); err != nil && !(d.Scope == VolumeScopeGlobal && errors.Is(err, fs.ErrNotExist)) {
+			return d.Tee(fmt.Errorf("removing the folder of volume [%s] with policy %s failed: %w", req.Name, policy, err))
+		}
+		if policy != RemovePolicyRetain {
+			if err := vol.RemoveLogFiles(&d); err != nil {
+				d.Logger.Warn("Failed removing the volume process log files.", "err", err, "volume", req.Name)
+			}
+		}
 		delete(d.Volumes, req.Name)
 
-		if err := pluginDriver_Save(*d.ControlFile, d.Volumes); err != nil {
+		if err := d.Store.Delete(req.Name); err != nil {
 			return d.Tee(err)
 		}
 	}
@@ -397,6 +1254,9 @@ func (d pluginDriver) Remove(req *volume.RemoveRequest) error {
 func (d pluginDriver) List() (*volume.ListResponse, error) {
 	d.Logger.Debug("List() has been called.")
 
+	d.RWMutex.RLock()
+	defer d.RWMutex.RUnlock()
+
 	res := volume.ListResponse{Volumes: []*volume.Volume{}}
 	for name, vol := range d.Volumes {
 		res.Volumes = append(res.Volumes, &volume.Volume{Name: name, Mountpoint: vol.MountPoint(), CreatedAt: vol.CreatedAt.Format(time.RFC3339)})
@@ -410,7 +1270,7 @@ func (d pluginDriver) Capabilities() *volume.CapabilitiesResponse {
 	d.Logger.Debug("Capabilities() has been called.")
 
 	res := volume.CapabilitiesResponse{
-		Capabilities: volume.Capability{Scope: "local"},
+		Capabilities: volume.Capability{Scope: strings.ToLower(d.Scope.String())},
 	}
 
 	d.Logger.Debug("Capabilities() successfully gathered the requested information.", "res", res)
@@ -420,37 +1280,93 @@ func (d pluginDriver) Capabilities() *volume.CapabilitiesResponse {
 func (d pluginDriver) Mount(req *volume.MountRequest) (*volume.MountResponse, error) {
 	d.Logger.Debug("Mount() has been called.", "req", req)
 
-	if vol, ok := d.Volumes[req.Name]; !ok {
+	d.RWMutex.Lock()
+
+	if d.shuttingDown.Load() {
+		d.RWMutex.Unlock()
+		return nil, d.Tee(fmt.Errorf("volume [%s] cannot be mounted while the plugin is shutting down", req.Name))
+	}
+	vol, ok := d.Volumes[req.Name]
+	if !ok {
+		d.RWMutex.Unlock()
 		return nil, d.Tee(fmt.Errorf("volume [%s] could not be found", req.Name))
-	} else {
-		res := volume.MountResponse{
-			Mountpoint: vol.MountPoint(),
+	}
+	if err := vol.Failed(); err != nil {
+		d.RWMutex.Unlock()
+		return nil, d.Tee(fmt.Errorf("volume [%s] has failed: %w", req.Name, err))
+	}
+
+	if vol.ReferenceCount() < 1 {
+		if lifecycle, err := vol.Lifecycle(&d); err != nil {
+			d.RWMutex.Unlock()
+			return nil, d.Tee(err)
+		} else if lifecycle == VolumeProcessLifecycleMount {
+			if err := vol.SetupProcess(&d); err != nil {
+				d.RWMutex.Unlock()
+				return nil, d.Tee(fmt.Errorf("starting the volume process of volume [%s] failed: %w", req.Name, err))
+			}
+			d.Volumes[req.Name] = vol
 		}
-		d.Mutex.Lock()
-		defer d.Mutex.Unlock()
+	}
 
-		mounts := *vol.Mounts
-		if mount, ok := mounts[req.ID]; ok {
-			mount.ReferenceCount++
-			mounts[req.ID] = pluginDriverMount{ReferenceCount: mount.ReferenceCount}
+	// Waiting for the volume process to mount may take up to the mount
+	// timeout, so other requests are served meanwhile. Shutdown() waits for
+	// the mount to be registered (or the process to be stopped) though.
+	d.mounting.Add(1)
+	defer d.mounting.Done()
+	d.RWMutex.Unlock()
+	waitErr := vol.WaitForMount(&d)
+	d.RWMutex.Lock()
+	defer d.RWMutex.Unlock()
+
+	// The volume may have been changed or removed while waiting.
+	if vol, ok = d.Volumes[req.Name]; !ok {
+		return nil, d.Tee(fmt.Errorf("volume [%s] has been removed while mounting", req.Name))
+	}
 
-			d.Logger.Debug(fmt.Sprintf("Mount() successfully incremented reference count of the mount for ID [%s] in volume [%s] to %d.", req.ID, req.Name, mount.ReferenceCount))
-		} else {
-			mounts[req.ID] = pluginDriverMount{ReferenceCount: 1}
-			d.Logger.Debug(fmt.Sprintf("Mount() successfully registered a mount for ID [%s] in volume [%s].", req.ID, req.Name), "res", res)
-		}
+	res := volume.MountResponse{
+		Mountpoint: vol.MountPoint(),
+	}
 
-		if err := pluginDriver_Save(*d.ControlFile, d.Volumes); err != nil {
-			return nil, d.Tee(err)
+	if waitErr != nil {
+		if vol.ReferenceCount() < 1 {
+			if lifecycle, _ := vol.Lifecycle(&d); lifecycle == VolumeProcessLifecycleMount {
+				if err := vol.StopProcess(&d); err != nil {
+					d.Logger.Warn("Failed terminating volume process.", "err", err, "volume", vol)
+				}
+				d.Volumes[req.Name] = vol
+			}
 		}
+		return nil, d.Tee(fmt.Errorf("volume [%s] is not ready: %w", req.Name, waitErr))
+	}
 
-		return &res, nil
+	mounts := *vol.Mounts
+	now := time.Now()
+	if mount, ok := mounts[req.ID]; ok {
+		mount.ReferenceCount++
+		mount.RenewedAt = now
+		mounts[req.ID] = mount
+
+		d.Logger.Debug(fmt.Sprintf("Mount() successfully incremented reference count of the mount for ID [%s] in volume [%s] to %d.", req.ID, req.Name, mount.ReferenceCount))
+	} else {
+		mounts[req.ID] = pluginDriverMount{ReferenceCount: 1, CreatedAt: now, RenewedAt: now}
+		d.Logger.Debug(fmt.Sprintf("Mount() successfully registered a mount for ID [%s] in volume [%s].", req.ID, req.Name), "res", res)
 	}
+
+	d.Volumes[req.Name] = vol
+	if err := d.Store.Put(req.Name, vol); err != nil {
+		return nil, d.Tee(err)
+	}
+
+	return &res, nil
 }
 
 func (d pluginDriver) Unmount(req *volume.UnmountRequest) error {
 	d.Logger.Debug("Unmount() has been called.", "req", req)
 
+	d.RWMutex.Lock()
+	defer d.RWMutex.Unlock()
+
 	if vol, ok := d.Volumes[req.Name]; !ok {
 		return d.Tee(fmt.Errorf("volume [%s] could not be found", req.Name))
 	} else {
@@ -459,12 +1375,10 @@ func (d pluginDriver) Unmount(req *volume.UnmountRequest) error {
 			d.Logger.Warn(fmt.Sprintf("Unmount() didn't find any mount for ID [%s] in volume [%s].", req.ID, req.Name))
 			return nil
 		} else {
-			d.Mutex.Lock()
-			defer d.Mutex.Unlock()
-
 			if mount.ReferenceCount > 0 {
 				mount.ReferenceCount--
-				mounts[req.ID] = pluginDriverMount{ReferenceCount: mount.ReferenceCount}
+				mount.RenewedAt = time.Now()
+				mounts[req.ID] = mount
 			}
 			if mount.ReferenceCount > 0 {
 				d.Logger.Debug(fmt.Sprintf("Unmount() successfully decremented reference count of the mount for ID [%s] in volume [%s] to %d.", req.ID, req.Name, mount.ReferenceCount))
@@ -473,7 +1387,16 @@ func (d pluginDriver) Unmount(req *volume.UnmountRequest) error {
 				d.Logger.Debug(fmt.Sprintf("Unmount() successfully unregistered the mount for ID [%s] in volume [%s].", req.ID, req.Name))
 			}
 
-			if err := pluginDriver_Save(*d.ControlFile, d.Volumes); err != nil {
+			if vol.ReferenceCount() < 1 && strings.TrimSpace(vol.Puid) != "" {
+				if lifecycle, err := vol.Lifecycle(&d); err == nil && lifecycle == VolumeProcessLifecycleMount {
+					if err := vol.StopProcess(&d); err != nil {
+						d.Logger.Warn("Failed terminating volume process.", "err", err, "volume", vol)
+					}
+				}
+			}
+
+			d.Volumes[req.Name] = vol
+			if err := d.Store.Put(req.Name, vol); err != nil {
 				return d.Tee(err)
 			}
 		}
@@ -485,6 +1408,9 @@ func (d pluginDriver) Unmount(req *volume.UnmountRequest) error {
 func (d pluginDriver) Path(req *volume.PathRequest) (*volume.PathResponse, error) {
 	d.Logger.Debug("Path() has been called.", "req", req)
 
+	d.RWMutex.RLock()
+	defer d.RWMutex.RUnlock()
+
 	if vol, ok := d.Volumes[req.Name]; !ok {
 		return nil, d.Tee(fmt.Errorf("volume [%s] could not be found", req.Name))
 	} else {
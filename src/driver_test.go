@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -19,11 +23,8 @@ import (
 
 var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug}))
 
-func Test_pluginDriver(t *testing.T) {
-	proc.Logger = logger
-
-	volumeFolder := t.TempDir()
-	driver, _ := pluginDriver_New(volumeFolder, *logger)
+// Makes [driver] use inotifywatch as the volume process.
+func pluginDriver_SetTestVolumeProcess(t *testing.T, driver *pluginDriver) {
 	if runBinary, err := exec.LookPath("inotifywatch"); err != nil {
 		t.Errorf("inotify-tools need to be installed (%s): sudo apt install inotify-tools", err.Error())
 	} else {
@@ -44,6 +45,14 @@ func Test_pluginDriver(t *testing.T) {
 			return nil
 		}
 	}
+}
+
+func Test_pluginDriver(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	driver, _ := pluginDriver_New(volumeFolder, *logger)
+	pluginDriver_SetTestVolumeProcess(t, driver)
 
 	if driver.Capabilities() == nil {
 		t.Error("Failed to gather driver capabilities.")
@@ -106,7 +115,11 @@ func Test_pluginDriver(t *testing.T) {
 		}
 	}
 
-	if json, err := os.ReadFile(driver.ControlFile.Name()); err != nil {
+	// Closing the store compacts any journaled changes into the control file.
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if json, err := os.ReadFile(filepath.Join(volumeFolder, DefaultControlFileName)); err != nil {
 		t.Fatal(err)
 	} else {
 		fmt.Printf("Current JSON from control file:\n%s\n", string(json))
@@ -204,6 +217,155 @@ func Test_pluginDriver_Get(t *testing.T) {
 	}
 }
 
+func Test_pluginDriver_Get_Status(t *testing.T) {
+	proc.Logger = logger
+
+	driver, err := pluginDriver_New(t.TempDir(), *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	pluginVolumeProcessOptions := proc.NewOptions(2, VOLUME_PROCESS_OPTIONS_SEPARATOR, true)
+	pluginMountOptions := mount.NewOptions(2)
+	if err := pluginVolumeProcessOptions.Set("-p"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pluginMountOptions.Set("a=1,b"); err != nil {
+		t.Fatal(err)
+	}
+	getVolumeProcess := driver.GetVolumeProcess
+	driver.GetVolumeProcess = func() (*exec.Cmd, *proc.Options, *mount.Options) {
+		cmd, _, _ := getVolumeProcess()
+		return cmd, &pluginVolumeProcessOptions, &pluginMountOptions
+	}
+
+	volumeName := "test_volume"
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"c": "-v", "o": "a=2,b=-"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := driver.Get(&volume.GetRequest{Name: volumeName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := res.Volume.Status
+	t.Logf("Status = %#v", status)
+
+	assert.DeepEqual(t, status["Mounts"], map[string]int{"test_id": 1})
+	if _, err := time.Parse(time.RFC3339, status["MountsRenewedAt"].(map[string]string)["test_id"]); err != nil {
+		t.Error(err)
+	}
+	assert.Assert(t, status["Puid"] == driver.Volumes[volumeName].Puid)
+	assert.Assert(t, status["State"] != "Unknown", "State = %v", status["State"])
+	if _, err := time.Parse(time.RFC3339, status["StartTime"].(string)); err != nil {
+		t.Error(err)
+	}
+	assert.Assert(t, status["RecoveryMode"] == proc.RecoveryModeIgnore.String())
+	assert.Assert(t, status["Restarts"] == uint(0))
+	events := status["Events"].([]map[string]interface{})
+	assert.Assert(t, len(events) == 1 && events[0]["Event"] == proc.ProcessEventStarted.String(), "Events = %v", events)
+	assert.Assert(t, status["Lifecycle"] == VolumeProcessLifecycleVolume.String())
+	assert.DeepEqual(t, status["VolumeProcessOptions"], []string{"-p", "-v"})
+	assert.Assert(t, status["MountOptions"] == "a=2")
+
+	// Volume level options must not leak into the plugin level options.
+	assert.Assert(t, pluginVolumeProcessOptions.String() == "-p")
+	assert.Assert(t, pluginMountOptions.String() == "a=1,b")
+
+	if err := driver.Unmount(&volume.UnmountRequest{Name: volumeName, ID: "test_id"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_pluginDriver_OptionsDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    *map[string]string
+		b    *map[string]string
+		want []string
+	}{
+		// Test cases.
+		{name: "Nil", a: nil, b: nil, want: []string{}},
+		{name: "Nil and empty", a: nil, b: &map[string]string{}, want: []string{}},
+		{name: "Identical", a: &map[string]string{"c": "-v", "o": "a=1"}, b: &map[string]string{"o": "a=1", "c": "-v"}, want: []string{}},
+		{name: "Different value", a: &map[string]string{"c": "-v", "o": "a=1"}, b: &map[string]string{"c": "-v", "o": "a=2"}, want: []string{"o"}},
+		{name: "Missing and added", a: &map[string]string{"o": "a=1", "x": ""}, b: &map[string]string{"c": "-v", "x": ""}, want: []string{"c", "o"}},
+		{name: "Nil and present", a: nil, b: &map[string]string{"o": "a=1", "c": "-v"}, want: []string{"c", "o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, pluginDriver_OptionsDiff(tt.a, tt.b), tt.want)
+			assert.DeepEqual(t, pluginDriver_OptionsDiff(tt.b, tt.a), tt.want)
+		})
+	}
+}
+
+func Test_pluginDriverVolume_ValidateOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *map[string]string
+		wantErr string
+	}{
+		// Test cases.
+		{name: "Nil", options: nil},
+		{name: "Valid", options: &map[string]string{"c": "-v", VolumeOptionLifecycle: "mount", VolumeOptionMountTimeout: "5s", VolumeOptionRecoveryMode: "restart"}},
+		{name: "Lifecycle", options: &map[string]string{VolumeOptionLifecycle: "forever"}, wantErr: "lifecycle"},
+		{name: "MountTimeout", options: &map[string]string{VolumeOptionMountTimeout: "-1s"}, wantErr: "mount timeout"},
+		{name: "ForceRemove", options: &map[string]string{VolumeOptionForceRemove: "maybe"}, wantErr: "force remove"},
+		{name: "RecoveryMode", options: &map[string]string{VolumeOptionRecoveryMode: "retry"}, wantErr: "recovery mode"},
+		{name: "RecoveryRateLimit", options: &map[string]string{VolumeOptionRecoveryMaxPerMin: "0"}, wantErr: "recovery max per min"},
+		{name: "RecoveryBackoff", options: &map[string]string{VolumeOptionRecoveryBackoff: "soon"}, wantErr: "recovery backoff"},
+		{name: "RemovePolicy", options: &map[string]string{VolumeOptionRemovePolicy: "shred"}, wantErr: "remove policy"},
+		{name: "ProcessAttributes", options: &map[string]string{VolumeOptionUser: "no-such-user"}, wantErr: "no-such-user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&pluginDriverVolume{Options: tt.options}).ValidateOptions(&pluginDriver{})
+			if tt.wantErr == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_Create(t *testing.T) {
+	t.Parallel()
+
+	driver, err := pluginDriver_New(t.TempDir(), *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := map[string]string{"o": "bucket=test", "c": "-v"}
+	for i := 0; i < 2; i++ {
+		if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: options}); err != nil {
+			t.Errorf("Creating volume [test_volume] with identical options failed (%s).", err.Error())
+		}
+	}
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"o": "bucket=other", "lifecycle": "mount"}}); err == nil {
+		t.Error("Creating volume [test_volume] with different options succeeded unexpectedly.")
+	} else {
+		assert.Assert(t, strings.HasSuffix(err.Error(), "(c, lifecycle, o)"), err.Error())
+	}
+
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
 func Test_pluginDriver_Path(t *testing.T) {
 	t.Parallel()
 
@@ -257,119 +419,508 @@ func Test_pluginDriver_List(t *testing.T) {
 	}
 }
 
-func Test_pluginDriver_Load(t *testing.T) {
-	testFileName := filepath.Join(t.TempDir(), DefaultControlFileName)
-
-	testFile, err := os.OpenFile(testFileName, os.O_RDWR|os.O_CREATE, DefaultControlFileMode)
+func Test_pluginDriver_Concurrency(t *testing.T) {
+	volumeFolder := t.TempDir()
+	driver, err := pluginDriver_New(volumeFolder, *logger)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := testFile.Close(); err != nil {
+
+	sharedVolume := "test_shared"
+	contendedVolume := "test_contended"
+	if err := driver.Create(&volume.CreateRequest{Name: sharedVolume}); err != nil {
 		t.Fatal(err)
 	}
-	if volumes, err := pluginDriver_Load(*testFile); err == nil {
-		t.Errorf("Loading invalid file to a %T succeeded unexpectedly.", volumes)
+
+	workers, iterations := 8, 10
+	created := atomic.Int32{}
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			// Creating an existing volume only fails with different options.
+			if err := driver.Create(&volume.CreateRequest{Name: contendedVolume, Options: map[string]string{"worker": fmt.Sprint(worker)}}); err == nil {
+				created.Add(1)
+			}
+
+			mountId := fmt.Sprintf("test_id%d", worker)
+			for iteration := 0; iteration < iterations; iteration++ {
+				volumeName := fmt.Sprintf("test_volume%d_%d", worker, iteration)
+
+				if err := driver.Create(&volume.CreateRequest{Name: volumeName}); err != nil {
+					t.Errorf("Creating volume [%s] failed (%s).", volumeName, err.Error())
+					continue
+				}
+				for _, name := range []string{sharedVolume, volumeName} {
+					if _, err := driver.Mount(&volume.MountRequest{Name: name, ID: mountId}); err != nil {
+						t.Errorf("Mounting volume [%s] for id [%s] failed (%s).", name, mountId, err.Error())
+					}
+				}
+				if _, err := driver.Get(&volume.GetRequest{Name: volumeName}); err != nil {
+					t.Errorf("Getting volume [%s] failed (%s).", volumeName, err.Error())
+				}
+				if _, err := driver.Path(&volume.PathRequest{Name: sharedVolume}); err != nil {
+					t.Errorf("Getting the path of volume [%s] failed (%s).", sharedVolume, err.Error())
+				}
+				if _, err := driver.List(); err != nil {
+					t.Errorf("Listing volumes failed (%s).", err.Error())
+				}
+				for _, name := range []string{volumeName, sharedVolume} {
+					if err := driver.Unmount(&volume.UnmountRequest{Name: name, ID: mountId}); err != nil {
+						t.Errorf("Unmounting volume [%s] for id [%s] failed (%s).", name, mountId, err.Error())
+					}
+				}
+				if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+					t.Errorf("Removing volume [%s] failed (%s).", volumeName, err.Error())
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	assert.Assert(t, created.Load() == 1, "Volume [%s] has been created %d times.", contendedVolume, created.Load())
+
+	if res, err := driver.List(); err != nil {
+		t.Error(err)
 	} else {
-		logger.Debug(err.Error())
+		assert.Assert(t, len(res.Volumes) == 2, "%d volumes left over.", len(res.Volumes))
 	}
+	assert.Assert(t, len(*driver.Volumes[sharedVolume].Mounts) == 0)
 
-	testFile, err = os.OpenFile(testFileName, os.O_WRONLY, DefaultControlFileMode)
-	if err != nil {
+	if err := driver.Store.Close(); err != nil {
 		t.Fatal(err)
 	}
-	if volumes, err := pluginDriver_Load(*testFile); err == nil {
-		t.Errorf("Loading invalid file to a %T succeeded unexpectedly.", volumes)
+	if driver, err := pluginDriver_New(volumeFolder, *logger); err != nil {
+		t.Fatal(err)
 	} else {
-		logger.Debug(err.Error())
+		assert.Assert(t, len(driver.Volumes) == 2)
+		assert.Assert(t, len(*driver.Volumes[sharedVolume].Mounts) == 0)
+		if err := driver.Store.Close(); err != nil {
+			t.Error(err)
+		}
 	}
-	if err := testFile.Close(); err != nil {
+}
+
+func Test_pluginDriver_WaitForMount(t *testing.T) {
+	proc.Logger = logger
+
+	driver, err := pluginDriver_NewWithOptions(t.TempDir(), *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{VolumeProcessLifecycle: VolumeProcessLifecycleMount})
+	if err != nil {
 		t.Fatal(err)
 	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
 
-	testFile, err = os.OpenFile(testFileName, os.O_RDONLY, DefaultControlFileMode)
-	if err != nil {
+	if err := driver.Create(&volume.CreateRequest{Name: "test_invalid", Options: map[string]string{VolumeOptionMountTimeout: "soon"}}); err == nil {
+		t.Error("Creating a volume with an invalid mount timeout succeeded unexpectedly.")
+	}
+	if err := driver.Create(&volume.CreateRequest{Name: "test_negative", Options: map[string]string{VolumeOptionMountTimeout: "-1s"}}); err == nil {
+		t.Error("Creating a volume with a negative mount timeout succeeded unexpectedly.")
+	}
+
+	// The test volume process never mounts anything.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"c": "-v", VolumeOptionMountTimeout: "500ms"}}); err != nil {
 		t.Fatal(err)
 	}
-	if volumes, err := pluginDriver_Load(*testFile); err != nil {
+	mounted := make(chan error, 1)
+	go func() {
+		_, err := driver.Mount(&volume.MountRequest{Name: "test_volume", ID: "test_id"})
+		mounted <- err
+	}()
+	// Other requests are served while waiting.
+	time.Sleep(100 * time.Millisecond)
+	getStarted := time.Now()
+	if _, err := driver.Get(&volume.GetRequest{Name: "test_volume"}); err != nil {
 		t.Error(err)
+	}
+	assert.Assert(t, time.Since(getStarted) < 250*time.Millisecond, "Get() has been blocked by Mount() waiting for %s.", time.Since(getStarted))
+	if err := <-mounted; err == nil {
+		t.Error("Mounting a volume that never gets ready succeeded unexpectedly.")
 	} else {
-		assert.Assert(t, len(volumes) < 1)
+		assert.Assert(t, strings.Contains(err.Error(), "is not ready"), err.Error())
 	}
-	if err := testFile.Close(); err != nil {
+	vol := driver.Volumes["test_volume"]
+	assert.Assert(t, vol.ReferenceCount() == 0)
+	assert.Assert(t, vol.Puid == "", "The volume process has not been stopped after the mount failed.")
+
+	// Volumes without a mount timeout are not waited for.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_nowait", Options: map[string]string{"c": "-v"}}); err != nil {
 		t.Fatal(err)
 	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: "test_nowait", ID: "test_id"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Unmount(&volume.UnmountRequest{Name: "test_nowait", ID: "test_id"}); err != nil {
+		t.Error(err)
+	}
 
-	if err := os.WriteFile(testFileName, []byte("{}"), DefaultControlFileMode); err != nil {
+	// Restarted volume processes are waited for, rather than considered dead.
+	driver.VolumeProcessLifecycle = VolumeProcessLifecycleVolume
+	if err := driver.Create(&volume.CreateRequest{Name: "test_restarted", Options: map[string]string{"c": "-v", VolumeOptionMountTimeout: "500ms", VolumeOptionRecoveryMode: "restart"}}); err != nil {
 		t.Fatal(err)
 	}
-	testFile, err = os.OpenFile(testFileName, os.O_RDONLY, DefaultControlFileMode)
+	restarted := driver.Volumes["test_restarted"]
+	processMonitor, ok := processMonitors_Load(restarted.Puid)
+	assert.Assert(t, ok, "The volume process is not monitored.")
+	events, unsubscribe := processMonitor.Subscribe(0)
+	defer unsubscribe()
+	if err := syscall.Kill(int(processMonitor.Status().ProcessInfo.Pid), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for started := false; !started; {
+		select {
+		case event := <-events:
+			started = event.Kind == proc.ProcessEventStarted
+		case <-time.After(10 * time.Second):
+			t.Fatal("The volume process has not been restarted.")
+		}
+	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: "test_restarted", ID: "test_id"}); err == nil {
+		t.Error("Mounting a volume that never gets ready succeeded unexpectedly.")
+	} else {
+		assert.Assert(t, !strings.Contains(err.Error(), "terminated before mounting"), err.Error())
+	}
+
+	for _, volumeName := range []string{"test_volume", "test_nowait", "test_restarted"} {
+		if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_pluginDriver_MountLease(t *testing.T) {
+	volumeFolder := t.TempDir()
+	driver, err := pluginDriver_NewWithOptions(volumeFolder, *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{MountLease: time.Hour})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if volumes, err := pluginDriver_Load(*testFile); err != nil {
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_invalid", Options: map[string]string{VolumeOptionForceRemove: "maybe"}}); err == nil {
+		t.Error("Creating a volume with an invalid force remove option succeeded unexpectedly.")
+	}
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume"}); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	if _, err := driver.Mount(&volume.MountRequest{Name: "test_volume", ID: "test_id"}); err != nil {
+		t.Fatal(err)
+	}
+	mount := (*driver.Volumes["test_volume"].Mounts)["test_id"]
+	assert.Assert(t, !mount.CreatedAt.Before(before) && mount.RenewedAt.Equal(mount.CreatedAt))
+	if _, err := driver.Mount(&volume.MountRequest{Name: "test_volume", ID: "test_id"}); err != nil {
+		t.Fatal(err)
+	}
+	renewed := (*driver.Volumes["test_volume"].Mounts)["test_id"]
+	assert.Assert(t, renewed.CreatedAt.Equal(mount.CreatedAt) && !renewed.RenewedAt.Before(mount.RenewedAt))
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err == nil {
+		t.Error("Removing a volume with an active mount succeeded unexpectedly.")
+	}
+
+	// Pretend dockerd crashed before unmounting.
+	renewed.RenewedAt = time.Now().Add(-2 * time.Hour)
+	(*driver.Volumes["test_volume"].Mounts)["test_id"] = renewed
+	drifts := driver.Reconcile(ReconcileModeReport)
+	assert.Assert(t, len(drifts) == 1 && drifts[0].Kind == ReconcileDriftExpiredMount, "drifts = %v", drifts)
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err != nil {
 		t.Error(err)
-	} else {
-		assert.Assert(t, len(volumes) < 1)
 	}
-	if err := testFile.Close(); err != nil {
+
+	// Forcibly removing ignores active mounts.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_force", Options: map[string]string{VolumeOptionForceRemove: "true"}}); err != nil {
 		t.Fatal(err)
 	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: "test_force", ID: "test_id"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_force"}); err != nil {
+		t.Error(err)
+	}
 
-	if err := os.WriteFile(testFileName, []byte(testFileName), DefaultControlFileMode); err != nil {
+	// Mounts registered without a lease start one when loaded.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_legacy"}); err != nil {
+		t.Fatal(err)
+	}
+	legacy := driver.Volumes["test_legacy"]
+	legacy.Mounts = &map[string]pluginDriverMount{"test_id": {ReferenceCount: 1}}
+	if err := driver.Store.Put("test_legacy", legacy); err != nil {
 		t.Fatal(err)
 	}
-	testFile, err = os.OpenFile(testFileName, os.O_RDONLY, DefaultControlFileMode)
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	before = time.Now()
+	driver, err = pluginDriver_NewWithOptions(volumeFolder, *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{MountLease: time.Hour})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if volumes, err := pluginDriver_Load(*testFile); err == nil {
-		t.Errorf("Loading invalid file to a %T succeeded unexpectedly.", volumes)
-	} else {
-		logger.Debug(err.Error())
+	mount = (*driver.Volumes["test_legacy"].Mounts)["test_id"]
+	assert.Assert(t, !mount.RenewedAt.Before(before) && !mount.CreatedAt.Before(before))
+	if err := driver.Unmount(&volume.UnmountRequest{Name: "test_legacy", ID: "test_id"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_legacy"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_pluginDriver_RecoveryBackoff(t *testing.T) {
+	driverBackoff := proc.BackoffPolicy{InitialDelay: time.Second, Multiplier: 3, MaxDelay: time.Minute}
+	tests := []struct {
+		name    string
+		driver  proc.BackoffPolicy
+		options *map[string]string
+		want    proc.BackoffPolicy
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Default", options: nil, want: proc.DefaultBackoffPolicy},
+		{name: "Driver", driver: driverBackoff, options: &map[string]string{}, want: driverBackoff},
+		{name: "Volume", driver: driverBackoff, options: &map[string]string{VolumeOptionRecoveryBackoff: "max=1h,attempts=3"}, want: proc.BackoffPolicy{InitialDelay: time.Second, Multiplier: 3, MaxDelay: time.Hour, MaxAttempts: 3}},
+		{name: "Invalid", driver: driverBackoff, options: &map[string]string{VolumeOptionRecoveryBackoff: "max=1ms"}, want: driverBackoff, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &pluginDriver{pluginDriverOptions: pluginDriverOptions{VolumeProcessRecoveryBackoff: tt.driver}}
+			got, err := (&pluginDriverVolume{Options: tt.options}).RecoveryBackoff(d)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RecoveryBackoff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, got, tt.want)
+		})
 	}
-	if err := testFile.Close(); err != nil {
+
+	driver, err := pluginDriver_New(t.TempDir(), *logger)
+	if err != nil {
 		t.Fatal(err)
 	}
+	if err := driver.Create(&volume.CreateRequest{Name: "test_invalid", Options: map[string]string{VolumeOptionRecoveryBackoff: "soon"}}); err == nil {
+		t.Error("Creating a volume with an invalid recovery backoff succeeded unexpectedly.")
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
 }
 
-func Test_pluginDriver_Save(t *testing.T) {
-	testFileName := filepath.Join(t.TempDir(), DefaultControlFileName)
-	volumes := map[string]pluginDriverVolume{}
+func Test_pluginDriver_RecoveryMode(t *testing.T) {
+	proc.Logger = logger
 
-	testFile, err := os.OpenFile(testFileName, os.O_RDWR|os.O_CREATE, DefaultControlFileMode)
+	driver, err := pluginDriver_New(t.TempDir(), *logger)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := testFile.Close(); err != nil {
+	pluginDriver_SetTestVolumeProcess(t, driver)
+	assert.Assert(t, driver.VolumeProcessRecoveryMode == proc.RecoveryModeIgnore)
+
+	for name, options := range map[string]map[string]string{
+		"test_invalid_mode":  {VolumeOptionRecoveryMode: "retry"},
+		"test_invalid_limit": {VolumeOptionRecoveryMaxPerMin: "many"},
+		"test_zero_limit":    {VolumeOptionRecoveryMaxPerMin: "0"},
+	} {
+		if err := driver.Create(&volume.CreateRequest{Name: name, Options: options}); err == nil {
+			t.Errorf("Creating volume [%s] succeeded unexpectedly.", name)
+		}
+	}
+
+	volumeName := "test_volume"
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "restart", VolumeOptionRecoveryMaxPerMin: "10"}}); err != nil {
+		t.Fatal(err)
+	}
+	vol := driver.Volumes[volumeName]
+	if rateLimit, err := vol.RecoveryRateLimit(driver); err != nil || rateLimit == nil || rateLimit.Limit != 10 || rateLimit.Duration != time.Minute {
+		t.Errorf("RecoveryRateLimit() = %v, %v", rateLimit, err)
+	}
+
+	getStatus := func() map[string]interface{} {
+		res, err := driver.Get(&volume.GetRequest{Name: volumeName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Volume.Status
+	}
+	status := getStatus()
+	assert.Assert(t, status["RecoveryMode"] == proc.RecoveryModeRestart.String(), "RecoveryMode = %v", status["RecoveryMode"])
+
+	// The volume process is restarted, although the driver ignores crashes.
+	if err := syscall.Kill(int(status["Pid"].(uint64)), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; getStatus()["Restarts"] != uint(1); i++ {
+		if i > 50 {
+			t.Fatalf("The volume process has not been restarted (%#v).", getStatus())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Assert(t, getStatus()["RestartRate"] == "1 within the last 1m0s", "RestartRate = %v", getStatus()["RestartRate"])
+	events := []string{}
+	for _, event := range getStatus()["Events"].([]map[string]interface{}) {
+		events = append(events, event["Event"].(string))
+	}
+	assert.DeepEqual(t, events, []string{"Started", "Exited", "Restarting", "Started"})
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Error(err)
+	}
+
+	// A volume process failing while nothing is mounted isn't restarted by
+	// mounting the volume.
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "fail", VolumeOptionLifecycle: "volume"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(int(getStatus()["Pid"].(uint64)), syscall.SIGKILL); err != nil {
 		t.Fatal(err)
 	}
-	if err := pluginDriver_Save(*testFile, volumes); err == nil {
-		t.Errorf("Saving invalid %T succeeded unexpectedly (expected file to be already closed).", testFile)
+	for i := 0; getStatus()["Failure"] == nil; i++ {
+		if i > 50 {
+			t.Fatalf("The volume has not failed (%#v).", getStatus())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_mount"}); err == nil {
+			t.Fatal("Mounting a failed volume succeeded unexpectedly.")
+		} else {
+			assert.ErrorContains(t, err, "signal: killed")
+		}
+	}
+	assert.Assert(t, getStatus()["Pid"] == nil, "The volume process of the failed volume has been started again.")
+
+	// Creating the volume again resets the failure.
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "fail", VolumeOptionLifecycle: "volume"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_mount"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Unmount(&volume.UnmountRequest{Name: volumeName, ID: "test_mount"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_pluginDriver_Load(t *testing.T) {
+	testFolder := t.TempDir()
+	testFileName := filepath.Join(testFolder, DefaultControlFileName)
+
+	if controlFile, loadedFrom, err := pluginDriver_Load(testFolder); err == nil {
+		t.Errorf("Loading folder to a %T succeeded unexpectedly (from %s).", controlFile, loadedFrom)
 	} else {
 		logger.Debug(err.Error())
 	}
 
-	testFile, err = os.OpenFile(testFileName, os.O_RDONLY, DefaultControlFileMode)
-	if err != nil {
+	if controlFile, loadedFrom, err := pluginDriver_Load(testFileName); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, len(controlFile.Volumes) < 1)
+		assert.Assert(t, loadedFrom == testFileName)
+	}
+
+	if err := os.WriteFile(testFileName, []byte{}, DefaultControlFileMode); err != nil {
 		t.Fatal(err)
 	}
-	if err := pluginDriver_Save(*testFile, volumes); err == nil {
-		t.Errorf("Saving invalid %T succeeded unexpectedly (expected fail due to file being opened read-only).", testFile)
+	if controlFile, loadedFrom, err := pluginDriver_Load(testFileName); err != nil {
+		t.Error(err)
 	} else {
-		logger.Debug(err.Error())
+		assert.Assert(t, len(controlFile.Volumes) < 1)
+		assert.Assert(t, loadedFrom == testFileName)
 	}
-	if err := testFile.Close(); err != nil {
+
+	if err := os.WriteFile(testFileName, []byte("{}"), DefaultControlFileMode); err != nil {
 		t.Fatal(err)
 	}
+	if controlFile, loadedFrom, err := pluginDriver_Load(testFileName); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, len(controlFile.Volumes) < 1)
+		assert.Assert(t, loadedFrom == testFileName)
+	}
 
-	testFile, err = os.OpenFile(testFileName, os.O_WRONLY, DefaultControlFileMode)
-	if err != nil {
+	if err := os.WriteFile(testFileName, []byte(testFileName), DefaultControlFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if controlFile, loadedFrom, err := pluginDriver_Load(testFileName); err == nil {
+		t.Errorf("Loading invalid file to a %T succeeded unexpectedly (from %s).", controlFile, loadedFrom)
+	} else {
+		logger.Debug(err.Error())
+	}
+
+	testGeneration := pluginDriver_Generation(testFileName, 1)
+	if err := os.WriteFile(testGeneration, []byte(`{"test_volume": {}}`), DefaultControlFileMode); err != nil {
 		t.Fatal(err)
 	}
-	if err := pluginDriver_Save(*testFile, volumes); err != nil {
+	if controlFile, loadedFrom, err := pluginDriver_Load(testFileName); err != nil {
 		t.Error(err)
+	} else {
+		assert.Assert(t, len(controlFile.Volumes) == 1)
+		assert.Assert(t, loadedFrom == testGeneration)
+	}
+}
+
+func Test_pluginDriver_Save(t *testing.T) {
+	testFolder := t.TempDir()
+	testFileName := filepath.Join(testFolder, DefaultControlFileName)
+	volumes := map[string]pluginDriverVolume{}
+
+	if err := pluginDriver_Save(filepath.Join(testFolder, "missing", DefaultControlFileName), DefaultControlFileGenerations, volumes); err == nil {
+		t.Errorf("Saving to a missing folder succeeded unexpectedly.")
+	} else {
+		logger.Debug(err.Error())
+	}
+
+	if err := pluginDriver_Save(testFolder, DefaultControlFileGenerations, volumes); err == nil {
+		t.Errorf("Saving to a folder succeeded unexpectedly.")
+	} else {
+		logger.Debug(err.Error())
+	}
+
+	for i := 0; i <= DefaultControlFileGenerations+1; i++ {
+		volumes[fmt.Sprintf("test_volume%d", i)] = pluginDriverVolume{}
+		if err := pluginDriver_Save(testFileName, DefaultControlFileGenerations, volumes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for generation := uint(0); generation <= DefaultControlFileGenerations; generation++ {
+		if data, err := os.ReadFile(pluginDriver_Generation(testFileName, generation)); err != nil {
+			t.Error(err)
+		} else {
+			got := pluginDriverControlFile{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Error(err)
+			}
+			assert.Assert(t, got.Version.String() == ControlFileVersion)
+			assert.Assert(t, len(got.Volumes) == len(volumes)-int(generation), "Generation %d has %d volumes, want %d.", generation, len(got.Volumes), len(volumes)-int(generation))
+		}
+	}
+	if _, err := os.Lstat(pluginDriver_Generation(testFileName, DefaultControlFileGenerations+1)); err == nil {
+		t.Errorf("Generation %d has been expected not to exist.", DefaultControlFileGenerations+1)
 	}
-	if err := testFile.Close(); err != nil {
+
+	if err := os.WriteFile(testFileName, []byte{}, DefaultControlFileMode); err != nil {
 		t.Fatal(err)
 	}
+	if loaded, loadedFrom, err := pluginDriver_Load(testFileName); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, loaded.migratedFrom == nil)
+		assert.Assert(t, len(loaded.Volumes) == len(volumes)-1)
+		assert.Assert(t, loadedFrom == pluginDriver_Generation(testFileName, 1))
+	}
 }
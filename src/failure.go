@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thorbenw/docker-volume-plugin/proc"
+)
+
+const (
+	// How long the fail hook may run before it is killed.
+	DefaultFailHookTimeout = 1 * time.Minute
+	// The names of the environment variables passing the failed volume to the
+	// fail hook.
+	FailHookEnvVolumeName = "VOLUME_NAME"
+	FailHookEnvMountPoint = "VOLUME_MOUNTPOINT"
+	FailHookEnvExitCode   = "VOLUME_EXIT_CODE"
+	FailHookEnvFailure    = "VOLUME_FAILURE"
+)
+
+// region pluginDriverVolume failure
+
+// Returns an error describing why the volume process terminated with
+// proc.RecoveryModeFail, or nil if it didn't.
+//
+// A failed volume cannot be mounted and it's volume process isn't started
+// anymore until the failure is reset explicitly, either by removing and
+// creating the volume again, or by naming it in
+// pluginDriverOptions.ResetFailedVolumes (see Reset()).
+func (v *pluginDriverVolume) Failed() error {
+	if v.FailedAt == nil {
+		return nil
+	}
+
+	return fmt.Errorf("the volume process terminated unexpectedly at %s (%s)", v.FailedAt.Format(time.RFC3339), v.Failure)
+}
+
+// Clears the failure of the volume, so it's volume process can be set up again.
+func (v *pluginDriverVolume) Reset() {
+	v.Failure, v.FailedAt = "", nil
+}
+
+// region pluginDriver failure
+
+// Marks the volume in [folder] as failed once [processMonitor] reports
+// proc.ProcessEventFailed, and runs the fail hook.
+//
+// Takes a pointer to the driver, since volumes picked up by the constructor
+// are set up before they are assigned to the driver.
+func pluginDriver_WatchFailure(d *pluginDriver, folder string, processMonitor *proc.ProcessMonitor) {
+	events, _ := processMonitor.Subscribe(0)
+	go func() {
+		for event := range events {
+			if event.Kind != proc.ProcessEventFailed {
+				continue
+			}
+
+			if name, vol, ok := pluginDriver_FailVolume(d, folder, processMonitor, event); ok {
+				pluginDriver_RunFailHook(d, name, &vol, event)
+			}
+		}
+	}()
+}
+
+// Marks the volume in [folder] as failed due to [event] and forgets about
+// [processMonitor], which terminated. Returns the name and the updated volume,
+// or false if no volume is in [folder] (anymore).
+func pluginDriver_FailVolume(d *pluginDriver, folder string, processMonitor *proc.ProcessMonitor, event proc.ProcessEvent) (string, pluginDriverVolume, bool) {
+	d.RWMutex.Lock()
+	defer d.RWMutex.Unlock()
+
+	for name, vol := range d.Volumes {
+		if vol.Path != folder {
+			continue
+		}
+
+		failedAt := event.Time
+		vol.Failure = event.Detail
+		vol.FailedAt = &failedAt
+		if monitor, ok := processMonitors_Load(vol.Puid); ok && monitor == processMonitor {
+			processMonitors_LoadAndDelete(vol.Puid)
+			vol.Puid = ""
+		}
+		d.Logger.Warn(fmt.Sprintf("Volume [%s] has failed.", name), "failure", vol.Failure, "exitCode", event.ExitCode)
+
+		d.Volumes[name] = vol
+		if err := d.Store.Put(name, vol); err != nil {
+			d.Tee(err)
+		}
+
+		return name, vol, true
+	}
+
+	d.Logger.Warn("The volume process of an unknown volume has failed.", "folder", folder, "failure", event.Detail)
+	return "", pluginDriverVolume{}, false
+}
+
+// Runs the driver's FailHook (if any) for the volume [name], which failed due
+// to [event], passing the volume in the FailHookEnv* environment variables.
+// The hook is killed if it doesn't exit within DefaultFailHookTimeout.
+func pluginDriver_RunFailHook(d *pluginDriver, name string, vol *pluginDriverVolume, event proc.ProcessEvent) {
+	argv := vol.CommandLine(d.FailHook)
+	if len(argv) < 1 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultFailHookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(),
+		FailHookEnvVolumeName+"="+name,
+		FailHookEnvMountPoint+"="+vol.MountPoint(),
+		FailHookEnvExitCode+"="+strconv.Itoa(event.ExitCode),
+		FailHookEnvFailure+"="+event.Detail,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		d.Logger.Warn(fmt.Sprintf("The fail hook of volume [%s] failed.", name), "err", err, "output", strings.TrimSpace(string(output)))
+	} else {
+		d.Logger.Info(fmt.Sprintf("Ran the fail hook of volume [%s].", name), "output", strings.TrimSpace(string(output)))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func Test_pluginDriver_Fail(t *testing.T) {
+	proc.Logger = logger
+
+	propagatedMount := t.TempDir()
+	hookFile := filepath.Join(t.TempDir(), "hook")
+
+	driver, err := pluginDriver_New(propagatedMount, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+	driver.FailHook = "/bin/sh&-c&echo \"$VOLUME_NAME|$VOLUME_EXIT_CODE|$VOLUME_FAILURE|$VOLUME_MOUNTPOINT\" > " + hookFile
+
+	volumeName := "test_volume"
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "fail"}}); err != nil {
+		t.Fatal(err)
+	}
+	vol := driver.Volumes[volumeName]
+	mountPoint := vol.MountPoint()
+
+	getStatus := func() map[string]interface{} {
+		res, err := driver.Get(&volume.GetRequest{Name: volumeName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Volume.Status
+	}
+	status := getStatus()
+	assert.Assert(t, status["RecoveryMode"] == proc.RecoveryModeFail.String(), "RecoveryMode = %v", status["RecoveryMode"])
+
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_mount"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The volume fails instead of the plugin panicking.
+	if err := syscall.Kill(int(status["Pid"].(uint64)), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; getStatus()["Failure"] == nil; i++ {
+		if i > 50 {
+			t.Fatalf("The volume has not failed (%#v).", getStatus())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	status = getStatus()
+	assert.Assert(t, status["Failure"] == "signal: killed", "Failure = %v", status["Failure"])
+	assert.Assert(t, status["FailedAt"] != nil)
+	assert.Assert(t, status["Puid"] == nil, "Puid = %v", status["Puid"])
+
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_other_mount"}); err == nil {
+		t.Error("Mounting a failed volume which is still mounted succeeded unexpectedly.")
+	} else {
+		assert.ErrorContains(t, err, "signal: killed")
+	}
+
+	for i := 0; ; i++ {
+		if hook, err := os.ReadFile(hookFile); err == nil && strings.HasSuffix(string(hook), "\n") {
+			assert.Equal(t, string(hook), volumeName+"|-1|signal: killed|"+mountPoint+"\n")
+			break
+		} else if i > 50 {
+			t.Fatalf("The fail hook has not been run (%v).", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Other volumes keep being served.
+	otherName := "test_other"
+	if err := driver.Create(&volume.CreateRequest{Name: otherName, Options: map[string]string{"c": "-v"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: otherName, ID: "test_mount"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Unmount(&volume.UnmountRequest{Name: otherName, ID: "test_mount"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Remove(&volume.RemoveRequest{Name: otherName}); err != nil {
+		t.Error(err)
+	}
+
+	// The failure is persisted.
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if driver, err = pluginDriver_New(propagatedMount, *logger); err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+	vol = driver.Volumes[volumeName]
+	assert.Assert(t, vol.Failed() != nil)
+	assert.Assert(t, strings.TrimSpace(vol.Puid) == "", "Puid = %s", vol.Puid)
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_other_mount"}); err == nil {
+		t.Error("Mounting a failed volume which is still mounted succeeded unexpectedly after reloading.")
+	}
+
+	// Being unmounted everywhere doesn't reset the failure.
+	if err := driver.Unmount(&volume.UnmountRequest{Name: volumeName, ID: "test_mount"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_mount"}); err == nil {
+		t.Error("Mounting a failed volume which is not mounted anymore succeeded unexpectedly.")
+	} else {
+		assert.ErrorContains(t, err, "signal: killed")
+	}
+	assert.Assert(t, getStatus()["Pid"] == nil, "The volume process of the failed volume has been started again.")
+
+	// Naming the volume to be reset on plugin start does.
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	template := &pluginDriver{}
+	pluginDriver_SetTestVolumeProcess(t, template)
+	if driver, err = pluginDriver_NewWithOptions(propagatedMount, *logger, nil, template.GetVolumeProcess, template.SetVolumeProcessOptions, proc.RecoveryModeIgnore, nil, pluginDriverOptions{ResetFailedVolumes: []string{"test_unknown", volumeName}}); err != nil {
+		t.Fatal(err)
+	}
+	status = getStatus()
+	assert.Assert(t, status["Failure"] == nil && status["FailedAt"] == nil, "Failure = %v", status["Failure"])
+	assert.Assert(t, status["Pid"] != nil, "The volume process has not been started again.")
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_mount"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Unmount(&volume.UnmountRequest{Name: volumeName, ID: "test_mount"}); err != nil {
+		t.Error(err)
+	}
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
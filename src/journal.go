@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// region Package globals
+
+const (
+	DefaultJournalFileName = "volumes.log"
+	DefaultJournalFileMode = DefaultControlFileMode
+)
+
+var (
+	// Returned (wrapped) by journal.Replay() for the first record that
+	// cannot be applied, e.g. the remainder of an append interrupted by a
+	// crash.
+	errJournalInvalidRecord = errors.New("invalid record")
+)
+
+// region journalOp enum
+
+// The kind of mutation a journal record describes.
+type journalOp string
+
+const (
+	journalOpPut    journalOp = "put"
+	journalOpDelete journalOp = "delete"
+)
+
+// region journalRecord struct
+
+// A single mutation of the volume information, as appended to the journal.
+type journalRecord struct {
+	Op     journalOp
+	Name   string
+	Volume *pluginDriverVolume `json:",omitempty"`
+}
+
+// Applies the record to [volumes].
+func (r journalRecord) Apply(volumes map[string]pluginDriverVolume) error {
+	switch r.Op {
+	case journalOpPut:
+		if r.Volume == nil {
+			return fmt.Errorf("journal record for volume [%s] has no volume information", r.Name)
+		}
+		volumes[r.Name] = *r.Volume
+	case journalOpDelete:
+		delete(volumes, r.Name)
+	default:
+		return fmt.Errorf("journal record for volume [%s] has unknown operation [%s]", r.Name, r.Op)
+	}
+
+	return nil
+}
+
+// region journal struct
+
+// An append-only file of journal records, one JSON document per line.
+//
+// Every record is synced to disk before Append() returns, so a record that has
+// been appended successfully survives a crash. A record that has only partially
+// been written when crashing is discarded by Replay().
+type journal struct {
+	FileName string
+	file     *os.File
+	records  int
+}
+
+// Opens (or creates) the journal file [fileName].
+func journal_Open(fileName string) (*journal, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, DefaultJournalFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journal{FileName: fileName, file: file}, nil
+}
+
+// Applies all records from the journal to [volumes] and returns the number of
+// records applied.
+//
+// Replay stops at the first record that cannot be unmarshalled, which is
+// expected to be the remainder of an append interrupted by a crash. The journal
+// is truncated to the last valid record, and the error describing the invalid
+// record is returned along with the number of records applied so far.
+func (j *journal) Replay(volumes map[string]pluginDriverVolume) (int, error) {
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var (
+		offset int64
+		fail   error
+	)
+
+	j.records = 0
+	reader := bufio.NewReader(j.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			record := journalRecord{}
+			if err := json.Unmarshal(line, &record); err != nil {
+				fail = fmt.Errorf("%s: %w at offset %d: %w", j.FileName, errJournalInvalidRecord, offset, err)
+				break
+			}
+			if err := record.Apply(volumes); err != nil {
+				fail = fmt.Errorf("%s: %w at offset %d: %w", j.FileName, errJournalInvalidRecord, offset, err)
+				break
+			}
+			j.records++
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return j.records, err
+			}
+			break
+		}
+
+		offset += int64(len(line))
+	}
+
+	if fail != nil {
+		if err := j.file.Truncate(offset); err != nil {
+			return j.records, errors.Join(fail, err)
+		}
+		if err := j.file.Sync(); err != nil {
+			return j.records, errors.Join(fail, err)
+		}
+	}
+
+	return j.records, fail
+}
+
+// Appends [record] to the journal and syncs it to disk.
+func (j *journal) Append(record journalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+
+	j.records++
+	return nil
+}
+
+// Returns the number of records in the journal.
+func (j *journal) Len() int {
+	return j.records
+}
+
+// Discards all records, e.g. after they have been compacted into a snapshot.
+func (j *journal) Reset() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+
+	j.records = 0
+	return nil
+}
+
+// Closes the journal file.
+func (j *journal) Close() error {
+	return j.file.Close()
+}
+
+// Replays the journal [fileName] onto [volumes] if it exists, and returns the
+// number of records applied.
+//
+// This lets stores that don't use a journal themselves pick up mutations left
+// behind by a store that does.
+func journal_ReplayIfExists(fileName string, volumes map[string]pluginDriverVolume) (int, error) {
+	if _, err := os.Lstat(fileName); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	j, err := journal_Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := j.Replay(volumes)
+
+	return records, errors.Join(err, j.Close())
+}
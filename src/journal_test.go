@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func Test_journal(t *testing.T) {
+	journalFile := filepath.Join(t.TempDir(), DefaultJournalFileName)
+
+	j, err := journal_Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []journalRecord{
+		{Op: journalOpPut, Name: "test_volume1", Volume: &pluginDriverVolume{Path: "1"}},
+		{Op: journalOpPut, Name: "test_volume2", Volume: &pluginDriverVolume{Path: "2"}},
+		{Op: journalOpDelete, Name: "test_volume1"},
+	}
+	for _, record := range records {
+		if err := j.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Assert(t, j.Len() == len(records))
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate an append interrupted by a crash.
+	if file, err := os.OpenFile(journalFile, os.O_WRONLY|os.O_APPEND, DefaultJournalFileMode); err != nil {
+		t.Fatal(err)
+	} else {
+		if _, err := file.WriteString(`{"Op":"put","Name":"test_vol`); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	volumes := map[string]pluginDriverVolume{}
+	if applied, err := journal_ReplayIfExists(journalFile, volumes); err == nil {
+		t.Error("Replaying a torn journal succeeded unexpectedly.")
+	} else {
+		logger.Debug("Replaying a torn journal failed expectedly.", "err", err)
+		assert.Assert(t, errors.Is(err, errJournalInvalidRecord), err.Error())
+		assert.Assert(t, applied == len(records))
+	}
+	assert.Assert(t, len(volumes) == 1)
+	assert.Assert(t, volumes["test_volume2"].Path == "2")
+
+	volumes = map[string]pluginDriverVolume{}
+	if applied, err := journal_ReplayIfExists(journalFile, volumes); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, applied == len(records))
+	}
+
+	if applied, err := journal_ReplayIfExists(filepath.Join(t.TempDir(), DefaultJournalFileName), volumes); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, applied == 0)
+	}
+
+	for _, record := range []journalRecord{{Op: journalOpPut, Name: "test_volume"}, {Op: "unknown", Name: "test_volume"}} {
+		if err := record.Apply(volumes); err == nil {
+			t.Errorf("Applying invalid record %v succeeded unexpectedly.", record)
+		}
+	}
+}
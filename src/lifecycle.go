@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The name of the volume option selecting the volume process lifecycle (e.g.
+// `docker volume create -o lifecycle=mount ...`).
+const VolumeOptionLifecycle = "lifecycle"
+
+// region VolumeProcessLifecycle enum
+
+// When the volume process of a volume is running.
+type VolumeProcessLifecycle int
+
+const (
+	// The volume process is started when the volume is created and runs until
+	// the volume is removed.
+	VolumeProcessLifecycleVolume VolumeProcessLifecycle = iota
+	// The volume process is started when the first mount of the volume is
+	// registered and cancelled when the last one is unregistered.
+	VolumeProcessLifecycleMount
+)
+
+var volumeProcessLifecycleNames = map[VolumeProcessLifecycle]string{
+	VolumeProcessLifecycleVolume: "Volume",
+	VolumeProcessLifecycleMount:  "Mount",
+}
+
+func VolumeProcessLifecycleNames() map[VolumeProcessLifecycle]string {
+	return volumeProcessLifecycleNames
+}
+
+func (l VolumeProcessLifecycle) String() string {
+	if v, ok := volumeProcessLifecycleNames[l]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(l))
+	}
+}
+
+func VolumeProcessLifecycleParse(name string, defaultVolumeProcessLifecycle VolumeProcessLifecycle) VolumeProcessLifecycle {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultVolumeProcessLifecycle
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range volumeProcessLifecycleNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultVolumeProcessLifecycle
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func TestVolumeProcessLifecycle(t *testing.T) {
+	assert.Assert(t, len(VolumeProcessLifecycleNames()) == len(volumeProcessLifecycleNames))
+
+	tests := []struct {
+		name string
+		args string
+		want VolumeProcessLifecycle
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: VolumeProcessLifecycle(-1)},
+		{name: "Mixedcase", args: "\tMoUnT ", want: VolumeProcessLifecycleMount},
+		{name: "Unknown", args: "unknown", want: VolumeProcessLifecycle(-1)},
+		{name: "Default", args: "volume", want: VolumeProcessLifecycleVolume},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VolumeProcessLifecycleParse(tt.args, VolumeProcessLifecycle(-1)); got != tt.want {
+				t.Errorf("VolumeProcessLifecycleParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_Lifecycle(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	driver, err := pluginDriver_NewWithOptions(volumeFolder, *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{VolumeProcessLifecycle: VolumeProcessLifecycleMount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	assertRunning := func(volumeName string, running bool) string {
+		puid := driver.Volumes[volumeName].Puid
+		if !running {
+			assert.Assert(t, puid == "", "Volume [%s] has an unexpected volume process [%s].", volumeName, puid)
+			return puid
+		}
+
+		assert.Assert(t, puid != "", "Volume [%s] has no volume process.", volumeName)
+		if _, err := proc.GetProcessInfoFromUniqueId(puid); err != nil {
+			t.Errorf("Volume process of volume [%s] is not running (%s).", volumeName, err.Error())
+		}
+		return puid
+	}
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_invalid", Options: map[string]string{VolumeOptionLifecycle: "never"}}); err == nil {
+		t.Error("Creating a volume with an invalid lifecycle succeeded unexpectedly.")
+	}
+
+	// The volume option takes precedence over the driver default.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"c": "-v", VolumeOptionLifecycle: "volume"}}); err != nil {
+		t.Fatal(err)
+	}
+	puid := assertRunning("test_volume", true)
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proc.GetProcessInfoFromUniqueId(puid); err == nil {
+		t.Errorf("Volume process [%s] is still running after removing the volume.", puid)
+	}
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_mount", Options: map[string]string{"c": "-v"}}); err != nil {
+		t.Fatal(err)
+	}
+	assertRunning("test_mount", false)
+
+	for _, mountId := range []string{"test_id1", "test_id2", "test_id1"} {
+		if _, err := driver.Mount(&volume.MountRequest{Name: "test_mount", ID: mountId}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	puid = assertRunning("test_mount", true)
+
+	for _, mountId := range []string{"test_id1", "test_id2"} {
+		if err := driver.Unmount(&volume.UnmountRequest{Name: "test_mount", ID: mountId}); err != nil {
+			t.Fatal(err)
+		}
+		assert.Assert(t, assertRunning("test_mount", true) == puid)
+	}
+
+	if err := driver.Unmount(&volume.UnmountRequest{Name: "test_mount", ID: "test_id1"}); err != nil {
+		t.Fatal(err)
+	}
+	assertRunning("test_mount", false)
+	if _, err := proc.GetProcessInfoFromUniqueId(puid); err == nil {
+		t.Errorf("Volume process [%s] is still running after the last unmount.", puid)
+	}
+
+	// The process is started again on the next mount, and a restarted driver
+	// picks it up.
+	if _, err := driver.Mount(&volume.MountRequest{Name: "test_mount", ID: "test_id1"}); err != nil {
+		t.Fatal(err)
+	}
+	puid = assertRunning("test_mount", true)
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err = pluginDriver_NewWithOptions(volumeFolder, *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{VolumeProcessLifecycle: VolumeProcessLifecycleMount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, assertRunning("test_mount", true) == puid)
+
+	if err := driver.Unmount(&volume.UnmountRequest{Name: "test_mount", ID: "test_id1"}); err != nil {
+		t.Fatal(err)
+	}
+	assertRunning("test_mount", false)
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_mount"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thorbenw/docker-volume-plugin/proc"
+)
+
+const (
+	// The name of the volume option specifying the liveness probes of the
+	// volume process as a comma separated list of LivenessProbeKind names
+	// (e.g. `docker volume create -o liveness-probe=stat,state ...`).
+	VolumeOptionLivenessProbe = "liveness-probe"
+	// The name of the volume option specifying the command of the exec
+	// liveness probe, separated like volume process options (e.g.
+	// `docker volume create -o liveness-command=/usr/bin/mountpoint&-q&{mountPoint} ...`).
+	VolumeOptionLivenessCommand = "liveness-command"
+	// The name of the volume option specifying interval, timeout and failure
+	// threshold of the liveness probes (e.g. `docker volume create -o
+	// liveness-policy=interval=1m,failures=5 ...`).
+	VolumeOptionLivenessPolicy = "liveness-policy"
+	// The separator of LivenessProbeKind names.
+	LivenessProbeSeparator = ","
+)
+
+// region LivenessProbeKind enum
+
+// How to check whether a volume process is still alive although it didn't
+// terminate (see proc.LivenessProbe).
+type LivenessProbeKind int
+
+const (
+	// Stat the mount point with a timeout (see proc.StatProbe).
+	LivenessProbeKindStat LivenessProbeKind = iota
+	// Check that the volume process is neither a zombie nor waiting in
+	// uninterruptible disk sleep (see proc.StateProbe).
+	LivenessProbeKindState
+	// Run a command, which must exit with exit code 0 (see proc.ExecProbe).
+	LivenessProbeKindExec
+)
+
+var livenessProbeKindNames = map[LivenessProbeKind]string{
+	LivenessProbeKindStat:  "Stat",
+	LivenessProbeKindState: "State",
+	LivenessProbeKindExec:  "Exec",
+}
+
+func LivenessProbeKindNames() map[LivenessProbeKind]string {
+	return livenessProbeKindNames
+}
+
+func (k LivenessProbeKind) String() string {
+	if v, ok := livenessProbeKindNames[k]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(k))
+	}
+}
+
+func LivenessProbeKindParse(name string, defaultLivenessProbeKind LivenessProbeKind) LivenessProbeKind {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultLivenessProbeKind
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range livenessProbeKindNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultLivenessProbeKind
+}
+
+// Parses a comma separated list of LivenessProbeKind names, omitting empty
+// names and duplicates.
+func LivenessProbeKindsParse(names string) ([]LivenessProbeKind, error) {
+	kinds := []LivenessProbeKind{}
+	for _, name := range strings.Split(names, LivenessProbeSeparator) {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		invalidLivenessProbeKind := LivenessProbeKind(-1)
+		if kind := LivenessProbeKindParse(name, invalidLivenessProbeKind); kind == invalidLivenessProbeKind {
+			return nil, fmt.Errorf("liveness probe [%s] is not valid", name)
+		} else if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	return kinds, nil
+}
+
+// region Volume liveness
+
+// Returns the liveness policy of the volume process, or nil if it's liveness is
+// not to be probed.
+//
+// The probes are taken from the volume option VolumeOptionLivenessProbe, the
+// exec probe's command from the volume option VolumeOptionLivenessCommand and
+// the policy settings from the volume option VolumeOptionLivenessPolicy if
+// present, or from the driver otherwise.
+func (v *pluginDriverVolume) LivenessPolicy(d *pluginDriver) (*proc.LivenessPolicy, error) {
+	kinds := d.LivenessProbes
+	command := d.LivenessCommand
+	policy := d.LivenessPolicy
+	if policy.Interval == 0 && policy.Timeout == 0 && policy.FailureThreshold == 0 {
+		policy = proc.DefaultLivenessPolicy
+	}
+
+	if v.Options != nil {
+		if names, ok := (*v.Options)[VolumeOptionLivenessProbe]; ok {
+			var err error
+			if kinds, err = LivenessProbeKindsParse(names); err != nil {
+				return nil, err
+			}
+		}
+		if value, ok := (*v.Options)[VolumeOptionLivenessCommand]; ok {
+			command = value
+		}
+		if value, ok := (*v.Options)[VolumeOptionLivenessPolicy]; ok {
+			var err error
+			if policy, err = proc.LivenessPolicyParse(value, policy); err != nil {
+				return nil, fmt.Errorf("liveness policy [%s] is not valid: %w", value, err)
+			}
+		}
+	}
+
+	if len(kinds) < 1 {
+		return nil, nil
+	}
+
+	policy.Probes = []proc.LivenessProbe{}
+	for _, kind := range kinds {
+		switch kind {
+		case LivenessProbeKindStat:
+			policy.Probes = append(policy.Probes, &proc.StatProbe{Path: v.MountPoint()})
+		case LivenessProbeKindState:
+			policy.Probes = append(policy.Probes, &proc.StateProbe{})
+		case LivenessProbeKindExec:
+			argv := v.CommandLine(command)
+			if len(argv) < 1 {
+				return nil, fmt.Errorf("liveness probe %s requires a command", kind.String())
+			}
+
+			policy.Probes = append(policy.Probes, &proc.ExecProbe{Path: argv[0], Args: argv})
+		}
+	}
+
+	return &policy, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func TestLivenessProbeKind(t *testing.T) {
+	assert.Assert(t, len(LivenessProbeKindNames()) == len(livenessProbeKindNames))
+
+	tests := []struct {
+		name    string
+		args    string
+		want    []LivenessProbeKind
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: []LivenessProbeKind{}},
+		{name: "Mixedcase", args: "\tStAt ", want: []LivenessProbeKind{LivenessProbeKindStat}},
+		{name: "List", args: "exec, state,,exec", want: []LivenessProbeKind{LivenessProbeKindExec, LivenessProbeKindState}},
+		{name: "Unknown", args: "stat,unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LivenessProbeKindsParse(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LivenessProbeKindsParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.DeepEqual(t, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_LivenessPolicy(t *testing.T) {
+	vol := pluginDriverVolume{BasePath: "/var/lib/volumes", Path: "test"}
+	tests := []struct {
+		name       string
+		driver     pluginDriverOptions
+		options    map[string]string
+		wantProbes []string
+		wantPolicy string
+		wantErr    bool
+	}{
+		// Test cases.
+		{name: "None", wantProbes: nil},
+		{name: "Driver", driver: pluginDriverOptions{LivenessProbes: []LivenessProbeKind{LivenessProbeKindStat, LivenessProbeKindState}}, wantProbes: []string{"stat /var/lib/volumes/test", "state"}, wantPolicy: proc.DefaultLivenessPolicy.String()},
+		{name: "Volume", driver: pluginDriverOptions{LivenessProbes: []LivenessProbeKind{LivenessProbeKindStat}, LivenessPolicy: proc.LivenessPolicy{Interval: time.Minute, Timeout: time.Second, FailureThreshold: 1}}, options: map[string]string{VolumeOptionLivenessProbe: "exec", VolumeOptionLivenessCommand: "mountpoint & -q & {mountPoint}", VolumeOptionLivenessPolicy: "failures=2"}, wantProbes: []string{"exec mountpoint -q /var/lib/volumes/test"}, wantPolicy: "interval=1m0s,timeout=1s,failures=2"},
+		{name: "Disabled", driver: pluginDriverOptions{LivenessProbes: []LivenessProbeKind{LivenessProbeKindStat}}, options: map[string]string{VolumeOptionLivenessProbe: ""}, wantProbes: nil},
+		{name: "No command", options: map[string]string{VolumeOptionLivenessProbe: "exec"}, wantErr: true},
+		{name: "Invalid probe", options: map[string]string{VolumeOptionLivenessProbe: "ping"}, wantErr: true},
+		{name: "Invalid policy", options: map[string]string{VolumeOptionLivenessPolicy: "failures=0"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vol.Options = &tt.options
+			got, err := vol.LivenessPolicy(&pluginDriver{pluginDriverOptions: tt.driver})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LivenessPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantProbes == nil {
+				assert.Assert(t, got == nil, "LivenessPolicy() = %v", got)
+				return
+			}
+
+			probes := []string{}
+			for _, probe := range got.Probes {
+				probes = append(probes, probe.String())
+			}
+			assert.DeepEqual(t, probes, tt.wantProbes)
+			assert.Equal(t, got.String(), tt.wantPolicy)
+		})
+	}
+}
+
+func Test_pluginDriver_Liveness(t *testing.T) {
+	proc.Logger = logger
+
+	driver, err := pluginDriver_New(t.TempDir(), *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_invalid", Options: map[string]string{VolumeOptionLivenessProbe: "exec"}}); err == nil {
+		t.Error("Creating a volume with an exec liveness probe without command succeeded unexpectedly.")
+	}
+
+	volumeName := "test_volume"
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "restart", VolumeOptionLivenessProbe: "exec", VolumeOptionLivenessCommand: "/bin/false", VolumeOptionLivenessPolicy: "interval=200ms,timeout=100ms,failures=1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hanging volume process is killed and restarted.
+	var status map[string]interface{}
+	for i := 0; ; i++ {
+		res, err := driver.Get(&volume.GetRequest{Name: volumeName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status = res.Volume.Status; status["Restarts"] == uint(1) {
+			break
+		} else if i > 50 {
+			t.Fatalf("The volume process has not been restarted (%#v).", status)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Assert(t, status["LivenessKills"].(uint) >= 1, "LivenessKills = %v", status["LivenessKills"])
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// The folder in the propagated mount keeping the volume process log files.
+	// Starts with a dot, so it's never considered a volume folder.
+	DefaultVolumeLogFolder   = ".logs"
+	DefaultVolumeLogFileMode = 0o640
+	DefaultVolumeLogMaxSize  = 10 * 1024 * 1024
+	DefaultVolumeLogMaxFiles = 3
+	// How often volume process log files are checked for new lines to forward
+	// and for exceeding their maximum size.
+	DefaultVolumeLogInterval = time.Second
+	// Lines longer than this are forwarded in chunks.
+	volumeLogMaxLineLength = 64 * 1024
+)
+
+// Returns the log file of the volume process of the volume.
+func (v *pluginDriverVolume) LogFile(d *pluginDriver) string {
+	return filepath.Join(d.PropagatedMount, DefaultVolumeLogFolder, v.Path+".log")
+}
+
+// Opens the log file of the volume process of the volume for appending, which
+// is meant to be passed to the volume process as stdout and stderr.
+//
+// Since the file is opened with O_APPEND, the volume process keeps writing to
+// the end of the file after it has been truncated by volumeLog_Rotate().
+func (v *pluginDriverVolume) OpenLogFile(d *pluginDriver) (*os.File, error) {
+	name := v.LogFile(d)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, DefaultVolumeLogFileMode)
+}
+
+// Removes the log file of the volume process of the volume, including all
+// rotated ones.
+func (v *pluginDriverVolume) RemoveLogFiles(d *pluginDriver) error {
+	name := v.LogFile(d)
+	files, err := filepath.Glob(name + ".*")
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, file := range append(files, name) {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Rotates the log file [name] if it has grown larger than [maxSize] bytes, and
+// returns whether it did.
+//
+// The volume process keeps the log file open, so it cannot be renamed. Instead,
+// it's contents are copied to `[name].1` (after shifting up to [maxFiles]
+// rotated files by one), and then it is truncated. Lines written in between
+// are lost.
+func volumeLog_Rotate(name string, maxSize int64, maxFiles uint) (bool, error) {
+	if maxSize < 1 {
+		return false, nil
+	}
+	if fileInfo, err := os.Stat(name); err != nil || fileInfo.Size() <= maxSize {
+		return false, err
+	}
+
+	if maxFiles > 0 {
+		if err := os.Remove(fmt.Sprintf("%s.%d", name, maxFiles)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		for i := maxFiles - 1; i > 0; i-- {
+			if err := os.Rename(fmt.Sprintf("%s.%d", name, i), fmt.Sprintf("%s.%d", name, i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return false, err
+			}
+		}
+
+		if err := volumeLog_Copy(name, name+".1"); err != nil {
+			return false, err
+		}
+	}
+
+	return true, os.Truncate(name, 0)
+}
+
+func volumeLog_Copy(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, DefaultVolumeLogFileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.Join(err, out.Close())
+	}
+
+	return out.Close()
+}
+
+// Reads the complete lines written to the log file [name] since [offset] and
+// returns them along with the offset to continue reading at. If the file has
+// been truncated, reading starts over at the beginning.
+func volumeLog_ReadLines(name string, offset int64) ([]string, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, offset, err
+	}
+	if fileInfo.Size() < offset {
+		offset = 0
+	}
+	if fileInfo.Size() == offset {
+		return nil, offset, nil
+	}
+
+	buffer := make([]byte, min(fileInfo.Size()-offset, 1024*1024))
+	n, err := file.ReadAt(buffer, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, offset, err
+	}
+	buffer = buffer[:n]
+
+	lines := []string{}
+	for len(buffer) > 0 {
+		i := bytes.IndexByte(buffer, '\n')
+		if i < 0 && len(buffer) <= volumeLogMaxLineLength {
+			// Wait for the line to be completed.
+			break
+		} else if i < 0 || i > volumeLogMaxLineLength {
+			// Forward a chunk of the long line, which isn't followed by a
+			// separator to skip.
+			lines = append(lines, string(buffer[:volumeLogMaxLineLength]))
+			buffer = buffer[volumeLogMaxLineLength:]
+			offset += volumeLogMaxLineLength
+			continue
+		}
+
+		lines = append(lines, strings.TrimRight(string(buffer[:i]), "\r\n"))
+		buffer = buffer[i+1:]
+		offset += int64(i + 1)
+	}
+
+	return lines, offset, nil
+}
+
+// Forwards new lines of all volume process log files to the plugin's logger
+// (if options.VolumeLogForward is set) and rotates log files exceeding
+// options.VolumeLogMaxSize. [offsets] keeps track of the lines forwarded so
+// far, log files not in [offsets] yet are forwarded from their beginning.
+func (d pluginDriver) MaintainVolumeLogs(offsets map[string]int64) {
+	d.RWMutex.RLock()
+	files := map[string]string{}
+	for name, vol := range d.Volumes {
+		files[vol.LogFile(&d)] = name
+	}
+	d.RWMutex.RUnlock()
+
+	names := make([]string, 0, len(files))
+	for file := range files {
+		names = append(names, file)
+	}
+	slices.Sort(names)
+
+	for _, file := range names {
+		if d.VolumeLogForward {
+			lines, offset, err := volumeLog_ReadLines(file, offsets[file])
+			if err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					d.Logger.Warn("Reading the volume process log file failed.", "file", file, "err", err)
+				}
+				continue
+			}
+			for _, line := range lines {
+				d.Logger.Info(line, "volume", files[file])
+			}
+			offsets[file] = offset
+		}
+
+		if rotated, err := volumeLog_Rotate(file, int64(d.VolumeLogMaxSize), d.VolumeLogMaxFiles); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				d.Logger.Warn("Rotating the volume process log file failed.", "file", file, "err", err)
+			}
+		} else if rotated {
+			offsets[file] = 0
+			d.Logger.Debug("Rotated the volume process log file.", "file", file, "volume", files[file])
+		}
+	}
+
+	for file := range offsets {
+		if _, ok := files[file]; !ok {
+			delete(offsets, file)
+		}
+	}
+}
+
+// Calls MaintainVolumeLogs() every [interval] until the returned function is
+// called. Lines written to log files before are not forwarded.
+func (d pluginDriver) MaintainVolumeLogsPeriodically(interval time.Duration) (stop func()) {
+	if !d.VolumeLogs || interval <= 0 {
+		return func() {}
+	}
+
+	offsets := map[string]int64{}
+	d.RWMutex.RLock()
+	for _, vol := range d.Volumes {
+		if fileInfo, err := os.Stat(vol.LogFile(&d)); err == nil {
+			offsets[vol.LogFile(&d)] = fileInfo.Size()
+		}
+	}
+	d.RWMutex.RUnlock()
+
+	chStop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-chStop:
+				return
+			case <-ticker.C:
+				d.MaintainVolumeLogs(offsets)
+			}
+		}
+	}()
+
+	return func() {
+		close(chStop)
+		<-done
+	}
+}
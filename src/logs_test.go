@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/mount"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func Test_volumeLog_Rotate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.log")
+
+	if rotated, err := volumeLog_Rotate(name, 10, 2); err == nil || rotated {
+		t.Errorf("volumeLog_Rotate() = %v, %v, want error for missing file", rotated, err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("generation %d\n", i)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if rotated, err := volumeLog_Rotate(name, 100, 2); err != nil || rotated {
+			t.Fatalf("volumeLog_Rotate() = %v, %v, want no rotation below the maximum size", rotated, err)
+		}
+		if rotated, err := volumeLog_Rotate(name, 10, 2); err != nil || !rotated {
+			t.Fatalf("volumeLog_Rotate() = %v, %v, want rotation", rotated, err)
+		}
+	}
+
+	for file, want := range map[string]string{name: "", name + ".1": "generation 3\n", name + ".2": "generation 2\n"} {
+		if got, err := os.ReadFile(file); err != nil {
+			t.Error(err)
+		} else {
+			assert.Equal(t, string(got), want)
+		}
+	}
+	if _, err := os.Lstat(name + ".3"); err == nil {
+		t.Error("More rotated log files than configured have been kept.")
+	}
+
+	// Without rotated files to keep, the log file is just truncated.
+	if err := os.WriteFile(name, []byte("generation 4\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, err := volumeLog_Rotate(name, 10, 0); err != nil || !rotated {
+		t.Fatalf("volumeLog_Rotate() = %v, %v, want rotation", rotated, err)
+	}
+	if got, err := os.ReadFile(name + ".1"); err != nil || string(got) != "generation 3\n" {
+		t.Errorf("Rotated log file has been modified (%q, %v).", got, err)
+	}
+}
+
+func Test_volumeLog_ReadLines(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		offset     int64
+		want       []string
+		wantOffset int64
+	}{
+		// Test cases.
+		{name: "Empty", content: "", offset: 0, want: nil, wantOffset: 0},
+		{name: "Lines", content: "one\r\ntwo\n", offset: 0, want: []string{"one", "two"}, wantOffset: 9},
+		{name: "Offset", content: "one\ntwo\n", offset: 4, want: []string{"two"}, wantOffset: 8},
+		{name: "Partial", content: "one\ntw", offset: 0, want: []string{"one"}, wantOffset: 4},
+		{name: "Truncated", content: "one\n", offset: 10, want: []string{"one"}, wantOffset: 4},
+		{name: "Long", content: strings.Repeat("x", volumeLogMaxLineLength+1), offset: 0, want: []string{strings.Repeat("x", volumeLogMaxLineLength)}, wantOffset: volumeLogMaxLineLength},
+		{name: "Max", content: strings.Repeat("x", volumeLogMaxLineLength) + "\n", offset: 0, want: []string{strings.Repeat("x", volumeLogMaxLineLength)}, wantOffset: volumeLogMaxLineLength + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test.log")
+			if err := os.WriteFile(name, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, gotOffset, err := volumeLog_ReadLines(name, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) > 0 || len(tt.want) > 0 {
+				assert.DeepEqual(t, got, tt.want)
+			}
+			assert.Equal(t, gotOffset, tt.wantOffset)
+		})
+	}
+}
+
+func Test_volumeLog_ReadLines_Chunks(t *testing.T) {
+	line := strings.Repeat("0123456789", (2*volumeLogMaxLineLength)/10+7)
+	name := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(name, []byte(line+"\nnext\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, gotOffset, err := volumeLog_ReadLines(name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(got) == 4, "len(got) = %d", len(got))
+	for _, chunk := range got[:2] {
+		assert.Assert(t, len(chunk) == volumeLogMaxLineLength, "len(chunk) = %d", len(chunk))
+	}
+	assert.Equal(t, strings.Join(got[:3], ""), line)
+	assert.Equal(t, got[3], "next")
+	assert.Equal(t, gotOffset, int64(len(line)+len("\nnext\n")))
+}
+
+func Test_pluginDriver_VolumeLogs(t *testing.T) {
+	proc.Logger = logger
+
+	output := bytes.Buffer{}
+	driver, err := pluginDriver_NewWithOptions(t.TempDir(), *slog.New(slog.NewTextHandler(&output, nil)), nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{VolumeLogs: true, VolumeLogForward: true, VolumeLogMaxSize: 1024, VolumeLogMaxFiles: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.GetVolumeProcess = func() (*exec.Cmd, *proc.Options, *mount.Options) {
+		return exec.Command("/bin/sh", "-c", "echo to stdout; echo to stderr >&2; exec /bin/sleep 60"), nil, nil
+	}
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume"}); err != nil {
+		t.Fatal(err)
+	}
+	vol := driver.Volumes["test_volume"]
+	assert.Assert(t, vol.Puid != "")
+	logFile := vol.LogFile(driver)
+	assert.Assert(t, strings.HasPrefix(logFile, filepath.Join(driver.PropagatedMount, DefaultVolumeLogFolder)))
+
+	offsets := map[string]int64{}
+	for i := 0; !strings.Contains(output.String(), "to stderr"); i++ {
+		if i > 50 {
+			t.Fatalf("The volume process output has not been forwarded: %s", output.String())
+		}
+		time.Sleep(100 * time.Millisecond)
+		driver.MaintainVolumeLogs(offsets)
+	}
+	assert.Assert(t, strings.Contains(output.String(), `msg="to stdout" volume=test_volume`), output.String())
+
+	// The log file is rotated, and the volume process keeps writing to it.
+	if err := os.WriteFile(logFile, bytes.Repeat([]byte("x\n"), 1024), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	driver.MaintainVolumeLogs(offsets)
+	if fileInfo, err := os.Stat(logFile); err != nil || fileInfo.Size() != 0 {
+		t.Errorf("The log file has not been rotated (%v, %v).", fileInfo, err)
+	}
+	assert.Assert(t, offsets[logFile] == 0)
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{logFile, logFile + ".1"} {
+		if _, err := os.Lstat(file); err == nil {
+			t.Errorf("Log file [%s] has not been removed along with the volume.", file)
+		}
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"os/user"
+	"path/filepath"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/go-plugins-helpers/volume"
@@ -102,6 +107,18 @@ func flags_Bool(flags *flag.FlagSet, name string, usage string, value bool) (res
 	return
 }
 
+func flags_Duration(flags *flag.FlagSet, name string, usage string, value time.Duration) (result *time.Duration) {
+	result = flags.Duration(name, value, usage)
+
+	if env, ok := os_LookupEnv(name); ok {
+		if d, err := time.ParseDuration(env); err == nil {
+			*result = d
+		}
+	}
+
+	return
+}
+
 func flags_Uint(flags *flag.FlagSet, name string, usage string, value uint) (result *uint) {
 	result = flags.Uint(name, value, usage)
 
@@ -114,6 +131,40 @@ func flags_Uint(flags *flag.FlagSet, name string, usage string, value uint) (res
 	return
 }
 
+// Listens on the plugin socket [name] in DEFAULT_PLUGIN_SOCK_DIR, accessible by
+// root and members of the group [gid].
+//
+// This does the same as github.com/docker/go-plugins-helpers/sdk.Handler.ServeUnix(),
+// but returns the listener so it can be closed on shutdown.
+func unixSocket_Listen(name string, gid int) (net.Listener, string, error) {
+	path := filepath.Join(DEFAULT_PLUGIN_SOCK_DIR, name+".sock")
+
+	if err := os.MkdirAll(DEFAULT_PLUGIN_SOCK_DIR, 0o755); err != nil {
+		return nil, path, err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, path, err
+	}
+
+	mask := syscall.Umask(0o777)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, path, err
+	}
+
+	if err := os.Chown(path, 0, gid); err != nil {
+		listener.Close()
+		return nil, path, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		listener.Close()
+		return nil, path, err
+	}
+
+	return listener, path, nil
+}
+
 //go:test exclude
 func main() {
 	args := os.Args[1:] // w/o program name, which is in element 0
@@ -125,6 +176,15 @@ func entryPoint(arg0 string, args []string) (exitCode int) {
 	usageMsg := fmt.Sprintf("Usage: %s [OPTIONS]\n", arg0)
 	logLevelList := strings.Join(maps.Keys(logLevelStrings), " | ")
 	volumeProcessRecoveryModeList := strings.Join(utils.Select(maps.Values(proc.RecoveryModeNames()), strings.ToLower), " | ")
+	stateStoreList := strings.Join(utils.Select(maps.Values(StateStoreKindNames()), strings.ToLower), " | ")
+	scopeList := strings.Join(utils.Select(maps.Values(VolumeScopeNames()), strings.ToLower), " | ")
+	volumeProcessLifecycleList := strings.Join(utils.Select(maps.Values(VolumeProcessLifecycleNames()), strings.ToLower), " | ")
+	reconcileModeList := strings.Join(utils.Select(maps.Values(ReconcileModeNames()), strings.ToLower), " | ")
+	controlFileRecoveryList := strings.Join(utils.Select(maps.Values(ControlFileRecoveryNames()), strings.ToLower), " | ")
+	livenessProbeKindList := strings.Join(utils.Select(maps.Values(LivenessProbeKindNames()), strings.ToLower), " | ")
+	folderNamingList := strings.Join(utils.Select(maps.Values(FolderNamingNames()), strings.ToLower), " | ")
+	removePolicyList := strings.Join(utils.Select(maps.Values(RemovePolicyNames()), strings.ToLower), " | ")
+	shutdownPolicyList := strings.Join(utils.Select(maps.Values(ShutdownPolicyNames()), strings.ToLower), " | ")
 
 	var (
 		env string
@@ -150,10 +210,40 @@ func entryPoint(arg0 string, args []string) (exitCode int) {
 	logLevelString := flags_String(flags, "log-level", fmt.Sprintf("The log level (one out of %s).", logLevelList), "info")
 	logSource := flags_Bool(flags, "log-source", "Include the source code position in the log.", false)
 	propagatedMount := flags_String(flags, "propagated-mount", "Where to find the propagated mount.", "/data")
+	scopeString := flags_String(flags, "scope", fmt.Sprintf("The scope of the volumes (one out of %s). Use global for volumes referring to cluster wide data.", scopeList), strings.ToLower(VolumeScopeLocal.String()))
+	folderNamingString := flags_String(flags, "folder-naming", fmt.Sprintf("How to name the folders of new volumes in the propagated mount (one out of %s).", folderNamingList), strings.ToLower(FolderNamingHash.String()))
+	controlFileGenerations := flags_Uint(flags, "control-file-generations", "How many previous versions of the control file to keep as a fallback in case the current one cannot be loaded.", DefaultControlFileGenerations)
+	controlFileRecoveryString := flags_String(flags, "control-file-recovery", fmt.Sprintf("What to do if there is no control file or none of it's generations can be loaded (one out of %s). Use rebuild to recover volumes from the marker files in the volume folders.", controlFileRecoveryList), strings.ToLower(ControlFileRecoveryOff.String()))
+	stateStoreString := flags_String(flags, "state-store", fmt.Sprintf("How to persist volume information (one out of %s).", stateStoreList), strings.ToLower(StateStoreKindLog.String()))
+	stateStoreCompactionThreshold := flags_Uint(flags, "state-store-compaction-threshold", "How many journal records the log state store collects before compacting them into the control file (0 disables compaction by size).", DefaultJournalCompactionThreshold)
+	stateStoreCompactionInterval := flags_Duration(flags, "state-store-compaction-interval", "How often the log state store compacts it's journal into the control file (0 disables periodic compaction).", DefaultJournalCompactionInterval)
+	reconcileModeString := flags_String(flags, "reconcile-mode", fmt.Sprintf("What to do about drifts between the control file, the propagated mount folder and the volume processes (one out of %s). Use report for a dry run.", reconcileModeList), strings.ToLower(ReconcileModeReport.String()))
+	reconcileInterval := flags_Duration(flags, "reconcile-interval", "How often to look for drifts between the control file, the propagated mount folder and the volume processes (0 disables reconciliation).", DefaultReconcileInterval)
+	shutdownPolicyString := flags_String(flags, "shutdown-policy", fmt.Sprintf("What to do with running volume processes when the plugin shuts down (one out of %s). Use retain to have them picked up again on plugin restart.", shutdownPolicyList), strings.ToLower(ShutdownPolicyRetain.String()))
 
 	volumeProcessBinary := flags_String(flags, "volume-process-binary", "Executable file to run for each volume. Must be either an absolute file path or be within $PATH.", "")
-	volumeProcessRecoveryModeString := flags_String(flags, "volume-process-recovery-mode", fmt.Sprintf("How to behave if the volume process terminates unexpectedly (one out of %s).", volumeProcessRecoveryModeList), strings.ToLower(proc.RecoveryModeIgnore.String()))
-	volumeProcessRecoveryMaxPerMin := flags_Uint(flags, "volume-process-recovery-max-per-min", "How many times the volume process will be restarted before giving up.", 3)
+	volumeProcessRecoveryModeString := flags_String(flags, "volume-process-recovery-mode", fmt.Sprintf("How to behave if the volume process of volumes not specifying the volume option '%s' terminates unexpectedly (one out of %s).", VolumeOptionRecoveryMode, volumeProcessRecoveryModeList), strings.ToLower(proc.RecoveryModeIgnore.String()))
+	volumeProcessLifecycleString := flags_String(flags, "volume-process-lifecycle", fmt.Sprintf("When to run the volume process of volumes not specifying the volume option '%s' (one out of %s).", VolumeOptionLifecycle, volumeProcessLifecycleList), strings.ToLower(VolumeProcessLifecycleVolume.String()))
+	mountTimeout := flags_Duration(flags, "mount-timeout", fmt.Sprintf("How long to wait for the volume process to mount a file system at the mount point when mounting volumes not specifying the volume option '%s' (0 disables waiting).", VolumeOptionMountTimeout), 0)
+	mountLease := flags_Duration(flags, "mount-lease", "How long mounts stay registered without being mounted or unmounted again, e.g. after dockerd crashed (0 disables expiry).", 0)
+	forceRemove := flags_Bool(flags, "force-remove", fmt.Sprintf("Remove volumes not specifying the volume option '%s' even if they have active mounts.", VolumeOptionForceRemove), false)
+	removePolicyString := flags_String(flags, "remove-policy", fmt.Sprintf("What to do with the folders of volumes not specifying the volume option '%s' on removal (one out of %s).", VolumeOptionRemovePolicy, removePolicyList), strings.ToLower(RemovePolicyRefuse.String()))
+	volumeProcessLog := flags_Bool(flags, "volume-process-log", fmt.Sprintf("Write the output of each volume process to a log file in the '%s' folder of the propagated mount rather than to the plugin's output.", DefaultVolumeLogFolder), true)
+	volumeProcessLogMaxSize := flags_Uint(flags, "volume-process-log-max-size", "The size in bytes volume process log files are rotated at (0 disables rotation).", DefaultVolumeLogMaxSize)
+	volumeProcessLogMaxFiles := flags_Uint(flags, "volume-process-log-max-files", "How many rotated volume process log files to keep per volume.", DefaultVolumeLogMaxFiles)
+	volumeProcessLogForward := flags_Bool(flags, "volume-process-log-forward", "Forward lines written to volume process log files to the plugin's log, tagged with the volume name.", false)
+	volumeProcessRecoveryMaxPerMin := flags_Uint(flags, "volume-process-recovery-max-per-min", fmt.Sprintf("How many times the volume process of volumes not specifying the volume option '%s' will be restarted within a minute before giving up.", VolumeOptionRecoveryMaxPerMin), 3)
+	volumeProcessRecoveryBackoffString := flags_String(flags, "volume-process-recovery-backoff", fmt.Sprintf("How to delay restarts of volume processes not specifying the volume option '%s' with volume process recovery mode %s, as comma separated key=value pairs (%s, %s, %s, %s and %s).", VolumeOptionRecoveryBackoff, strings.ToLower(proc.RecoveryModeBackoff.String()), proc.BACKOFF_KEY_INITIAL_DELAY, proc.BACKOFF_KEY_MULTIPLIER, proc.BACKOFF_KEY_MAX_DELAY, proc.BACKOFF_KEY_JITTER, proc.BACKOFF_KEY_MAX_ATTEMPTS), proc.DefaultBackoffPolicy.String())
+	livenessProbeString := flags_String(flags, "liveness-probe", fmt.Sprintf("How to check whether volume processes of volumes not specifying the volume option '%s' hang, as a comma separated list (out of %s). Volume processes failing too often are killed and recovered like crashed ones.", VolumeOptionLivenessProbe, livenessProbeKindList), "")
+	livenessCommand := flags_String(flags, "liveness-command", fmt.Sprintf("Command line of the %s liveness probe of volumes not specifying the volume option '%s', separated by '%s'. Ocurrences of '%s' will be replaced with the mount point path.", strings.ToLower(LivenessProbeKindExec.String()), VolumeOptionLivenessCommand, VOLUME_PROCESS_OPTIONS_SEPARATOR, VOLUME_PROCESS_OPTIONS_MOUNTPOINT_PLACEHOLDER), "")
+	livenessPolicyString := flags_String(flags, "liveness-policy", fmt.Sprintf("How often and how long to probe the liveness of volume processes of volumes not specifying the volume option '%s', as comma separated key=value pairs (%s, %s and %s).", VolumeOptionLivenessPolicy, proc.LIVENESS_KEY_INTERVAL, proc.LIVENESS_KEY_TIMEOUT, proc.LIVENESS_KEY_FAILURE_THRESHOLD), proc.DefaultLivenessPolicy.String())
+	volumeProcessFailHook := flags_String(flags, "volume-process-fail-hook", fmt.Sprintf("Command line run when a volume process terminates with volume process recovery mode %s, separated by '%s'. Ocurrences of '%s' will be replaced with the mount point path, the volume is passed in the environment variables %s, %s, %s and %s.", strings.ToLower(proc.RecoveryModeFail.String()), VOLUME_PROCESS_OPTIONS_SEPARATOR, VOLUME_PROCESS_OPTIONS_MOUNTPOINT_PLACEHOLDER, FailHookEnvVolumeName, FailHookEnvMountPoint, FailHookEnvExitCode, FailHookEnvFailure), "")
+	resetFailedVolumes := flags_String(flags, "reset-failed-volumes", fmt.Sprintf("Comma separated names of volumes which have failed with volume process recovery mode %s, whose failure is reset on plugin start so they can be mounted again.", strings.ToLower(proc.RecoveryModeFail.String())), "")
+	volumeProcessUser := flags_String(flags, "volume-process-user", fmt.Sprintf("User (and group) volume processes of volumes not specifying the volume option '%s' run as, in the form user[:group] with names or numeric IDs (the plugin's user if empty).", VolumeOptionUser), "")
+	volumeProcessGroups := flags_String(flags, "volume-process-groups", fmt.Sprintf("Supplementary groups of volume processes of volumes not specifying the volume option '%s', as a comma separated list of names or numeric IDs (requires a volume process user).", VolumeOptionGroups), "")
+	volumeProcessCapabilities := flags_String(flags, "volume-process-capabilities", fmt.Sprintf("Ambient capabilities of volume processes of volumes not specifying the volume option '%s', as a comma separated list (e.g. cap_sys_admin).", VolumeOptionCapabilities), "")
+	volumeProcessNoNewPrivileges := flags_Bool(flags, "volume-process-no-new-privileges", fmt.Sprintf("Prevent volume processes of volumes not specifying the volume option '%s' from gaining privileges (e.g. by executing setuid binaries). Cannot be combined with a parent death signal.", VolumeOptionNoNewPrivileges), false)
+	volumeProcessParentDeathSignal := flags_String(flags, "volume-process-parent-death-signal", fmt.Sprintf("Signal volume processes of volumes not specifying the volume option '%s' receive if the plugin terminates, by name or number (e.g. term, none if empty).", VolumeOptionParentDeathSignal), "")
 	volumeProcessOptions := proc.NewOptions(5, VOLUME_PROCESS_OPTIONS_SEPARATOR, true)
 	env, ok = os_LookupEnv(VOLUME_PROCESS_OPTIONS_ENV)
 	if !ok || strings.TrimSpace(env) == "" {
@@ -228,6 +318,80 @@ func entryPoint(arg0 string, args []string) (exitCode int) {
 		}
 	}
 
+	volumeProcessRecoveryBackoff, err := proc.BackoffPolicyParse(*volumeProcessRecoveryBackoffString, proc.DefaultBackoffPolicy)
+	if err != nil {
+		errors = append(errors, fmt.Sprintf("Volume process recovery backoff [%s] is not valid (%s).", *volumeProcessRecoveryBackoffString, err.Error()))
+	}
+
+	livenessProbes, err := LivenessProbeKindsParse(*livenessProbeString)
+	if err != nil {
+		errors = append(errors, fmt.Sprintf("Liveness probes [%s] are not valid (use any out of %s).", *livenessProbeString, livenessProbeKindList))
+	} else if slices.Contains(livenessProbes, LivenessProbeKindExec) && strings.TrimSpace(*livenessCommand) == "" {
+		errors = append(errors, fmt.Sprintf("Liveness probe %s requires a liveness command.", strings.ToLower(LivenessProbeKindExec.String())))
+	}
+	livenessPolicy, err := proc.LivenessPolicyParse(*livenessPolicyString, proc.DefaultLivenessPolicy)
+	if err != nil {
+		errors = append(errors, fmt.Sprintf("Liveness policy [%s] is not valid (%s).", *livenessPolicyString, err.Error()))
+	}
+	volumeProcessAttributes, err := ProcessAttributesParse(map[string]string{
+		VolumeOptionUser:              *volumeProcessUser,
+		VolumeOptionGroups:            *volumeProcessGroups,
+		VolumeOptionCapabilities:      *volumeProcessCapabilities,
+		VolumeOptionNoNewPrivileges:   strconv.FormatBool(*volumeProcessNoNewPrivileges),
+		VolumeOptionParentDeathSignal: *volumeProcessParentDeathSignal,
+	}, proc.ProcessAttributes{})
+	if err != nil {
+		errors = append(errors, fmt.Sprintf("Volume process attributes are not valid (%s).", err.Error()))
+	}
+
+	var invalidVolumeScope = VolumeScope(-1)
+	var scope VolumeScope
+	if scope = VolumeScopeParse(*scopeString, invalidVolumeScope); scope == invalidVolumeScope {
+		errors = append(errors, fmt.Sprintf("Scope [%s] is not valid (use one out of %s).", *scopeString, scopeList))
+	}
+
+	var invalidVolumeProcessLifecycle = VolumeProcessLifecycle(-1)
+	var volumeProcessLifecycle VolumeProcessLifecycle
+	if volumeProcessLifecycle = VolumeProcessLifecycleParse(*volumeProcessLifecycleString, invalidVolumeProcessLifecycle); volumeProcessLifecycle == invalidVolumeProcessLifecycle {
+		errors = append(errors, fmt.Sprintf("Volume process lifecycle [%s] is not valid (use one out of %s).", *volumeProcessLifecycleString, volumeProcessLifecycleList))
+	}
+
+	var invalidControlFileRecovery = ControlFileRecovery(-1)
+	var controlFileRecovery ControlFileRecovery
+	if controlFileRecovery = ControlFileRecoveryParse(*controlFileRecoveryString, invalidControlFileRecovery); controlFileRecovery == invalidControlFileRecovery {
+		errors = append(errors, fmt.Sprintf("Control file recovery [%s] is not valid (use one out of %s).", *controlFileRecoveryString, controlFileRecoveryList))
+	}
+
+	var invalidFolderNaming = FolderNaming(-1)
+	var folderNaming FolderNaming
+	if folderNaming = FolderNamingParse(*folderNamingString, invalidFolderNaming); folderNaming == invalidFolderNaming {
+		errors = append(errors, fmt.Sprintf("Folder naming [%s] is not valid (use one out of %s).", *folderNamingString, folderNamingList))
+	}
+
+	var invalidRemovePolicy = RemovePolicy(-1)
+	var removePolicy RemovePolicy
+	if removePolicy = RemovePolicyParse(*removePolicyString, invalidRemovePolicy); removePolicy == invalidRemovePolicy {
+		errors = append(errors, fmt.Sprintf("Remove policy [%s] is not valid (use one out of %s).", *removePolicyString, removePolicyList))
+	}
+
+	var invalidReconcileMode = ReconcileMode(-1)
+	var reconcileMode ReconcileMode
+	if reconcileMode = ReconcileModeParse(*reconcileModeString, invalidReconcileMode); reconcileMode == invalidReconcileMode {
+		errors = append(errors, fmt.Sprintf("Reconcile mode [%s] is not valid (use one out of %s).", *reconcileModeString, reconcileModeList))
+	}
+
+	var invalidShutdownPolicy = ShutdownPolicy(-1)
+	var shutdownPolicy ShutdownPolicy
+	if shutdownPolicy = ShutdownPolicyParse(*shutdownPolicyString, invalidShutdownPolicy); shutdownPolicy == invalidShutdownPolicy {
+		errors = append(errors, fmt.Sprintf("Shutdown policy [%s] is not valid (use one out of %s).", *shutdownPolicyString, shutdownPolicyList))
+	}
+
+	var invalidStateStoreKind = StateStoreKind(-1)
+	var stateStoreKind StateStoreKind
+	if stateStoreKind = StateStoreKindParse(*stateStoreString, invalidStateStoreKind); stateStoreKind == invalidStateStoreKind {
+		errors = append(errors, fmt.Sprintf("State store [%s] is not valid (use one out of %s).", *stateStoreString, stateStoreList))
+	}
+
 	if l := len(errors); l > 0 {
 		fmt.Fprintf(os.Stderr, "%s found %d errors during parameter and configuration checks:\n", arg0, l)
 
@@ -250,43 +414,87 @@ func entryPoint(arg0 string, args []string) (exitCode int) {
 	logger.Info("Starting Docker Volume Plugin.", "version", version, "args", args)
 	proc.Logger = logger
 
-	driver, err := pluginDriver_New(*propagatedMount, *logger)
-	if err == nil {
-		if strings.TrimSpace(*volumeProcessBinary) != "" {
-			if binaryPath, err := exec.LookPath(*volumeProcessBinary); err != nil {
-				logger.Error(err.Error())
-				return EXIT_CODE_ERROR
-			} else {
-				driver.GetVolumeProcess = func() (*exec.Cmd, *proc.Options, *mount.Options) {
-					return exec.Command(binaryPath), &volumeProcessOptions, &mountOptions
+	var (
+		getVolumeProcess        GetVolumeProcess
+		setVolumeProcessOptions SetVolumeProcessOptions
+	)
+	if strings.TrimSpace(*volumeProcessBinary) != "" {
+		if binaryPath, err := exec.LookPath(*volumeProcessBinary); err != nil {
+			logger.Error(err.Error())
+			return EXIT_CODE_ERROR
+		} else {
+			getVolumeProcess = func() (*exec.Cmd, *proc.Options, *mount.Options) {
+				return exec.Command(binaryPath), &volumeProcessOptions, &mountOptions
+			}
+			setVolumeProcessOptions = func(cmd *exec.Cmd, vpOpt *proc.Options, mOpt *mount.Options, mountPoint string) error {
+				if vpOpt != nil && vpOpt.Len() > 0 {
+					lvpOpt := utils.Select(vpOpt.Slice(), func(str string) string {
+						return strings.ReplaceAll(str, VOLUME_PROCESS_OPTIONS_MOUNTPOINT_PLACEHOLDER, mountPoint)
+					})
+					cmd.Args = append(cmd.Args, lvpOpt...)
 				}
-				driver.SetVolumeProcessOptions = func(cmd *exec.Cmd, vpOpt *proc.Options, mOpt *mount.Options, mountPoint string) error {
-					if vpOpt != nil && vpOpt.Len() > 0 {
-						lvpOpt := utils.Select(vpOpt.Slice(), func(str string) string {
-							return strings.ReplaceAll(str, VOLUME_PROCESS_OPTIONS_MOUNTPOINT_PLACEHOLDER, mountPoint)
-						})
-						cmd.Args = append(cmd.Args, lvpOpt...)
-					}
 
-					if mOpt != nil && mOpt.Len() > 0 {
-						*mountOptionsVolumeProcessOptions = strings.TrimSpace(*mountOptionsVolumeProcessOptions)
-						if *mountOptionsVolumeProcessOptions != "" {
-							cmd.Args = append(cmd.Args, *mountOptionsVolumeProcessOptions)
-						}
-						cmd.Args = append(cmd.Args, mOpt.String())
+				if mOpt != nil && mOpt.Len() > 0 {
+					*mountOptionsVolumeProcessOptions = strings.TrimSpace(*mountOptionsVolumeProcessOptions)
+					if *mountOptionsVolumeProcessOptions != "" {
+						cmd.Args = append(cmd.Args, *mountOptionsVolumeProcessOptions)
 					}
-
-					return nil
+					cmd.Args = append(cmd.Args, mOpt.String())
 				}
+
+				return nil
 			}
 		}
-		driver.VolumeProcessRecoveryMode = volumeProcessRecoveryMode
-		driver.VolumeProcessRecoveryRateLimit = &metric.MetricRateLimit{Limit: *volumeProcessRecoveryMaxPerMin, Duration: time.Minute}
+	}
+
+	store, err := stateStore_New(stateStoreKind, *propagatedMount, *controlFileGenerations, *stateStoreCompactionThreshold, *stateStoreCompactionInterval, *logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return EXIT_CODE_ERROR
+	}
+	logger.Debug(fmt.Sprintf("Created state store %T.", store), "store", store)
+
+	volumeProcessRecoveryRateLimit := &metric.MetricRateLimit{Limit: *volumeProcessRecoveryMaxPerMin, Duration: time.Minute}
+	driverOptions := pluginDriverOptions{
+		VolumeProcessLifecycle:       volumeProcessLifecycle,
+		MountTimeout:                 *mountTimeout,
+		Scope:                        scope,
+		MountLease:                   *mountLease,
+		ForceRemove:                  *forceRemove,
+		RemovePolicy:                 removePolicy,
+		FolderNaming:                 folderNaming,
+		ControlFileRecovery:          controlFileRecovery,
+		VolumeLogs:                   *volumeProcessLog,
+		VolumeLogMaxSize:             *volumeProcessLogMaxSize,
+		VolumeLogMaxFiles:            *volumeProcessLogMaxFiles,
+		VolumeLogForward:             *volumeProcessLogForward,
+		VolumeProcessRecoveryBackoff: volumeProcessRecoveryBackoff,
+		LivenessProbes:               livenessProbes,
+		LivenessCommand:              *livenessCommand,
+		LivenessPolicy:               livenessPolicy,
+		VolumeProcessAttributes:      volumeProcessAttributes,
+		FailHook:                     *volumeProcessFailHook,
+		ResetFailedVolumes:           utils.Select(strings.FieldsFunc(*resetFailedVolumes, func(r rune) bool { return r == ',' }), strings.TrimSpace),
+	}
+	driver, err := pluginDriver_NewWithOptions(*propagatedMount, *logger, store, getVolumeProcess, setVolumeProcessOptions, volumeProcessRecoveryMode, volumeProcessRecoveryRateLimit, driverOptions)
+	if err == nil {
 		logger.Debug(fmt.Sprintf("Created driver %T.", driver), "driver", driver)
 	} else {
 		logger.Error(err.Error())
 		return EXIT_CODE_ERROR
 	}
+	defer func() {
+		if err := driver.Shutdown(shutdownPolicy); err != nil {
+			logger.Error("Shutting down the driver failed.", "err", err)
+			exitCode = EXIT_CODE_ERROR
+		}
+	}()
+	// Deferred after Shutdown() in order to have reconciliation and log
+	// maintenance stopped first.
+	stopReconciling := driver.ReconcilePeriodically(*reconcileInterval, reconcileMode)
+	defer stopReconciling()
+	stopMaintainingVolumeLogs := driver.MaintainVolumeLogsPeriodically(DefaultVolumeLogInterval)
+	defer stopMaintainingVolumeLogs()
 
 	handler := volume.NewHandler(*driver)
 	logger.Debug(fmt.Sprintf("Created handler %T.", handler), "handler", handler)
@@ -307,8 +515,33 @@ func entryPoint(arg0 string, args []string) (exitCode int) {
 		return EXIT_CODE_ERROR
 	}
 
-	if err := handler.ServeUnix("plugin", gid); err != nil {
-		logger.Error(fmt.Sprintf("Calling %T.ServeUnix() failed.", handler), "err", err)
+	listener, socket, err := unixSocket_Listen("plugin", gid)
+	if err == nil {
+		logger.Debug(fmt.Sprintf("Listening on %s.", socket), "listener", listener)
+	} else {
+		logger.Error("Listening on plugin socket failed.", "socket", socket, "err", err)
+		return EXIT_CODE_ERROR
+	}
+	defer os.Remove(socket)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- handler.Serve(listener)
+	}()
+
+	select {
+	case sig := <-signals:
+		// Stop accepting requests, Shutdown() (deferred above) waits for those
+		// in progress.
+		logger.Info("Received signal, shutting down.", "signal", sig.String())
+		listener.Close()
+		<-served
+	case err := <-served:
+		logger.Error(fmt.Sprintf("Calling %T.Serve() failed.", handler), "err", err)
 		return EXIT_CODE_ERROR
 	}
 
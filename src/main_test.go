@@ -31,6 +31,19 @@ func Test_entryPoint(t *testing.T) {
 	testEntryPoint([]string{"--build-info"}, EXIT_CODE_OK)
 	testEntryPoint([]string{"--log-level=test", "--volume-process-recovery-mode=test", "--volume-process-recovery-max-per-min=0"}, EXIT_CODE_PARAM)
 	testEntryPoint([]string{"--log-level=test", "--volume-process-recovery-mode=restart", "--volume-process-recovery-max-per-min=0"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--volume-process-recovery-mode=backoff", "--volume-process-recovery-backoff=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--liveness-probe=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--liveness-policy=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--shutdown-policy=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--reconcile-mode=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--remove-policy=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--folder-naming=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--control-file-recovery=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--volume-process-user=no-such-user"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--volume-process-groups=0"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--volume-process-capabilities=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--volume-process-parent-death-signal=test"}, EXIT_CODE_PARAM)
+	testEntryPoint([]string{"--volume-process-no-new-privileges", "--volume-process-parent-death-signal=term"}, EXIT_CODE_PARAM)
 	testEntryPoint([]string{"--log-level=debug", fmt.Sprintf("--propagated-mount=%s", testFile)}, EXIT_CODE_PARAM)
 
 	t.Setenv("LOG_SOURCE", "true")
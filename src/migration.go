@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/thorbenw/docker-volume-plugin/semver"
+	"github.com/thorbenw/docker-volume-plugin/utils"
+)
+
+const (
+	// The schema version of control files written by this plugin.
+	//
+	// Whenever the persisted layout (e.g. pluginDriverVolume) changes in a way
+	// older documents cannot be unmarshalled to anymore, bump this version and
+	// register a migration from the previous version in controlFileMigrations.
+	ControlFileVersion = "1.0.0"
+	// The version assumed for control files lacking a version marker, i.e.
+	// those written before the control file envelope was introduced.
+	ControlFileVersionLegacy = "0.0.0"
+)
+
+// region pluginDriverControlFile struct
+
+// The envelope of the control file document.
+type pluginDriverControlFile struct {
+	Version semver.VersionInfo
+	Volumes map[string]pluginDriverVolume
+	// The version the document has been migrated from while loading, or nil if
+	// it didn't need any migration.
+	migratedFrom *semver.VersionInfo
+}
+
+// region pluginDriverMigration struct
+
+// Upgrades a raw control file document from schema version From to schema
+// version To.
+type pluginDriverMigration struct {
+	From    string
+	To      string
+	Migrate func(document []byte) ([]byte, error)
+}
+
+// The registry of control file migrations, which are applied by
+// pluginDriver_Migrate() in a chain until ControlFileVersion is reached.
+var controlFileMigrations = []pluginDriverMigration{
+	{From: ControlFileVersionLegacy, To: "1.0.0", Migrate: pluginDriver_Migrate_0_0_0},
+}
+
+// Wraps the bare map of volumes used before versioning was introduced into the
+// control file envelope.
+func pluginDriver_Migrate_0_0_0(document []byte) ([]byte, error) {
+	volumes := map[string]json.RawMessage{}
+	if err := json.Unmarshal(document, &volumes); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		Version string
+		Volumes map[string]json.RawMessage
+	}{Version: "1.0.0", Volumes: volumes})
+}
+
+// Determines the schema version of a raw control file document.
+//
+// Documents lacking a version marker are considered to be of version
+// ControlFileVersionLegacy. Since legacy documents are a bare map of volume
+// names, a volume named `Version` is told apart from the envelope's version
+// marker by it's type, which is an object rather than a string.
+func pluginDriver_DocumentVersion(document []byte) (*semver.VersionInfo, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(document, &fields); err != nil {
+		return nil, err
+	}
+
+	var version string
+	if raw, ok := fields["Version"]; !ok || json.Unmarshal(raw, &version) != nil {
+		version = ControlFileVersionLegacy
+	}
+
+	return semver.Parse(version)
+}
+
+// Runs all migrations registered in controlFileMigrations required to upgrade
+// the raw control file [document] to ControlFileVersion.
+//
+// Returns the upgraded document and the version it has been migrated from, or
+// the unmodified document and nil if no migration was necessary.
+func pluginDriver_Migrate(document []byte) (migrated []byte, migratedFrom *semver.VersionInfo, fail error) {
+	current, err := semver.Parse(ControlFileVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version, err := pluginDriver_DocumentVersion(document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c := semver.Compare(*version, *current); c == 0 {
+		return document, nil, nil
+	} else if c > 0 {
+		return nil, nil, fmt.Errorf("control file version %s is newer than the supported version %s", version, current)
+	}
+
+	migrated, migratedFrom = document, version
+	for semver.Compare(*version, *current) < 0 {
+		var migration *pluginDriverMigration
+		for i := range controlFileMigrations {
+			if from, err := semver.Parse(controlFileMigrations[i].From); err == nil && semver.Compare(*from, *version) == 0 {
+				migration = &controlFileMigrations[i]
+				break
+			}
+		}
+		if migration == nil {
+			return nil, nil, fmt.Errorf("there is no migration for control file version %s", version)
+		}
+
+		if migrated, err = migration.Migrate(migrated); err != nil {
+			return nil, nil, fmt.Errorf("migrating control file from version %s to %s failed: %w", migration.From, migration.To, err)
+		}
+
+		if version, err = semver.Parse(migration.To); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return
+}
+
+// Returns the file name of the backup taken of the control file [fileName]
+// before migrating it from [version].
+func pluginDriver_MigrationBackup(fileName string, version semver.VersionInfo) string {
+	return fmt.Sprintf("%s.v%s.bak", fileName, version)
+}
+
+// Writes the raw control file [document] of [version] to it's migration backup
+// file, unless a backup for that version already exists.
+func pluginDriver_WriteMigrationBackup(fileName string, version semver.VersionInfo, document []byte) error {
+	backup := pluginDriver_MigrationBackup(fileName, version)
+	if _, err := os.Lstat(backup); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return utils.WriteFileAtomic(backup, document, DefaultControlFileMode)
+}
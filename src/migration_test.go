@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func Test_pluginDriver_Migrate(t *testing.T) {
+	tests := []struct {
+		name             string
+		document         string
+		wantMigratedFrom string
+		wantVolumes      int
+		wantErr          bool
+	}{
+		// Test cases.
+		{name: "Current", document: `{"Version": "` + ControlFileVersion + `", "Volumes": {"test_volume": {}}}`, wantVolumes: 1},
+		{name: "Legacy", document: `{"test_volume1": {}, "test_volume2": {}}`, wantMigratedFrom: ControlFileVersionLegacy, wantVolumes: 2},
+		{name: "Legacy named Version", document: `{"Version": {"Path": "test"}}`, wantMigratedFrom: ControlFileVersionLegacy, wantVolumes: 1},
+		{name: "Legacy empty", document: `{}`, wantMigratedFrom: ControlFileVersionLegacy},
+		{name: "Newer", document: `{"Version": "999.0.0", "Volumes": {}}`, wantErr: true},
+		{name: "Unknown", document: `{"Version": "0.1.0", "Volumes": {}}`, wantErr: true},
+		{name: "Invalid version", document: `{"Version": "invalid", "Volumes": {}}`, wantErr: true},
+		{name: "Invalid", document: `[]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrated, migratedFrom, err := pluginDriver_Migrate([]byte(tt.document))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("pluginDriver_Migrate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			} else if err != nil {
+				logger.Debug("pluginDriver_Migrate() failed expectedly.", "err", err)
+				return
+			}
+
+			if tt.wantMigratedFrom == "" {
+				assert.Assert(t, migratedFrom == nil)
+			} else {
+				assert.Assert(t, migratedFrom != nil && migratedFrom.String() == tt.wantMigratedFrom)
+			}
+
+			if version, err := pluginDriver_DocumentVersion(migrated); err != nil {
+				t.Error(err)
+			} else {
+				assert.Assert(t, version.String() == ControlFileVersion)
+			}
+
+			testFileName := filepath.Join(t.TempDir(), DefaultControlFileName)
+			if err := os.WriteFile(testFileName, []byte(tt.document), DefaultControlFileMode); err != nil {
+				t.Fatal(err)
+			}
+			if controlFile, _, err := pluginDriver_Load(testFileName); err != nil {
+				t.Error(err)
+			} else {
+				assert.Assert(t, len(controlFile.Volumes) == tt.wantVolumes)
+
+				if migratedFrom != nil {
+					assert.Assert(t, controlFile.migratedFrom != nil)
+					if backup, err := os.ReadFile(pluginDriver_MigrationBackup(testFileName, *migratedFrom)); err != nil {
+						t.Error(err)
+					} else {
+						assert.Assert(t, string(backup) == tt.document)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_New_Migrate(t *testing.T) {
+	propagatedMount := t.TempDir()
+	volumePath := "test_volume"
+	if err := os.Mkdir(filepath.Join(propagatedMount, volumePath), DefaultVolumeFolderMode); err != nil {
+		t.Fatal(err)
+	}
+
+	testFileName := filepath.Join(propagatedMount, DefaultControlFileName)
+	document := `{"test_volume": {"BasePath": "` + propagatedMount + `", "Path": "` + volumePath + `", "Mounts": {}}}`
+	if err := os.WriteFile(testFileName, []byte(document), DefaultControlFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := pluginDriver_New(propagatedMount, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(driver.Volumes) == 1)
+
+	if controlFile, loadedFrom, err := pluginDriver_Load(testFileName); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, loadedFrom == testFileName)
+		assert.Assert(t, controlFile.migratedFrom == nil)
+		assert.Assert(t, controlFile.Version.String() == ControlFileVersion)
+		assert.Assert(t, len(controlFile.Volumes) == 1)
+	}
+}
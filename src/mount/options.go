@@ -171,3 +171,16 @@ func (o Options) Len() int {
 
 	return result
 }
+
+// Returns a deep copy of the options, so the copy can be modified without
+// affecting the original.
+func (o Options) Clone() Options {
+	var options []Option
+	if o.options != nil {
+		options = slices.Clone(*o.options)
+	} else {
+		options = []Option{}
+	}
+
+	return Options{options: &options}
+}
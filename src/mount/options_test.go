@@ -95,3 +95,22 @@ func TestOptionsString(t *testing.T) {
 		})
 	}
 }
+
+func TestOptions_Clone(t *testing.T) {
+	o := NewOptions(2)
+	if err := o.Set("a=1,b"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := o.Clone()
+	if err := c.Set("a=2,b=-,c"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, o.String() == "a=1,b")
+	assert.Assert(t, c.String() == "a=2,c")
+
+	c = Options{}.Clone()
+	if err := c.Set("a"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thorbenw/docker-volume-plugin/utils"
+)
+
+const (
+	// The folder in the propagated mount keeping a marker file per volume
+	// folder, which identifies the volume the folder belongs to. The markers
+	// are kept outside the volume folders, since they contain the volume
+	// options (which may include credentials) and containers must not be able
+	// to tamper with them. Starts with a dot, so it's never considered a volume
+	// folder.
+	VolumeMarkerFolderName = ".markers"
+	VolumeMarkerFolderMode = 0o700
+	VolumeMarkerFileMode   = 0o600
+	// The number of hex digits of the hash appended to the name of volume
+	// folders with FolderNamingNameHash.
+	FolderNameHashLength = 8
+	// The maximum length of sanitized volume names in folder names, which keeps
+	// them well below the usual file name limit of 255 bytes.
+	FolderNameMaxLength = 200
+)
+
+// region FolderNaming enum
+
+// How the folders of new volumes are named.
+type FolderNaming int
+
+const (
+	// The SHA256 hash of the volume name.
+	FolderNamingHash FolderNaming = iota
+	// The sanitized volume name.
+	FolderNamingName
+	// The sanitized volume name followed by a short hash of the volume name,
+	// which keeps volume names distinct that sanitize to the same name.
+	FolderNamingNameHash
+)
+
+var folderNamingNames = map[FolderNaming]string{
+	FolderNamingHash:     "Hash",
+	FolderNamingName:     "Name",
+	FolderNamingNameHash: "Name-Hash",
+}
+
+func FolderNamingNames() map[FolderNaming]string {
+	return folderNamingNames
+}
+
+func (n FolderNaming) String() string {
+	if v, ok := folderNamingNames[n]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(n))
+	}
+}
+
+func FolderNamingParse(name string, defaultFolderNaming FolderNaming) FolderNaming {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultFolderNaming
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range folderNamingNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultFolderNaming
+}
+
+// Returns [name] with all characters but letters, digits, `_`, `-` and `.`
+// replaced by `_`. A leading dot is replaced as well, so the result is neither
+// hidden (see pluginDriver.Reconcile()) nor `.` or `..`.
+func folderNaming_Sanitize(name string) string {
+	result := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if len(result) > FolderNameMaxLength {
+		result = result[:FolderNameMaxLength]
+	}
+
+	if result == "" {
+		return "_"
+	} else if strings.HasPrefix(result, ".") {
+		return "_" + result[1:]
+	}
+
+	return result
+}
+
+// Returns the name of the folder for the volume [name] with [naming].
+func folderNaming_FolderName(naming FolderNaming, name string) string {
+	hash := utils.SHA256StringToString(name)
+
+	switch naming {
+	case FolderNamingName:
+		return folderNaming_Sanitize(name)
+	case FolderNamingNameHash:
+		return folderNaming_Sanitize(name) + "-" + hash[:FolderNameHashLength]
+	default:
+		return hash
+	}
+}
+
+// region pluginDriverVolumeMarker struct
+
+// The contents of the marker file of a volume folder (see
+// pluginDriverVolumeMarker_File()).
+type pluginDriverVolumeMarker struct {
+	Name          string
+	CreatedAt     time.Time
+	Options       map[string]string
+	PluginVersion string
+	// When the volume has been removed with RemovePolicyRetain, if it has.
+	RemovedAt *time.Time `json:",omitempty"`
+}
+
+// Returns the marker file of the volume folder [folder].
+func pluginDriverVolumeMarker_File(folder string) string {
+	return filepath.Join(filepath.Dir(folder), VolumeMarkerFolderName, filepath.Base(folder)+".json")
+}
+
+// Reads the marker file of the volume folder [folder].
+func pluginDriverVolumeMarker_Read(folder string) (*pluginDriverVolumeMarker, error) {
+	bytes, err := os.ReadFile(pluginDriverVolumeMarker_File(folder))
+	if err != nil {
+		return nil, err
+	}
+
+	marker := pluginDriverVolumeMarker{}
+	if err := json.Unmarshal(bytes, &marker); err != nil {
+		return nil, err
+	}
+
+	return &marker, nil
+}
+
+// Removes the marker file of the volume folder [folder], if any.
+func pluginDriverVolumeMarker_Remove(folder string) error {
+	if err := os.Remove(pluginDriverVolumeMarker_File(folder)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Writes the marker file of the volume folder [folder] atomically, since it is
+// trusted when rebuilding the control file (see pluginDriver_Rebuild()).
+func (m pluginDriverVolumeMarker) Write(folder string) error {
+	bytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := pluginDriverVolumeMarker_File(folder)
+	if err := os.MkdirAll(filepath.Dir(name), VolumeMarkerFolderMode); err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(name, bytes, VolumeMarkerFileMode)
+}
+
+// Returns a marker for the volume [name].
+func (v *pluginDriverVolume) Marker(name string) pluginDriverVolumeMarker {
+	marker := pluginDriverVolumeMarker{Name: name, CreatedAt: v.CreatedAt, Options: map[string]string{}, PluginVersion: version}
+	if v.Options != nil {
+		for k, val := range *v.Options {
+			marker.Options[k] = val
+		}
+	}
+
+	return marker
+}
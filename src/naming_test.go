@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"github.com/thorbenw/docker-volume-plugin/utils"
+	"gotest.tools/assert"
+)
+
+func TestFolderNaming(t *testing.T) {
+	assert.Assert(t, len(FolderNamingNames()) == len(folderNamingNames))
+
+	tests := []struct {
+		name string
+		args string
+		want FolderNaming
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: FolderNaming(-1)},
+		{name: "Mixedcase", args: "\tNaMe ", want: FolderNamingName},
+		{name: "Dash", args: "name-hash", want: FolderNamingNameHash},
+		{name: "Unknown", args: "unknown", want: FolderNaming(-1)},
+		{name: "Default", args: "hash", want: FolderNamingHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FolderNamingParse(tt.args, FolderNaming(-1)); got != tt.want {
+				t.Errorf("FolderNamingParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_folderNaming_FolderName(t *testing.T) {
+	type args struct {
+		naming FolderNaming
+		name   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// Test cases.
+		{name: "Hash", args: args{naming: FolderNamingHash, name: "my_volume"}, want: utils.SHA256StringToString("my_volume")},
+		{name: "Name", args: args{naming: FolderNamingName, name: "my_volume-1.0"}, want: "my_volume-1.0"},
+		{name: "Sanitized", args: args{naming: FolderNamingName, name: "my volume/ä"}, want: "my_volume__"},
+		{name: "Dot", args: args{naming: FolderNamingName, name: ".hidden"}, want: "_hidden"},
+		{name: "Dots", args: args{naming: FolderNamingName, name: ".."}, want: "_."},
+		{name: "Empty", args: args{naming: FolderNamingName, name: ""}, want: "_"},
+		{name: "Long", args: args{naming: FolderNamingName, name: strings.Repeat("x", 300)}, want: strings.Repeat("x", FolderNameMaxLength)},
+		{name: "NameHash", args: args{naming: FolderNamingNameHash, name: "my volume"}, want: "my_volume-" + utils.SHA256StringToString("my volume")[:FolderNameHashLength]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := folderNaming_FolderName(tt.args.naming, tt.args.name); got != tt.want {
+				t.Errorf("folderNaming_FolderName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_FolderNaming(t *testing.T) {
+	proc.Logger = logger
+
+	for _, scope := range []VolumeScope{VolumeScopeLocal, VolumeScopeGlobal} {
+		t.Run(scope.String(), func(t *testing.T) {
+			volumeFolder := t.TempDir()
+			driver, err := pluginDriver_NewWithOptions(volumeFolder, *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{FolderNaming: FolderNamingName, Scope: scope})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := driver.Create(&volume.CreateRequest{Name: "my volume", Options: map[string]string{"o": "ro"}}); err != nil {
+				t.Fatal(err)
+			}
+			mountPoint := filepath.Join(volumeFolder, "my_volume")
+			assert.Assert(t, driver.Volumes["my volume"].Path == "my_volume")
+			marker, err := pluginDriverVolumeMarker_Read(mountPoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Assert(t, marker.Name == "my volume" && marker.CreatedAt.Equal(driver.Volumes["my volume"].CreatedAt) && marker.RemovedAt == nil)
+			assert.DeepEqual(t, marker.Options, map[string]string{"o": "ro"})
+
+			// The marker file is kept private and outside the volume folder.
+			markerFile := filepath.Join(volumeFolder, VolumeMarkerFolderName, "my_volume.json")
+			if fileInfo, err := os.Stat(markerFile); err != nil {
+				t.Error(err)
+			} else {
+				assert.Assert(t, fileInfo.Mode().Perm() == VolumeMarkerFileMode, "Mode = %s", fileInfo.Mode())
+			}
+			if entries, err := os.ReadDir(mountPoint); err != nil {
+				t.Error(err)
+			} else {
+				assert.Assert(t, len(entries) == 0, "The volume folder is not empty (%v).", entries)
+			}
+
+			// Volume names sanitized to the same name collide in any scope.
+			if err := driver.Create(&volume.CreateRequest{Name: "my_volume"}); err == nil {
+				t.Error("Creating a volume with a colliding folder name succeeded unexpectedly.")
+			}
+
+			// The marker file doesn't prevent removing the volume.
+			if err := driver.Remove(&volume.RemoveRequest{Name: "my volume"}); err != nil {
+				t.Error(err)
+			}
+			if _, err := os.Lstat(mountPoint); err == nil {
+				t.Errorf("Folder [%s] has not been removed.", mountPoint)
+			}
+			if _, err := os.Lstat(markerFile); err == nil {
+				t.Errorf("Marker file [%s] has not been removed.", markerFile)
+			}
+			if err := driver.Store.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+//go:build linux
+
+package proc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// region Package globals
+
+const (
+	DEFAULT_PROC_MOUNTINFO_NAME = "mountinfo"
+)
+
+var (
+	// Name of `mountinfo` file(s) for all subsequent procfs based operations.
+	ProcMountinfoName = DEFAULT_PROC_MOUNTINFO_NAME
+	// Returned (wrapped) if a path is not a mount point.
+	ErrNotMounted = errors.New("not mounted")
+)
+
+// region MountInfo struct
+
+// A single line of /proc/<pid>/mountinfo .
+//
+// See https://man7.org/linux/man-pages/man5/proc_pid_mountinfo.5.html
+type MountInfo struct {
+	MountId      int
+	ParentId     int
+	MajorMinor   string
+	Root         string
+	MountPoint   string
+	MountOptions string
+	FsType       string
+	Source       string
+	SuperOptions string
+}
+
+// Parses the contents of a mountinfo file.
+func ParseMountInfo(reader io.Reader) ([]MountInfo, error) {
+	result := []MountInfo{}
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 {
+			continue
+		}
+
+		// The optional fields are terminated by a single hyphen.
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if separator < 0 || len(fields) < separator+4 {
+			return nil, fmt.Errorf("unexpected field count %d in mountinfo line %d", len(fields), line)
+		}
+
+		mountInfo := MountInfo{
+			MajorMinor:   fields[2],
+			Root:         mountInfo_Unescape(fields[3]),
+			MountPoint:   mountInfo_Unescape(fields[4]),
+			MountOptions: fields[5],
+			FsType:       fields[separator+1],
+			Source:       mountInfo_Unescape(fields[separator+2]),
+			SuperOptions: fields[separator+3],
+		}
+
+		var err error
+		if mountInfo.MountId, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, fmt.Errorf("invalid mount id in mountinfo line %d: %w", line, err)
+		}
+		if mountInfo.ParentId, err = strconv.Atoi(fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid parent id in mountinfo line %d: %w", line, err)
+		}
+
+		result = append(result, mountInfo)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Decodes the octal escapes (e.g. `\040` for a space) the kernel uses for
+// white space and backslashes in mountinfo fields.
+func mountInfo_Unescape(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	builder := strings.Builder{}
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if b, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				builder.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		builder.WriteByte(field[i])
+	}
+
+	return builder.String()
+}
+
+// Returns the mounts visible to the current process.
+func GetMountInfo() ([]MountInfo, error) {
+	file, err := os.Open(filepath.Join(ProcPath, "self", ProcMountinfoName))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseMountInfo(file)
+}
+
+// Returns the top most mount at [mountPoint], or an error wrapping
+// ErrNotMounted if nothing is mounted there.
+func GetMountInfoFromMountPoint(mountPoint string) (*MountInfo, error) {
+	path := filepath.Clean(mountPoint)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	mountInfos, err := GetMountInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	// Later lines describe mounts stacked on top of earlier ones.
+	for i := len(mountInfos) - 1; i >= 0; i-- {
+		if mountInfos[i].MountPoint == path {
+			return &mountInfos[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: %w", mountPoint, ErrNotMounted)
+}
+
+// Polls GetMountInfoFromMountPoint() every [pause] until something is mounted
+// at [mountPoint] or [timeout] elapses.
+//
+// If [alive] is not nil, it is called after each try finding nothing mounted,
+// and waiting is aborted with the error it returns, if any (e.g. because the
+// process expected to mount has terminated). Since the mount point is checked
+// first, processes which mount and exit right away (e.g. by daemonizing) are
+// not reported as having failed.
+func WaitForMountWithTimeout(timeout time.Duration, pause time.Duration, mountPoint string, alive func() error) (*MountInfo, error) {
+	tries := 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("context was done before [%s] has been mounted after %d tries", mountPoint, tries)
+		default:
+			tries++
+			if result, err := GetMountInfoFromMountPoint(mountPoint); err == nil {
+				return result, nil
+			} else if !errors.Is(err, ErrNotMounted) {
+				return nil, err
+			}
+
+			if alive != nil {
+				if err := alive(); err != nil {
+					return nil, err
+				}
+			}
+
+			time.Sleep(pause)
+		}
+	}
+}
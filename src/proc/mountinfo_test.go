@@ -0,0 +1,108 @@
+//go:build linux
+
+package proc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		want    []MountInfo
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: []MountInfo{}},
+		{name: "Root", args: "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n", want: []MountInfo{
+			{MountId: 22, ParentId: 1, MajorMinor: "8:1", Root: "/", MountPoint: "/", MountOptions: "rw,relatime", FsType: "ext4", Source: "/dev/sda1", SuperOptions: "rw"},
+		}},
+		{name: "No optional fields", args: "36 35 0:42 / /mnt/my\\040bucket rw,nosuid - fuse.s3fs s3fs rw,user_id=0\n", want: []MountInfo{
+			{MountId: 36, ParentId: 35, MajorMinor: "0:42", Root: "/", MountPoint: "/mnt/my bucket", MountOptions: "rw,nosuid", FsType: "fuse.s3fs", Source: "s3fs", SuperOptions: "rw,user_id=0"},
+		}},
+		{name: "Multiple optional fields", args: "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 shared:2 - ext3 /dev/root rw,errors=continue\n", want: []MountInfo{
+			{MountId: 36, ParentId: 35, MajorMinor: "98:0", Root: "/mnt1", MountPoint: "/mnt2", MountOptions: "rw,noatime", FsType: "ext3", Source: "/dev/root", SuperOptions: "rw,errors=continue"},
+		}},
+		{name: "Missing separator", args: "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 ext3 /dev/root rw\n", wantErr: true},
+		{name: "Invalid mount id", args: "x 35 98:0 /mnt1 /mnt2 rw,noatime - ext3 /dev/root rw\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMountInfo(strings.NewReader(tt.args))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMountInfo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.DeepEqual(t, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mountInfo_Unescape(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		// Test cases.
+		{name: "Plain", args: "/mnt/bucket", want: "/mnt/bucket"},
+		{name: "Space", args: `/mnt/my\040bucket`, want: "/mnt/my bucket"},
+		{name: "Backslash", args: `/mnt/my\134bucket`, want: `/mnt/my\bucket`},
+		{name: "Trailing", args: `/mnt/bucket\04`, want: `/mnt/bucket\04`},
+		{name: "Invalid", args: `/mnt/\999`, want: `/mnt/\999`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mountInfo_Unescape(tt.args); got != tt.want {
+				t.Errorf("mountInfo_Unescape() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMountInfoFromMountPoint(t *testing.T) {
+	if mountInfo, err := GetMountInfoFromMountPoint("/"); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, mountInfo.MountPoint == "/")
+	}
+
+	folder := filepath.Join(t.TempDir(), "not_a_mount_point")
+	if err := os.Mkdir(folder, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetMountInfoFromMountPoint(folder); !errors.Is(err, ErrNotMounted) {
+		t.Errorf("GetMountInfoFromMountPoint() error = %v, want %v", err, ErrNotMounted)
+	}
+
+	if _, err := WaitForMountWithTimeout(time.Second, 10*time.Millisecond, "/", nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := WaitForMountWithTimeout(100*time.Millisecond, 10*time.Millisecond, folder, nil); err == nil {
+		t.Error("WaitForMountWithTimeout() succeeded unexpectedly.")
+	}
+	dead := errors.New("dead")
+	if _, err := WaitForMountWithTimeout(time.Minute, 10*time.Millisecond, folder, func() error { return dead }); !errors.Is(err, dead) {
+		t.Errorf("WaitForMountWithTimeout() error = %v, want %v", err, dead)
+	}
+	// Processes which have mounted and exited already are not considered dead.
+	if _, err := WaitForMountWithTimeout(time.Second, 10*time.Millisecond, "/", func() error { return dead }); err != nil {
+		t.Error(err)
+	}
+
+	ProcPath = t.TempDir()
+	if _, err := GetMountInfoFromMountPoint("/"); err == nil {
+		t.Error("GetMountInfoFromMountPoint() succeeded unexpectedly.")
+	}
+	ProcPath = DEFAULT_PROC_PATH
+}
@@ -130,3 +130,11 @@ func (o Options) Len() int {
 
 	return result
 }
+
+// Returns a deep copy of the options, so the copy can be modified without
+// affecting the original.
+func (o Options) Clone() Options {
+	options := slices.Clone(o.Slice())
+
+	return Options{options: &options, separator: o.separator, trim: o.trim}
+}
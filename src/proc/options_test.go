@@ -94,3 +94,22 @@ func TestOptionsString(t *testing.T) {
 		})
 	}
 }
+
+func TestOptions_Clone(t *testing.T) {
+	o := NewOptions(2, "&", true)
+	if err := o.Set("-a&-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := o.Clone()
+	if err := c.Set("-c"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, o.String() == "-a&-b")
+	assert.Assert(t, c.String() == "-a&-b&-c")
+
+	c = Options{}.Clone()
+	if err := c.Set("-a"); err != nil {
+		t.Error(err)
+	}
+}
@@ -14,11 +14,13 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -551,12 +553,215 @@ func GetProcessUniqueId(processInfo IProcessInfo) string {
 // region Process Monitor
 
 type ProcessMonitor struct {
-	noCopy       noCopy
-	cancel       bool
-	chError      chan error
-	Process      *os.Process
-	ProcessInfo  *ProcessInfo
+	noCopy         noCopy
+	cancel         bool
+	cancelSignal   os.Signal
+	chCancel       chan struct{}
+	cancelOnce     sync.Once
+	chError        chan error
+	Process        *os.Process
+	ProcessInfo    *ProcessInfo
+	RecoveryMode   RecoveryMode
+	restarts       uint
+	attempts       uint
+	nextRestart    time.Time
+	failures       uint
+	kills          uint
+	events         []ProcessEvent
+	subscribers    map[uint]chan ProcessEvent
+	nextSubscriber uint
+	terminated     bool
+	rateMetric     metric.Metric[int]
+	mutex          sync.Mutex
+}
+
+// A snapshot of the state of a ProcessMonitor.
+type ProcessMonitorStatus struct {
+	// The process currently being monitored, which differs from the process
+	// initially monitored after restarts.
+	ProcessInfo  ProcessInfo
+	RecoveryMode RecoveryMode
+	// Total number of restarts.
+	Restarts uint
+	// Number of restarts within the last RestartRateDuration, as taken from
+	// the rate limiting metric.
+	RestartRate         uint
+	RestartRateDuration time.Duration
+	// Number of consecutive restarts with RecoveryModeBackoff.
+	Attempts uint
+	// When the process is going to be restarted with RecoveryModeBackoff, or
+	// the zero time if it's not waiting to be restarted.
+	NextRestart time.Time
+	// Number of consecutive rounds of liveness probes with failures.
+	LivenessFailures uint
+	// Number of times the process has been killed since it didn't pass the
+	// liveness probes.
+	LivenessKills uint
+}
+
+// Returns a snapshot of the state of the process monitor.
+func (m *ProcessMonitor) Status() ProcessMonitorStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	status := ProcessMonitorStatus{
+		ProcessInfo:  *m.ProcessInfo,
+		RecoveryMode: m.RecoveryMode,
+		Restarts:     m.restarts,
+		Attempts:     m.attempts,
+		NextRestart:  m.nextRestart,
+
+		LivenessFailures: m.failures,
+		LivenessKills:    m.kills,
+	}
+	if m.rateMetric != nil {
+		status.RestartRate, status.RestartRateDuration, _ = m.rateMetric.Rate()
+	}
+
+	return status
+}
+
+// Returns whether the process monitor has been cancelled (see setCancel()).
+func (m *ProcessMonitor) cancelled() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.cancel
+}
+
+// Tells the monitoring goroutine not to restart the process anymore, including
+// while waiting to restart it, and sends [signal] to the monitored process.
+//
+// A process started by a restart which is in progress meanwhile receives
+// [signal] as soon as it is monitored, so it isn't left running.
+func (m *ProcessMonitor) setCancel(signal os.Signal) error {
+	m.mutex.Lock()
+	m.cancel = true
+	m.cancelSignal = signal
+	process := m.Process
+	m.mutex.Unlock()
+
+	m.cancelOnce.Do(func() {
+		close(m.chCancel)
+	})
+
+	// The process may have terminated already, with the process monitor
+	// waiting to restart it.
+	if err := process.Signal(signal); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	return nil
+}
+
+// Sends [signal] to the process currently being monitored.
+func (m *ProcessMonitor) signal(signal os.Signal) error {
+	m.mutex.Lock()
+	process := m.Process
+	m.mutex.Unlock()
+
+	return process.Signal(signal)
+}
+
+// Waits [delay] before restarting the process and returns true, or false if
+// the process monitor is cancelled in the meantime.
+func (m *ProcessMonitor) waitForRestart(delay time.Duration) bool {
+	m.mutex.Lock()
+	m.nextRestart = time.Now().Add(delay)
+	m.mutex.Unlock()
+	defer func() {
+		m.mutex.Lock()
+		m.nextRestart = time.Time{}
+		m.mutex.Unlock()
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-m.chCancel:
+		return false
+	}
+}
+
+// Runs the probes of [policy] every policy.Interval until [done] is closed or
+// the process monitor is cancelled, and kills the monitored process after
+// policy.FailureThreshold consecutive failures, so it is recovered just like a
+// crashed process.
+func (m *ProcessMonitor) probeLiveness(policy LivenessPolicy, done <-chan struct{}) {
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-m.chCancel:
+			return
+		case <-ticker.C:
+		}
+
+		m.mutex.Lock()
+		process := m.Process
+		waiting := !m.nextRestart.IsZero()
+		m.mutex.Unlock()
+		if waiting {
+			continue
+		}
+
+		processInfo, err := GetProcessInfo(process.Pid)
+		if err != nil {
+			// The process has terminated, which is handled by Wait().
+			continue
+		}
+
+		err = policy.probe(processInfo)
+		m.mutex.Lock()
+		if err == nil {
+			m.failures = 0
+		} else {
+			m.failures++
+		}
+		failures := m.failures
+		m.mutex.Unlock()
+		if err == nil {
+			continue
+		}
+
+		Logger.Warn("monitored process failed liveness probes", "pid", process.Pid, "failures", failures, "failureThreshold", policy.FailureThreshold, "err", err)
+		if failures < policy.FailureThreshold {
+			continue
+		}
+
+		m.mutex.Lock()
+		m.failures = 0
+		m.kills++
+		m.mutex.Unlock()
+
+		Logger.Warn("killing monitored process since it failed liveness probes too often", "pid", process.Pid, "failures", failures)
+		m.emit(ProcessEventKilled, processInfo, 0, "failed liveness probes")
+		if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			Logger.Error("failed to kill monitored process", "pid", process.Pid, "err", err)
+		}
+	}
+}
+
+// Options controlling how a process monitor behaves if the monitored process
+// terminates.
+type MonitorOptions struct {
 	RecoveryMode RecoveryMode
+	// Controls when to give up restarting the process with
+	// RecoveryModeRestart. If nil, rate limiting defaults to 3 restarts within
+	// 1 minute.
+	RateLimit *metric.MetricRateLimit
+	// Controls when to restart the process and when to give up with
+	// RecoveryModeBackoff. If nil, DefaultBackoffPolicy applies.
+	Backoff *BackoffPolicy
+	// Controls how to detect that the process hangs rather than terminates.
+	// If nil or without probes, liveness isn't probed.
+	Liveness *LivenessPolicy
 }
 
 // Starts a goroutine that keeps track of the processes status.
@@ -566,9 +771,68 @@ type ProcessMonitor struct {
 // controls when to give up restarting the process. If [rateLimit] is `nil`,
 // rate limiting defaults to 3 restarts within 1 minute.
 //
+// The process is restarted according to a launch specification derived from
+// the running process (see LaunchSpecFromProcess()). Use
+// MonitorProcessWithSpec() if the launch specification is known.
+//
+// The process doesn't need to be a child of the current process, e.g. it may
+// have been started by a previous instance of the current program. The
+// termination of such processes is detected without their exit status though
+// (see waitForeign()).
+//
 // The returned ProcessMonitor object is meant to be used in calls to
 // CancelProcess() and KillProcess().
 func MonitorProcess(pid int, recoveryMode RecoveryMode, rateLimit *metric.MetricRateLimit) (*ProcessMonitor, error) {
+	return MonitorProcessWithOptions(pid, nil, MonitorOptions{RecoveryMode: recoveryMode, RateLimit: rateLimit})
+}
+
+// Same as MonitorProcess(), but restarts the process according to [spec],
+// which should be the launch specification the process has been started with.
+//
+// On success, the process monitor takes ownership of [spec], i.e. the files of
+// [spec] are kept open for restarts and closed once the process monitor
+// terminates (see LaunchSpec.Close()).
+func MonitorProcessWithSpec(pid int, spec *LaunchSpec, recoveryMode RecoveryMode, rateLimit *metric.MetricRateLimit) (*ProcessMonitor, error) {
+	if spec == nil {
+		return nil, errors.New("launch specification must not be nil")
+	}
+
+	return MonitorProcessWithOptions(pid, spec, MonitorOptions{RecoveryMode: recoveryMode, RateLimit: rateLimit})
+}
+
+// Same as MonitorProcessWithSpec(), but taking all options controlling the
+// recovery of the process from [options]. If [spec] is nil, the launch
+// specification is derived from the running process (see MonitorProcess()).
+func MonitorProcessWithOptions(pid int, spec *LaunchSpec, options MonitorOptions) (*ProcessMonitor, error) {
+	if spec == nil {
+		derived, err := LaunchSpecFromProcess(pid)
+		if err != nil {
+			return nil, err
+		}
+
+		monitor, err := MonitorProcessWithOptions(pid, derived, options)
+		if err != nil {
+			return nil, errors.Join(err, derived.Close())
+		}
+
+		return monitor, nil
+	}
+
+	backoff := DefaultBackoffPolicy
+	if options.Backoff != nil {
+		backoff = *options.Backoff
+	}
+	if options.RecoveryMode == RecoveryModeBackoff {
+		if err := backoff.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if options.Liveness != nil && len(options.Liveness.Probes) > 0 {
+		if err := options.Liveness.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	process, err := os.FindProcess(pid)
 	if err != nil {
 		return nil, err
@@ -577,17 +841,19 @@ func MonitorProcess(pid int, recoveryMode RecoveryMode, rateLimit *metric.Metric
 	processInfo, err := GetProcessInfo(process.Pid)
 	if err != nil {
 		return nil, err
-	} else if _, err := os.Stat(processInfo.Cmdline[0]); os.IsNotExist(err) {
+	} else if _, err := os.Stat(spec.Path); os.IsNotExist(err) {
 		return nil, err
 	}
 
 	var monitor = ProcessMonitor{
+		chCancel:     make(chan struct{}),
 		chError:      make(chan error, 1),
 		Process:      process,
 		ProcessInfo:  processInfo,
-		RecoveryMode: recoveryMode,
+		RecoveryMode: options.RecoveryMode,
 	}
 
+	rateLimit := options.RateLimit
 	if rateLimit == nil {
 		rateLimit = &metric.MetricRateLimit{Limit: 3, Duration: 1 * time.Minute}
 	}
@@ -596,56 +862,150 @@ func MonitorProcess(pid int, recoveryMode RecoveryMode, rateLimit *metric.Metric
 	if rateMetric, err = metric.NewMetricBase[int](*rateLimit); err != nil {
 		return nil, err
 	}
+	monitor.rateMetric = rateMetric
 
+	monitor.emit(ProcessEventStarted, processInfo, 0, "monitoring started")
+
+	done := make(chan struct{})
 	go func(monitor *ProcessMonitor, metric *metric.Metric[int]) {
+		defer close(done)
+		defer func() {
+			if err := spec.Close(); err != nil {
+				Logger.Warn("Failed to close the files of the launch specification.", "processName", spec.Path, "err", err)
+			}
+		}()
+
+		// When the process has been (re)started, or at least began being
+		// monitored.
+		startedAt := time.Now()
+
+		// Terminates the process monitor, after it's last event has been
+		// emitted.
+		terminate := func(err error) {
+			monitor.closeSubscribers()
+			monitor.chError <- err
+		}
+
 		for {
-			processState, err := monitor.Process.Wait()
+			exitCode, exitStatus, err := monitor.wait()
 			if err != nil {
-				monitor.chError <- err
+				monitor.emit(ProcessEventGaveUp, monitor.ProcessInfo, 0, err.Error())
+				terminate(err)
 				break
 			}
-			Logger.Debug(processState.String(), "processName", processInfo.Cmdline[0], "processState", fmt.Sprintf("%#v", processState))
+			Logger.Debug(exitStatus, "processName", spec.Path, "exitCode", exitCode)
+			monitor.emit(ProcessEventExited, monitor.ProcessInfo, exitCode, exitStatus)
 
-			if monitor.cancel || monitor.RecoveryMode == RecoveryModeIgnore {
-				monitor.chError <- err // expected to be nil, but nevermind
+			if monitor.cancelled() {
+				monitor.emit(ProcessEventCancelled, monitor.ProcessInfo, 0, "cancelled")
+				terminate(err) // expected to be nil, but nevermind
 				break
-			} else if monitor.RecoveryMode == RecoveryModePanic {
-				panic(errors.New(processState.String()))
-			}
-
-			rate, duration, limitReached := (*metric).Rate()
-			msg := fmt.Sprintf("monitored process has been restarted %d times within the last %s", rate, duration)
-			if limitReached {
-				msg = fmt.Sprintf("%s: giving up recovery", msg)
+			} else if monitor.RecoveryMode == RecoveryModeIgnore {
+				terminate(err) // expected to be nil, but nevermind
+				break
+			} else if monitor.RecoveryMode == RecoveryModeFail {
+				msg := fmt.Sprintf("monitored process failed: %s", exitStatus)
 				Logger.Debug(msg)
-				monitor.chError <- errors.New(msg)
+				monitor.emit(ProcessEventFailed, monitor.ProcessInfo, exitCode, exitStatus)
+				terminate(errors.New(msg))
 				break
-			} else {
-				msg = fmt.Sprintf("%s: attempting to restart it", msg)
+			}
+
+			if monitor.RecoveryMode == RecoveryModeBackoff {
+				attempts := monitor.attempts
+				if time.Since(startedAt) >= backoff.MaxDelay {
+					attempts = 0
+				}
+
+				msg := fmt.Sprintf("monitored process has been restarted %d times in a row", attempts)
+				if backoff.MaxAttempts > 0 && attempts >= backoff.MaxAttempts {
+					msg = fmt.Sprintf("%s: giving up recovery", msg)
+					Logger.Debug(msg)
+					monitor.emit(ProcessEventGaveUp, monitor.ProcessInfo, 0, msg)
+					terminate(errors.New(msg))
+					break
+				}
+
+				attempts++
+				delay := backoff.Delay(attempts, rand.Float64())
+				msg = fmt.Sprintf("%s: attempting to restart it in %s", msg, delay)
 				Logger.Info(msg)
+				monitor.emit(ProcessEventRestarting, monitor.ProcessInfo, 0, msg)
+
+				monitor.mutex.Lock()
+				monitor.attempts = attempts
+				monitor.mutex.Unlock()
+
+				if !monitor.waitForRestart(delay) {
+					monitor.emit(ProcessEventCancelled, monitor.ProcessInfo, 0, "cancelled while waiting to restart")
+					terminate(nil)
+					break
+				}
+			} else {
+				rate, duration, limitReached := (*metric).Rate()
+				msg := fmt.Sprintf("monitored process has been restarted %d times within the last %s", rate, duration)
+				if limitReached {
+					msg = fmt.Sprintf("%s: giving up recovery", msg)
+					Logger.Debug(msg)
+					monitor.emit(ProcessEventGaveUp, monitor.ProcessInfo, 0, msg)
+					terminate(errors.New(msg))
+					break
+				} else {
+					msg = fmt.Sprintf("%s: attempting to restart it", msg)
+					Logger.Info(msg)
+					monitor.emit(ProcessEventRestarting, monitor.ProcessInfo, 0, msg)
+				}
+			}
+
+			// The process monitor may have been cancelled while deciding to
+			// restart the process.
+			if monitor.cancelled() {
+				monitor.emit(ProcessEventCancelled, monitor.ProcessInfo, 0, "cancelled before restarting")
+				terminate(nil)
+				break
 			}
 
-			process, err := os.StartProcess(processInfo.Cmdline[0], processInfo.Cmdline, &os.ProcAttr{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}})
+			process, err := spec.Start()
+			startedAt = time.Now()
 			if err != nil {
-				monitor.chError <- err
+				monitor.emit(ProcessEventGaveUp, monitor.ProcessInfo, 0, err.Error())
+				terminate(err)
 				break
 			}
 
 			processInfo, err := GetProcessInfoWithTimeout(5*time.Second, 1*time.Second, process.Pid)
 			if err != nil {
-				monitor.chError <- err
+				monitor.emit(ProcessEventGaveUp, monitor.ProcessInfo, 0, err.Error())
+				terminate(err)
 				break
 			}
 
+			monitor.mutex.Lock()
 			monitor.Process = process
 			monitor.ProcessInfo = processInfo
+			monitor.restarts++
+			cancelled, cancelSignal := monitor.cancel, monitor.cancelSignal
+			monitor.mutex.Unlock()
+
+			// The process monitor has been cancelled while restarting the
+			// process, i.e. the signal has been sent to it's predecessor.
+			if cancelled {
+				if err := process.Signal(cancelSignal); err != nil && !errors.Is(err, os.ErrProcessDone) {
+					Logger.Warn("Failed to signal the restarted process of a cancelled process monitor.", "pid", process.Pid, "err", err)
+				}
+			}
 
 			(*metric).Update(process.Pid)
+			monitor.emit(ProcessEventStarted, processInfo, 0, "restarted")
 
-			Logger.Debug("restarted monitored process", "processName", processInfo.Cmdline[0], "process", process, "processInfo", processInfo)
+			Logger.Debug("restarted monitored process", "processName", spec.Path, "process", process, "processInfo", processInfo)
 		}
 	}(&monitor, &rateMetric)
 
+	if options.Liveness != nil && len(options.Liveness.Probes) > 0 {
+		go monitor.probeLiveness(*options.Liveness, done)
+	}
+
 	return &monitor, nil
 }
 
@@ -663,9 +1023,7 @@ func CancelProcess(processMonitor *ProcessMonitor, timeout time.Duration) error
 		return *err
 	}
 
-	processMonitor.cancel = true
-
-	if err := processMonitor.Process.Signal(os.Interrupt); err != nil {
+	if err := processMonitor.setCancel(os.Interrupt); err != nil {
 		return err
 	}
 
@@ -674,10 +1032,10 @@ func CancelProcess(processMonitor *ProcessMonitor, timeout time.Duration) error
 
 	select {
 	case <-ctx.Done():
-		Logger.Debug("cancel process: timeout elapsed, killing process", "timeout", timeout, "process", processMonitor.Process)
+		Logger.Debug("cancel process: timeout elapsed, killing process", "timeout", timeout, "pid", processMonitor.Status().ProcessInfo.Pid)
 		return KillProcess(processMonitor, timeout)
 	case err := <-processMonitor.chError:
-		Logger.Debug("cancel process: cancelled process", "err", err, "process", processMonitor.Process)
+		Logger.Debug("cancel process: cancelled process", "err", err, "pid", processMonitor.Status().ProcessInfo.Pid)
 		return err
 	}
 }
@@ -696,9 +1054,9 @@ func KillProcess(processMonitor *ProcessMonitor, timeout time.Duration) error {
 		return *err
 	}
 
-	processMonitor.cancel = true
-
-	if err := processMonitor.Process.Kill(); err != nil {
+	processInfo := processMonitor.Status().ProcessInfo
+	processMonitor.emit(ProcessEventKilled, &processInfo, 0, "killed")
+	if err := processMonitor.setCancel(os.Kill); err != nil {
 		return err
 	}
 
@@ -709,7 +1067,7 @@ func KillProcess(processMonitor *ProcessMonitor, timeout time.Duration) error {
 	case <-ctx.Done():
 		return fmt.Errorf("kill process: %d timeout elapsed", timeout)
 	case err := <-processMonitor.chError:
-		Logger.Debug("kill process: killed process", "err", err, "process", processMonitor.Process)
+		Logger.Debug("kill process: killed process", "err", err, "pid", processMonitor.Status().ProcessInfo.Pid)
 		return err
 	}
 }
@@ -0,0 +1,342 @@
+//go:build linux
+
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// region Package globals
+
+const (
+	ATTRIBUTES_SEPARATOR = ","
+	USER_GROUP_SEPARATOR = ":"
+	CAPABILITY_PREFIX    = "CAP_"
+	SIGNAL_PREFIX        = "SIG"
+	// The prctl option setting no_new_privs, which package syscall doesn't
+	// define.
+	PR_SET_NO_NEW_PRIVS = 38
+)
+
+// region Capability enum
+
+// A Linux capability (see capabilities(7)).
+type Capability uintptr
+
+const (
+	CAP_CHOWN Capability = iota
+	CAP_DAC_OVERRIDE
+	CAP_DAC_READ_SEARCH
+	CAP_FOWNER
+	CAP_FSETID
+	CAP_KILL
+	CAP_SETGID
+	CAP_SETUID
+	CAP_SETPCAP
+	CAP_LINUX_IMMUTABLE
+	CAP_NET_BIND_SERVICE
+	CAP_NET_BROADCAST
+	CAP_NET_ADMIN
+	CAP_NET_RAW
+	CAP_IPC_LOCK
+	CAP_IPC_OWNER
+	CAP_SYS_MODULE
+	CAP_SYS_RAWIO
+	CAP_SYS_CHROOT
+	CAP_SYS_PTRACE
+	CAP_SYS_PACCT
+	CAP_SYS_ADMIN
+	CAP_SYS_BOOT
+	CAP_SYS_NICE
+	CAP_SYS_RESOURCE
+	CAP_SYS_TIME
+	CAP_SYS_TTY_CONFIG
+	CAP_MKNOD
+	CAP_LEASE
+	CAP_AUDIT_WRITE
+	CAP_AUDIT_CONTROL
+	CAP_SETFCAP
+	CAP_MAC_OVERRIDE
+	CAP_MAC_ADMIN
+	CAP_SYSLOG
+	CAP_WAKE_ALARM
+	CAP_BLOCK_SUSPEND
+	CAP_AUDIT_READ
+	CAP_PERFMON
+	CAP_BPF
+	CAP_CHECKPOINT_RESTORE
+)
+
+var capabilityNames = map[Capability]string{
+	CAP_CHOWN:              "CAP_CHOWN",
+	CAP_DAC_OVERRIDE:       "CAP_DAC_OVERRIDE",
+	CAP_DAC_READ_SEARCH:    "CAP_DAC_READ_SEARCH",
+	CAP_FOWNER:             "CAP_FOWNER",
+	CAP_FSETID:             "CAP_FSETID",
+	CAP_KILL:               "CAP_KILL",
+	CAP_SETGID:             "CAP_SETGID",
+	CAP_SETUID:             "CAP_SETUID",
+	CAP_SETPCAP:            "CAP_SETPCAP",
+	CAP_LINUX_IMMUTABLE:    "CAP_LINUX_IMMUTABLE",
+	CAP_NET_BIND_SERVICE:   "CAP_NET_BIND_SERVICE",
+	CAP_NET_BROADCAST:      "CAP_NET_BROADCAST",
+	CAP_NET_ADMIN:          "CAP_NET_ADMIN",
+	CAP_NET_RAW:            "CAP_NET_RAW",
+	CAP_IPC_LOCK:           "CAP_IPC_LOCK",
+	CAP_IPC_OWNER:          "CAP_IPC_OWNER",
+	CAP_SYS_MODULE:         "CAP_SYS_MODULE",
+	CAP_SYS_RAWIO:          "CAP_SYS_RAWIO",
+	CAP_SYS_CHROOT:         "CAP_SYS_CHROOT",
+	CAP_SYS_PTRACE:         "CAP_SYS_PTRACE",
+	CAP_SYS_PACCT:          "CAP_SYS_PACCT",
+	CAP_SYS_ADMIN:          "CAP_SYS_ADMIN",
+	CAP_SYS_BOOT:           "CAP_SYS_BOOT",
+	CAP_SYS_NICE:           "CAP_SYS_NICE",
+	CAP_SYS_RESOURCE:       "CAP_SYS_RESOURCE",
+	CAP_SYS_TIME:           "CAP_SYS_TIME",
+	CAP_SYS_TTY_CONFIG:     "CAP_SYS_TTY_CONFIG",
+	CAP_MKNOD:              "CAP_MKNOD",
+	CAP_LEASE:              "CAP_LEASE",
+	CAP_AUDIT_WRITE:        "CAP_AUDIT_WRITE",
+	CAP_AUDIT_CONTROL:      "CAP_AUDIT_CONTROL",
+	CAP_SETFCAP:            "CAP_SETFCAP",
+	CAP_MAC_OVERRIDE:       "CAP_MAC_OVERRIDE",
+	CAP_MAC_ADMIN:          "CAP_MAC_ADMIN",
+	CAP_SYSLOG:             "CAP_SYSLOG",
+	CAP_WAKE_ALARM:         "CAP_WAKE_ALARM",
+	CAP_BLOCK_SUSPEND:      "CAP_BLOCK_SUSPEND",
+	CAP_AUDIT_READ:         "CAP_AUDIT_READ",
+	CAP_PERFMON:            "CAP_PERFMON",
+	CAP_BPF:                "CAP_BPF",
+	CAP_CHECKPOINT_RESTORE: "CAP_CHECKPOINT_RESTORE",
+}
+
+func CapabilityNames() map[Capability]string {
+	return capabilityNames
+}
+
+func (c Capability) String() string {
+	if v, ok := capabilityNames[c]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(c))
+	}
+}
+
+// Parses a capability name, with or without CAPABILITY_PREFIX and ignoring
+// case (e.g. `CAP_SYS_ADMIN` or `sys_admin`).
+func CapabilityParse(name string, defaultCapability Capability) Capability {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultCapability
+	}
+
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, CAPABILITY_PREFIX) {
+		name = CAPABILITY_PREFIX + name
+	}
+	for k, v := range capabilityNames {
+		if name == v {
+			return k
+		}
+	}
+
+	return defaultCapability
+}
+
+// Parses a comma separated list of capability names (see CapabilityParse()),
+// omitting empty names and duplicates, in the form used by
+// syscall.SysProcAttr.AmbientCaps.
+func CapabilitiesParse(names string) ([]uintptr, error) {
+	caps := []uintptr{}
+	for _, name := range strings.Split(names, ATTRIBUTES_SEPARATOR) {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		invalidCapability := Capability(^uintptr(0))
+		if c := CapabilityParse(name, invalidCapability); c == invalidCapability {
+			return nil, fmt.Errorf("capability [%s] is not valid", name)
+		} else if !slices.Contains(caps, uintptr(c)) {
+			caps = append(caps, uintptr(c))
+		}
+	}
+
+	return caps, nil
+}
+
+// Returns the names of [caps], comma separated.
+func CapabilitiesString(caps []uintptr) string {
+	names := []string{}
+	for _, c := range caps {
+		names = append(names, Capability(c).String())
+	}
+
+	return strings.Join(names, ATTRIBUTES_SEPARATOR)
+}
+
+// region Signals
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"ABRT": syscall.SIGABRT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"PIPE": syscall.SIGPIPE,
+	"ALRM": syscall.SIGALRM,
+	"TERM": syscall.SIGTERM,
+}
+
+// Parses a signal given by it's number or name, with or without SIGNAL_PREFIX
+// and ignoring case (e.g. `15`, `SIGTERM` or `term`). Only signals meant to
+// terminate a process are known by name.
+func SignalParse(name string) (syscall.Signal, error) {
+	if number, err := strconv.ParseUint(strings.TrimSpace(name), 10, 8); err == nil && number > 0 && number < 65 {
+		return syscall.Signal(number), nil
+	}
+
+	if signal, ok := signalNames[strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), SIGNAL_PREFIX)]; ok {
+		return signal, nil
+	}
+
+	return 0, fmt.Errorf("signal [%s] is not valid", name)
+}
+
+// region Users and groups
+
+// Parses a user specification in the form `user[:group]`, where user and group
+// are names or numeric IDs. If the group is omitted, the primary group of the
+// user is used, which requires the user to be known (e.g. have an entry in
+// /etc/passwd).
+func UserParse(spec string) (uid uint32, gid uint32, fail error) {
+	name, group, hasGroup := strings.Cut(strings.TrimSpace(spec), USER_GROUP_SEPARATOR)
+	name, group = strings.TrimSpace(name), strings.TrimSpace(group)
+	if name == "" {
+		return 0, 0, fmt.Errorf("user [%s] is not valid", spec)
+	}
+
+	var usr *user.User
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		uid = uint32(id)
+		if !hasGroup {
+			if usr, err = user.LookupId(name); err != nil {
+				return 0, 0, fmt.Errorf("user [%s] is unknown, so it's group must be specified as well: %w", name, err)
+			}
+		}
+	} else if usr, err = user.Lookup(name); err != nil {
+		return 0, 0, err
+	} else if id, err := strconv.ParseUint(usr.Uid, 10, 32); err != nil {
+		return 0, 0, err
+	} else {
+		uid = uint32(id)
+	}
+
+	if !hasGroup {
+		group = usr.Gid
+	}
+	if gid, err := GroupParse(group); err != nil {
+		return 0, 0, err
+	} else {
+		return uid, gid, nil
+	}
+}
+
+// Parses a group given by it's name or numeric ID.
+func GroupParse(name string) (uint32, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, errors.New("group must not be empty")
+	}
+
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+
+	group, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(group.Gid, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(id), nil
+}
+
+// Parses a comma separated list of groups (see GroupParse()), omitting empty
+// names.
+func GroupsParse(names string) ([]uint32, error) {
+	gids := []uint32{}
+	for _, name := range strings.Split(names, ATTRIBUTES_SEPARATOR) {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		gid, err := GroupParse(name)
+		if err != nil {
+			return nil, err
+		}
+		gids = append(gids, gid)
+	}
+
+	return gids, nil
+}
+
+// region ProcessAttributes struct
+
+// The identity and privileges a process is started with.
+type ProcessAttributes struct {
+	// The user, group and supplementary groups, the ones of the current
+	// process if nil.
+	Credential *syscall.Credential
+	// The ambient capabilities (see syscall.SysProcAttr.AmbientCaps).
+	AmbientCaps []uintptr
+	// Whether the process (and it's children) cannot gain privileges, e.g. by
+	// executing setuid binaries (see LaunchSpec.NoNewPrivs).
+	NoNewPrivs bool
+	// The signal the process receives if the current process terminates, 0
+	// for none (see syscall.SysProcAttr.Pdeathsig).
+	Pdeathsig syscall.Signal
+}
+
+// Returns an error if the process attributes cannot be applied together.
+func (a ProcessAttributes) Validate() error {
+	if a.NoNewPrivs && a.Pdeathsig != 0 {
+		return errors.New("no_new_privs cannot be combined with a parent death signal")
+	}
+
+	return nil
+}
+
+// Applies the process attributes to [spec], without modifying the
+// syscall.SysProcAttr it refers to (if any), which may be shared.
+func (a ProcessAttributes) Apply(spec *LaunchSpec) {
+	sys := syscall.SysProcAttr{}
+	if spec.Sys != nil {
+		sys = *spec.Sys
+	}
+
+	if a.Credential != nil {
+		credential := *a.Credential
+		sys.Credential = &credential
+	}
+	if len(a.AmbientCaps) > 0 {
+		sys.AmbientCaps = a.AmbientCaps
+	}
+	if a.Pdeathsig != 0 {
+		sys.Pdeathsig = a.Pdeathsig
+	}
+
+	spec.Sys = &sys
+	spec.NoNewPrivs = spec.NoNewPrivs || a.NoNewPrivs
+}
@@ -0,0 +1,167 @@
+//go:build linux
+
+package proc
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestCapabilitiesParse(t *testing.T) {
+	assert.Assert(t, len(CapabilityNames()) == int(CAP_CHECKPOINT_RESTORE)+1)
+
+	tests := []struct {
+		name       string
+		args       string
+		want       []uintptr
+		wantString string
+		wantErr    bool
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: []uintptr{}},
+		{name: "Names", args: "CAP_SYS_ADMIN, net_bind_service,,Cap_Sys_Admin", want: []uintptr{uintptr(CAP_SYS_ADMIN), uintptr(CAP_NET_BIND_SERVICE)}, wantString: "CAP_SYS_ADMIN,CAP_NET_BIND_SERVICE"},
+		{name: "Unknown", args: "cap_everything", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CapabilitiesParse(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CapabilitiesParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.DeepEqual(t, got, tt.want)
+				assert.Equal(t, CapabilitiesString(got), tt.wantString)
+			}
+		})
+	}
+}
+
+func TestSignalParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Number", args: " 15", want: syscall.SIGTERM},
+		{name: "Prefixed", args: "SIGKILL", want: syscall.SIGKILL},
+		{name: "Mixedcase", args: "\tuSr1 ", want: syscall.SIGUSR1},
+		{name: "Zero", args: "0", wantErr: true},
+		{name: "Unknown", args: "sigfoo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SignalParse(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignalParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Assert(t, got == tt.want, "SignalParse() = %v, want %v", got, tt.want)
+		})
+	}
+}
+
+func TestUserParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		wantUid uint32
+		wantGid uint32
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Empty", args: "", wantErr: true},
+		{name: "Name", args: "root", wantUid: 0, wantGid: 0},
+		{name: "NameAndGroup", args: "root:daemon", wantUid: 0, wantGid: 1},
+		{name: "Numeric", args: " 12345 : 23456 ", wantUid: 12345, wantGid: 23456},
+		{name: "UnknownNumeric", args: "12345", wantErr: true},
+		{name: "UnknownName", args: "no-such-user", wantErr: true},
+		{name: "UnknownGroup", args: "root:no-such-group", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, gid, err := UserParse(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UserParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Assert(t, uid == tt.wantUid && gid == tt.wantGid, "UserParse() = %d, %d", uid, gid)
+		})
+	}
+
+	gids, err := GroupsParse("daemon, 4242,,")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, gids, []uint32{1, 4242})
+	_, err = GroupsParse("no-such-group")
+	assert.Assert(t, err != nil)
+}
+
+func TestProcessAttributes(t *testing.T) {
+	assert.NilError(t, ProcessAttributes{NoNewPrivs: true}.Validate())
+	assert.NilError(t, ProcessAttributes{Pdeathsig: syscall.SIGTERM}.Validate())
+	assert.Assert(t, ProcessAttributes{NoNewPrivs: true, Pdeathsig: syscall.SIGTERM}.Validate() != nil)
+
+	shared := &syscall.SysProcAttr{Setpgid: true}
+	spec := &LaunchSpec{Sys: shared}
+	ProcessAttributes{Credential: &syscall.Credential{Uid: 1, Gid: 2}, AmbientCaps: []uintptr{uintptr(CAP_SYS_ADMIN)}, Pdeathsig: syscall.SIGTERM}.Apply(spec)
+	assert.Assert(t, spec.Sys != shared)
+	assert.Assert(t, spec.Sys.Setpgid && spec.Sys.Credential.Uid == 1 && spec.Sys.Credential.Gid == 2 && spec.Sys.Pdeathsig == syscall.SIGTERM)
+	assert.DeepEqual(t, spec.Sys.AmbientCaps, []uintptr{uintptr(CAP_SYS_ADMIN)})
+	assert.Assert(t, shared.Credential == nil && shared.Pdeathsig == 0, "The shared %T has been modified.", shared)
+}
+
+func TestLaunchSpec_NoNewPrivs(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	spec := &LaunchSpec{Path: "/bin/sleep", Args: []string{"sleep", "60"}, Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}, NoNewPrivs: true, Sys: &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}}
+	if process, err := spec.Start(); err == nil {
+		_ = process.Kill()
+		_, _ = process.Wait()
+		t.Fatal("Starting a process with no_new_privs and a parent death signal succeeded unexpectedly.")
+	}
+
+	spec.Sys = nil
+	process, err := spec.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = process.Kill()
+		_, _ = process.Wait()
+	}()
+
+	// Wait for the process to have exec'ed.
+	for i := 0; ; i++ {
+		if derived, err := LaunchSpecFromProcess(process.Pid); err == nil && slices.Equal(derived.Args, spec.Args) {
+			assert.Assert(t, derived.NoNewPrivs, "The no_new_privs flag has not been derived from the process.")
+			assert.NilError(t, derived.Close())
+			break
+		} else if i > 50 {
+			t.Fatalf("LaunchSpecFromProcess() = %v, %v", derived, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Processes started later on don't inherit no_new_privs from the thread.
+	for i := 0; i < 10; i++ {
+		other, err := (&LaunchSpec{Path: "/bin/sleep", Args: []string{"sleep", "60"}, Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}}).Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		attributes, err := launchSpec_Attributes(filepath.Join(ProcPath, strconv.Itoa(other.Pid), procPidStatusName))
+		_ = other.Kill()
+		_, _ = other.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Assert(t, !attributes.NoNewPrivs)
+	}
+}
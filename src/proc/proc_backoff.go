@@ -0,0 +1,151 @@
+//go:build linux
+
+package proc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// region Package globals
+
+const (
+	BACKOFF_SEPARATOR             = ","
+	BACKOFF_KEY_INITIAL_DELAY     = "initial"
+	BACKOFF_KEY_MULTIPLIER        = "multiplier"
+	BACKOFF_KEY_MAX_DELAY         = "max"
+	BACKOFF_KEY_JITTER            = "jitter"
+	BACKOFF_KEY_MAX_ATTEMPTS      = "attempts"
+	DEFAULT_BACKOFF_INITIAL_DELAY = 1 * time.Second
+	DEFAULT_BACKOFF_MULTIPLIER    = 2.0
+	DEFAULT_BACKOFF_MAX_DELAY     = 5 * time.Minute
+	DEFAULT_BACKOFF_JITTER        = 0.1
+	DEFAULT_BACKOFF_MAX_ATTEMPTS  = 0
+)
+
+// The backoff policy used with RecoveryModeBackoff if none is specified.
+var DefaultBackoffPolicy = BackoffPolicy{
+	InitialDelay: DEFAULT_BACKOFF_INITIAL_DELAY,
+	Multiplier:   DEFAULT_BACKOFF_MULTIPLIER,
+	MaxDelay:     DEFAULT_BACKOFF_MAX_DELAY,
+	Jitter:       DEFAULT_BACKOFF_JITTER,
+	MaxAttempts:  DEFAULT_BACKOFF_MAX_ATTEMPTS,
+}
+
+// region BackoffPolicy struct
+
+// Controls how long to wait before restarting a process with
+// RecoveryModeBackoff.
+//
+// The n-th consecutive restart is delayed by InitialDelay * Multiplier^(n-1),
+// but not more than MaxDelay. A process that keeps running for at least
+// MaxDelay is considered to have recovered, so the next restart is delayed by
+// InitialDelay again.
+type BackoffPolicy struct {
+	// The delay before the first restart.
+	InitialDelay time.Duration
+	// The factor the delay grows by with each consecutive restart (at least 1).
+	Multiplier float64
+	// The maximum delay (at least InitialDelay).
+	MaxDelay time.Duration
+	// The fraction (0 to 1) each delay is randomly reduced by, in order to
+	// avoid restarting processes depending on the same backend in lockstep.
+	Jitter float64
+	// How many consecutive restarts to attempt before giving up (0 means
+	// infinite).
+	MaxAttempts uint
+}
+
+// Returns an error if the backoff policy is not valid.
+func (p BackoffPolicy) Validate() error {
+	if p.InitialDelay <= 0 {
+		return fmt.Errorf("backoff initial delay must be positive (specified value is %s)", p.InitialDelay)
+	}
+	if p.Multiplier < 1 || math.IsInf(p.Multiplier, 0) || math.IsNaN(p.Multiplier) {
+		return fmt.Errorf("backoff multiplier must not be less than 1 (specified value is %v)", p.Multiplier)
+	}
+	if p.MaxDelay < p.InitialDelay {
+		return fmt.Errorf("backoff max delay must not be less than the initial delay %s (specified value is %s)", p.InitialDelay, p.MaxDelay)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 || math.IsNaN(p.Jitter) {
+		return fmt.Errorf("backoff jitter must be between 0 and 1 (specified value is %v)", p.Jitter)
+	}
+
+	return nil
+}
+
+// Returns the delay before the [attempt]-th consecutive restart (starting with
+// 1), reduced by Jitter * [random], where [random] is meant to be a random
+// number between 0 and 1.
+func (p BackoffPolicy) Delay(attempt uint, random float64) time.Duration {
+	delay := float64(p.InitialDelay)
+	if attempt > 1 {
+		delay *= math.Pow(p.Multiplier, float64(attempt-1))
+	}
+	delay = math.Min(delay, float64(p.MaxDelay))
+	delay -= delay * p.Jitter * math.Max(0, math.Min(1, random))
+
+	return time.Duration(delay)
+}
+
+// Returns the backoff policy in the format accepted by BackoffPolicyParse(),
+// e.g. `initial=1s,multiplier=2,max=5m0s,jitter=0.1,attempts=0`.
+func (p BackoffPolicy) String() string {
+	return strings.Join([]string{
+		BACKOFF_KEY_INITIAL_DELAY + "=" + p.InitialDelay.String(),
+		BACKOFF_KEY_MULTIPLIER + "=" + strconv.FormatFloat(p.Multiplier, 'g', -1, 64),
+		BACKOFF_KEY_MAX_DELAY + "=" + p.MaxDelay.String(),
+		BACKOFF_KEY_JITTER + "=" + strconv.FormatFloat(p.Jitter, 'g', -1, 64),
+		BACKOFF_KEY_MAX_ATTEMPTS + "=" + strconv.FormatUint(uint64(p.MaxAttempts), 10),
+	}, BACKOFF_SEPARATOR)
+}
+
+// Parses a backoff policy from a comma separated list of `key=value` pairs
+// (see BackoffPolicy.String() for the keys). Keys not present are taken from
+// [defaultPolicy].
+func BackoffPolicyParse(value string, defaultPolicy BackoffPolicy) (BackoffPolicy, error) {
+	policy := defaultPolicy
+
+	for _, pair := range strings.Split(value, BACKOFF_SEPARATOR) {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return defaultPolicy, fmt.Errorf("backoff policy item [%s] is not a key=value pair", pair)
+		}
+		key, val = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(val)
+
+		var err error
+		switch key {
+		case BACKOFF_KEY_INITIAL_DELAY:
+			policy.InitialDelay, err = time.ParseDuration(val)
+		case BACKOFF_KEY_MULTIPLIER:
+			policy.Multiplier, err = strconv.ParseFloat(val, 64)
+		case BACKOFF_KEY_MAX_DELAY:
+			policy.MaxDelay, err = time.ParseDuration(val)
+		case BACKOFF_KEY_JITTER:
+			policy.Jitter, err = strconv.ParseFloat(val, 64)
+		case BACKOFF_KEY_MAX_ATTEMPTS:
+			var attempts uint64
+			attempts, err = strconv.ParseUint(val, 10, 32)
+			policy.MaxAttempts = uint(attempts)
+		default:
+			return defaultPolicy, fmt.Errorf("backoff policy key [%s] is unknown", key)
+		}
+		if err != nil {
+			return defaultPolicy, fmt.Errorf("backoff policy item [%s] is not valid: %w", pair, err)
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return defaultPolicy, err
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,149 @@
+//go:build linux
+
+package proc
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestBackoffPolicyParse(t *testing.T) {
+	assert.Assert(t, DefaultBackoffPolicy.Validate() == nil)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    BackoffPolicy
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Empty", value: "", want: DefaultBackoffPolicy},
+		{name: "Default", value: DefaultBackoffPolicy.String(), want: DefaultBackoffPolicy},
+		{name: "Partial", value: " MAX = 1m , attempts=5,", want: BackoffPolicy{InitialDelay: time.Second, Multiplier: 2, MaxDelay: time.Minute, Jitter: 0.1, MaxAttempts: 5}},
+		{name: "Complete", value: "initial=500ms,multiplier=1.5,max=10s,jitter=0,attempts=0", want: BackoffPolicy{InitialDelay: 500 * time.Millisecond, Multiplier: 1.5, MaxDelay: 10 * time.Second}},
+		{name: "No pair", value: "initial", want: DefaultBackoffPolicy, wantErr: true},
+		{name: "Unknown key", value: "unknown=1", want: DefaultBackoffPolicy, wantErr: true},
+		{name: "Invalid value", value: "initial=1", want: DefaultBackoffPolicy, wantErr: true},
+		{name: "Negative attempts", value: "attempts=-1", want: DefaultBackoffPolicy, wantErr: true},
+		{name: "Zero initial delay", value: "initial=0s", want: DefaultBackoffPolicy, wantErr: true},
+		{name: "Small multiplier", value: "multiplier=0.5", want: DefaultBackoffPolicy, wantErr: true},
+		{name: "Small max delay", value: "initial=1m,max=1s", want: DefaultBackoffPolicy, wantErr: true},
+		{name: "Large jitter", value: "jitter=1.5", want: DefaultBackoffPolicy, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BackoffPolicyParse(tt.value, DefaultBackoffPolicy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BackoffPolicyParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestBackoffPolicy_Delay(t *testing.T) {
+	policy := BackoffPolicy{InitialDelay: time.Second, Multiplier: 2, MaxDelay: 10 * time.Second, Jitter: 0.5}
+
+	tests := []struct {
+		name    string
+		attempt uint
+		random  float64
+		want    time.Duration
+	}{
+		// Test cases.
+		{name: "First", attempt: 1, random: 0, want: time.Second},
+		{name: "Zero", attempt: 0, random: 0, want: time.Second},
+		{name: "Third", attempt: 3, random: 0, want: 4 * time.Second},
+		{name: "Max", attempt: 5, random: 0, want: 10 * time.Second},
+		{name: "Overflow", attempt: 10000, random: 0, want: 10 * time.Second},
+		{name: "Jitter", attempt: 2, random: 0.5, want: 1500 * time.Millisecond},
+		{name: "Full jitter", attempt: 2, random: 2, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Delay(tt.attempt, tt.random); got != tt.want {
+				t.Errorf("BackoffPolicy.Delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitorProcessWithOptions(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	start := func(t *testing.T) *os.Process {
+		process, err := os.StartProcess("/bin/sleep", []string{"sleep", "60"}, &os.ProcAttr{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetProcessInfoWithTimeout(5*time.Second, 100*time.Millisecond, process.Pid); err != nil {
+			t.Fatal(err)
+		}
+		return process
+	}
+	kill := func(t *testing.T, monitor *ProcessMonitor) {
+		if err := syscall.Kill(int(monitor.Status().ProcessInfo.Pid), syscall.SIGKILL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(t *testing.T, monitor *ProcessMonitor, condition func(ProcessMonitorStatus) bool) {
+		for i := 0; !condition(monitor.Status()); i++ {
+			if i > 100 {
+				t.Fatalf("The process monitor didn't reach the expected state (%#v).", monitor.Status())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	t.Run("Give up", func(t *testing.T) {
+		process := start(t)
+		monitor, err := MonitorProcessWithOptions(process.Pid, nil, MonitorOptions{RecoveryMode: RecoveryModeBackoff, Backoff: &BackoffPolicy{InitialDelay: 200 * time.Millisecond, Multiplier: 2, MaxDelay: time.Minute, MaxAttempts: 2}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for attempt := uint(1); attempt <= 2; attempt++ {
+			kill(t, monitor)
+			waitFor(t, monitor, func(status ProcessMonitorStatus) bool { return !status.NextRestart.IsZero() })
+			status := monitor.Status()
+			assert.Assert(t, status.Attempts == attempt, "Attempts = %d", status.Attempts)
+			assert.Assert(t, time.Until(status.NextRestart) <= time.Duration(attempt)*200*time.Millisecond)
+			waitFor(t, monitor, func(status ProcessMonitorStatus) bool { return status.Restarts == attempt })
+		}
+
+		kill(t, monitor)
+		select {
+		case <-time.After(5 * time.Second):
+			t.Error("MonitorProcessWithOptions() unexpectedly didn't give up.")
+		case err := <-monitor.chError:
+			assert.Assert(t, err != nil && err.Error() == "monitored process has been restarted 2 times in a row: giving up recovery", "chError = %v", err)
+		}
+	})
+
+	t.Run("Cancel while waiting", func(t *testing.T) {
+		process := start(t)
+		monitor, err := MonitorProcessWithOptions(process.Pid, nil, MonitorOptions{RecoveryMode: RecoveryModeBackoff, Backoff: &BackoffPolicy{InitialDelay: time.Minute, Multiplier: 1, MaxDelay: time.Minute}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kill(t, monitor)
+		waitFor(t, monitor, func(status ProcessMonitorStatus) bool { return !status.NextRestart.IsZero() })
+		if err := CancelProcess(monitor, 2*time.Second); err != nil {
+			t.Error(err)
+		}
+		assert.Assert(t, monitor.Status().Restarts == 0)
+	})
+
+	t.Run("Invalid policy", func(t *testing.T) {
+		if _, err := MonitorProcessWithOptions(os.Getpid(), nil, MonitorOptions{RecoveryMode: RecoveryModeBackoff, Backoff: &BackoffPolicy{}}); err == nil {
+			t.Error("MonitorProcessWithOptions() unexpectedly succeeded with an invalid backoff policy.")
+		}
+	})
+}
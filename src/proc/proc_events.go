@@ -0,0 +1,187 @@
+//go:build linux
+
+package proc
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// region Package globals
+
+const (
+	// How many events a process monitor keeps (see ProcessMonitor.Events()).
+	MAX_PROCESS_EVENT_HISTORY = 32
+	// The buffer size of subscriptions if none is specified.
+	DEFAULT_PROCESS_EVENT_BUFFER = 16
+)
+
+// region ProcessEventKind enum
+
+// The kind of a transition of a monitored process.
+type ProcessEventKind int
+
+const (
+	// The process has been started (or began being monitored).
+	ProcessEventStarted ProcessEventKind = iota
+	// The process has terminated.
+	ProcessEventExited
+	// The process is going to be restarted.
+	ProcessEventRestarting
+	// The process monitor gave up recovering the process.
+	ProcessEventGaveUp
+	// The process monitor has been cancelled.
+	ProcessEventCancelled
+	// The process is being killed, either by KillProcess() or since it failed
+	// liveness probes.
+	ProcessEventKilled
+	// The process terminated unexpectedly with RecoveryModeFail, so the
+	// process monitor stopped.
+	ProcessEventFailed
+)
+
+var processEventKindNames = map[ProcessEventKind]string{
+	ProcessEventStarted:    "Started",
+	ProcessEventExited:     "Exited",
+	ProcessEventRestarting: "Restarting",
+	ProcessEventGaveUp:     "GaveUp",
+	ProcessEventCancelled:  "Cancelled",
+	ProcessEventKilled:     "Killed",
+	ProcessEventFailed:     "Failed",
+}
+
+func ProcessEventKindNames() map[ProcessEventKind]string {
+	return processEventKindNames
+}
+
+func (k ProcessEventKind) String() string {
+	if v, ok := processEventKindNames[k]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(k))
+	}
+}
+
+func ProcessEventKindParse(name string, defaultProcessEventKind ProcessEventKind) ProcessEventKind {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultProcessEventKind
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range processEventKindNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultProcessEventKind
+}
+
+// region ProcessEvent struct
+
+// A transition of a monitored process.
+type ProcessEvent struct {
+	Kind ProcessEventKind
+	Time time.Time
+	// A snapshot of the process the event refers to.
+	ProcessInfo ProcessInfo
+	// The exit code of the process with ProcessEventExited and
+	// ProcessEventFailed (-1 if it has been terminated by a signal), 0
+	// otherwise.
+	ExitCode int
+	// A human readable description, e.g. the exit status or why the process
+	// monitor gave up.
+	Detail string
+}
+
+// region ProcessMonitor events
+
+// Records [event] in the history of the process monitor and sends it to all
+// subscribers. Subscribers not keeping up (i.e. with a full buffer) miss the
+// event rather than blocking the process monitor.
+func (m *ProcessMonitor) emit(kind ProcessEventKind, processInfo *ProcessInfo, exitCode int, detail string) {
+	event := ProcessEvent{Kind: kind, Time: time.Now(), ExitCode: exitCode, Detail: detail}
+	if processInfo != nil {
+		event.ProcessInfo = *processInfo
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.events = append(m.events, event)
+	if len(m.events) > MAX_PROCESS_EVENT_HISTORY {
+		m.events = m.events[len(m.events)-MAX_PROCESS_EVENT_HISTORY:]
+	}
+
+	for _, subscriber := range m.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			Logger.Debug("dropped process event for subscriber not keeping up", "kind", kind.String(), "pid", event.ProcessInfo.Pid)
+		}
+	}
+}
+
+// Closes the channels of all subscribers, once the process monitor terminated.
+func (m *ProcessMonitor) closeSubscribers() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.terminated = true
+	for id, subscriber := range m.subscribers {
+		close(subscriber)
+		delete(m.subscribers, id)
+	}
+}
+
+// Returns a channel receiving the events of the process monitor from now on
+// (see Events() for past events), buffering up to [buffer] events
+// (DEFAULT_PROCESS_EVENT_BUFFER if less than 1), and a function to unsubscribe.
+//
+// The channel is closed when unsubscribing or once the process monitor
+// terminated, i.e. after it's last event.
+func (m *ProcessMonitor) Subscribe(buffer int) (<-chan ProcessEvent, func()) {
+	if buffer < 1 {
+		buffer = DEFAULT_PROCESS_EVENT_BUFFER
+	}
+	subscriber := make(chan ProcessEvent, buffer)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.terminated {
+		close(subscriber)
+		return subscriber, func() {}
+	}
+
+	if m.subscribers == nil {
+		m.subscribers = map[uint]chan ProcessEvent{}
+	}
+	id := m.nextSubscriber
+	m.nextSubscriber++
+	m.subscribers[id] = subscriber
+
+	return subscriber, func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if subscriber, ok := m.subscribers[id]; ok {
+			close(subscriber)
+			delete(m.subscribers, id)
+		}
+	}
+}
+
+// Returns the last (up to MAX_PROCESS_EVENT_HISTORY) events of the process
+// monitor, oldest first.
+func (m *ProcessMonitor) Events() []ProcessEvent {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	events := make([]ProcessEvent, len(m.events))
+	copy(events, m.events)
+
+	return events
+}
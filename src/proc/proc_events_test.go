@@ -0,0 +1,141 @@
+//go:build linux
+
+package proc
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestProcessEventKind(t *testing.T) {
+	assert.Assert(t, len(ProcessEventKindNames()) == len(processEventKindNames))
+
+	tests := []struct {
+		name string
+		args string
+		want ProcessEventKind
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: ProcessEventKind(-1)},
+		{name: "Mixedcase", args: "\tgAvEuP ", want: ProcessEventGaveUp},
+		{name: "Unknown", args: "unknown", want: ProcessEventKind(-1)},
+		{name: "Default", args: "started", want: ProcessEventStarted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProcessEventKindParse(tt.args, ProcessEventKind(-1)); got != tt.want {
+				t.Errorf("ProcessEventKindParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessMonitor_Subscribe(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	process, err := os.StartProcess("/bin/sleep", []string{"sleep", "60"}, &os.ProcAttr{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetProcessInfoWithTimeout(5*time.Second, 100*time.Millisecond, process.Pid); err != nil {
+		t.Fatal(err)
+	}
+
+	monitor, err := MonitorProcessWithOptions(process.Pid, nil, MonitorOptions{RecoveryMode: RecoveryModeRestart})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _ := monitor.Subscribe(0)
+	other, unsubscribe := monitor.Subscribe(1)
+	unsubscribe()
+	if _, ok := <-other; ok {
+		t.Error("The channel of an unsubscribed subscriber has not been closed.")
+	}
+
+	receive := func(want ProcessEventKind) ProcessEvent {
+		select {
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No %s event has been received.", want.String())
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("The channel has been closed before a %s event has been received.", want.String())
+			}
+			assert.Assert(t, event.Kind == want, "Kind = %s, want %s (%#v)", event.Kind.String(), want.String(), event)
+			assert.Assert(t, time.Since(event.Time) < 10*time.Second)
+			return event
+		}
+		return ProcessEvent{}
+	}
+
+	if err := syscall.Kill(process.Pid, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	exited := receive(ProcessEventExited)
+	assert.Assert(t, exited.ExitCode == -1 && exited.Detail == "signal: killed", "%#v", exited)
+	assert.Assert(t, exited.ProcessInfo.Pid == uint64(process.Pid))
+	receive(ProcessEventRestarting)
+	started := receive(ProcessEventStarted)
+	assert.Assert(t, started.ProcessInfo.Pid != uint64(process.Pid))
+
+	if err := CancelProcess(monitor, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	receive(ProcessEventExited)
+	receive(ProcessEventCancelled)
+	if _, ok := <-events; ok {
+		t.Error("The channel has not been closed after the process monitor terminated.")
+	}
+
+	kinds := []ProcessEventKind{}
+	for _, event := range monitor.Events() {
+		kinds = append(kinds, event.Kind)
+	}
+	assert.DeepEqual(t, kinds, []ProcessEventKind{ProcessEventStarted, ProcessEventExited, ProcessEventRestarting, ProcessEventStarted, ProcessEventExited, ProcessEventCancelled})
+
+	late, _ := monitor.Subscribe(0)
+	if _, ok := <-late; ok {
+		t.Error("The channel of a subscriber of a terminated process monitor has not been closed.")
+	}
+}
+
+func TestProcessMonitor_Fail(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	process, err := os.StartProcess("/bin/sh", []string{"sh", "-c", "sleep 1; exit 3"}, &os.ProcAttr{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetProcessInfoWithTimeout(5*time.Second, 100*time.Millisecond, process.Pid); err != nil {
+		t.Fatal(err)
+	}
+
+	monitor, err := MonitorProcessWithOptions(process.Pid, nil, MonitorOptions{RecoveryMode: RecoveryModeFail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _ := monitor.Subscribe(0)
+
+	select {
+	case <-time.After(10 * time.Second):
+		t.Fatal("The process monitor didn't terminate.")
+	case err := <-monitor.chError:
+		assert.ErrorContains(t, err, "monitored process failed: exit status 3")
+	}
+
+	kinds := []ProcessEventKind{}
+	for event := range events {
+		kinds = append(kinds, event.Kind)
+		if event.Kind == ProcessEventFailed {
+			assert.Assert(t, event.ExitCode == 3 && event.Detail == "exit status 3", "%#v", event)
+		}
+	}
+	assert.DeepEqual(t, kinds, []ProcessEventKind{ProcessEventExited, ProcessEventFailed})
+}
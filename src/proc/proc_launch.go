@@ -0,0 +1,271 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	procPidEnvironName = "environ"
+	procPidCwdName     = "cwd"
+	procPidExeName     = "exe"
+	procPidFdName      = "fd"
+	procPidStatusName  = "status"
+	// Suffix the kernel appends to the target of /proc/<pid>/* symlinks whose
+	// file has been removed.
+	procPidDeletedSuffix = " (deleted)"
+)
+
+// Everything needed to (re)start a process the way it has been started
+// initially, as opposed to just it's command line.
+//
+// The fields correspond to the parameters of os.StartProcess().
+type LaunchSpec struct {
+	// Path of the executable.
+	Path string
+	// Command line arguments, starting with the program name.
+	Args []string
+	// Working directory, the current directory if empty.
+	Dir string
+	// Environment, the current environment if nil.
+	Env []string
+	// Open files, starting with stdin, stdout and stderr. Nil entries are
+	// closed in the started process.
+	Files []*os.File
+	// Operating system specific attributes (credentials, process group, ...).
+	Sys *syscall.SysProcAttr
+	// Whether to set no_new_privs for the process, which cannot gain
+	// privileges then (e.g. by executing setuid binaries). Cannot be combined
+	// with Sys.Pdeathsig.
+	NoNewPrivs bool
+}
+
+// Starts a new process according to the launch specification.
+//
+// Since no_new_privs cannot be set by means of syscall.SysProcAttr, it is set
+// for a dedicated thread starting the process, which is terminated afterwards
+// rather than being reused. The parent death signal is sent once the thread
+// starting the process terminates though, so both cannot be combined.
+func (s *LaunchSpec) Start() (*os.Process, error) {
+	attr := &os.ProcAttr{Dir: s.Dir, Env: s.Env, Files: s.Files, Sys: s.Sys}
+	if !s.NoNewPrivs {
+		return os.StartProcess(s.Path, s.Args, attr)
+	}
+	if s.Sys != nil && s.Sys.Pdeathsig != 0 {
+		return nil, errors.New("no_new_privs cannot be combined with a parent death signal")
+	}
+
+	type result struct {
+		process *os.Process
+		err     error
+	}
+	chResult := make(chan result, 1)
+	go func() {
+		// Never unlocked, so the thread terminates along with the goroutine.
+		runtime.LockOSThread()
+
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0, 0); errno != 0 {
+			chResult <- result{err: os.NewSyscallError("prctl", errno)}
+			return
+		}
+
+		process, err := os.StartProcess(s.Path, s.Args, attr)
+		chResult <- result{process: process, err: err}
+	}()
+
+	r := <-chResult
+	return r.process, r.err
+}
+
+// Closes the files of the launch specification, except for the standard files
+// of the current process (os.Stdin, os.Stdout and os.Stderr).
+func (s *LaunchSpec) Close() error {
+	closed := []*os.File{nil, os.Stdin, os.Stdout, os.Stderr}
+	errs := []error{}
+	for _, file := range s.Files {
+		if slices.Contains(closed, file) {
+			continue
+		}
+		closed = append(closed, file)
+
+		if err := file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Derives a launch specification from the running process [pid].
+//
+// The executable, command line, working directory and environment are taken
+// from procfs. Standard files referring to a path (e.g. a log file or
+// /dev/null) are reopened by that path, stdout and stderr for appending. Other
+// standard files (pipes, sockets, removed files, ...) as well as the other
+// open files cannot be recovered, so the standard files of the current process
+// are used instead, and no further files are set.
+//
+// Credentials, ambient capabilities and no_new_privs are recovered if they
+// differ from the ones of the current process, while other operating system
+// specific attributes (e.g. the parent death signal) are lost.
+//
+// Reading the environment of a process requires the same permissions as
+// tracing it. If it cannot be read, the current environment is used.
+func LaunchSpecFromProcess(pid int) (*LaunchSpec, error) {
+	processInfo, err := GetProcessInfo(pid)
+	if err != nil {
+		return nil, err
+	}
+	if len(processInfo.Cmdline) < 1 {
+		return nil, errors.New("process has no command line")
+	}
+
+	path := filepath.Join(ProcPath, strconv.Itoa(pid))
+	spec := &LaunchSpec{
+		Path: processInfo.Cmdline[0],
+		Args: processInfo.Cmdline,
+	}
+
+	if exe, err := launchSpec_Readlink(filepath.Join(path, procPidExeName)); err == nil {
+		spec.Path = exe
+	}
+
+	if dir, err := launchSpec_Readlink(filepath.Join(path, procPidCwdName)); err == nil {
+		spec.Dir = dir
+	}
+
+	if environ, err := os.ReadFile(filepath.Join(path, procPidEnvironName)); err != nil {
+		Logger.Debug("Failed to read the environment of the process.", "pid", pid, "err", err)
+	} else {
+		spec.Env = []string{}
+		for _, variable := range bytes.Split(environ, []byte{0}) {
+			if len(variable) > 0 {
+				spec.Env = append(spec.Env, string(variable))
+			}
+		}
+	}
+
+	opened := map[string]*os.File{}
+	for fd, stdFile := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		file := stdFile
+		if name, err := launchSpec_Readlink(filepath.Join(path, procPidFdName, strconv.Itoa(fd))); err == nil && filepath.IsAbs(name) {
+			if f, ok := opened[name]; ok && fd > 0 {
+				file = f
+			} else {
+				flag := os.O_WRONLY | os.O_APPEND
+				if fd == 0 {
+					flag = os.O_RDONLY
+				}
+				if f, err := os.OpenFile(name, flag, 0); err != nil {
+					Logger.Debug("Failed to reopen a standard file of the process.", "pid", pid, "fd", fd, "name", name, "err", err)
+				} else {
+					file = f
+					if fd > 0 {
+						opened[name] = f
+					}
+				}
+			}
+		}
+		spec.Files = append(spec.Files, file)
+	}
+
+	if attributes, err := launchSpec_Attributes(filepath.Join(path, procPidStatusName)); err != nil {
+		Logger.Debug("Failed to read the attributes of the process.", "pid", pid, "err", err)
+	} else {
+		attributes.Apply(spec)
+	}
+
+	return spec, nil
+}
+
+// Derives the process attributes differing from the ones of the current
+// process (i.e. credentials, ambient capabilities and no_new_privs) from the
+// procfs status file [name] of a process.
+func launchSpec_Attributes(name string) (ProcessAttributes, error) {
+	attributes := ProcessAttributes{}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return attributes, err
+	}
+	fields := map[string][]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = strings.Fields(value)
+		}
+	}
+
+	ids := []uint32{}
+	for _, key := range []string{"Uid", "Gid", "Groups"} {
+		if key != "Groups" && len(fields[key]) < 1 {
+			return attributes, fmt.Errorf("field [%s] is missing", key)
+		}
+		for i, field := range fields[key] {
+			if key != "Groups" && i > 0 {
+				// Only the real ID, followed by the effective, saved and file
+				// system ones.
+				break
+			}
+			id, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return attributes, err
+			}
+			ids = append(ids, uint32(id))
+		}
+	}
+	credential := syscall.Credential{Uid: ids[0], Gid: ids[1], Groups: ids[2:]}
+
+	current := []uint32{}
+	if groups, err := os.Getgroups(); err == nil {
+		for _, group := range groups {
+			current = append(current, uint32(group))
+		}
+	}
+	slices.Sort(current)
+	slices.Sort(credential.Groups)
+	if credential.Uid != uint32(os.Getuid()) || credential.Gid != uint32(os.Getgid()) || !slices.Equal(credential.Groups, current) {
+		attributes.Credential = &credential
+	}
+
+	if len(fields["NoNewPrivs"]) > 0 {
+		attributes.NoNewPrivs = fields["NoNewPrivs"][0] == "1"
+	}
+
+	if len(fields["CapAmb"]) > 0 {
+		mask, err := strconv.ParseUint(fields["CapAmb"][0], 16, 64)
+		if err != nil {
+			return attributes, err
+		}
+		for c := uintptr(0); c < 64; c++ {
+			if mask&(1<<c) != 0 {
+				attributes.AmbientCaps = append(attributes.AmbientCaps, c)
+			}
+		}
+	}
+
+	return attributes, nil
+}
+
+// Returns the target of the procfs symlink [name], unless the file it refers
+// to has been removed.
+func launchSpec_Readlink(name string) (string, error) {
+	target, err := os.Readlink(name)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(target, procPidDeletedSuffix) {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrNotExist}
+	}
+
+	return target, nil
+}
@@ -0,0 +1,183 @@
+//go:build linux
+
+package proc
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestLaunchSpecFromProcess(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	dir := t.TempDir()
+	out, err := os.OpenFile(filepath.Join(dir, "out"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	process, err := os.StartProcess("/bin/sleep", []string{"sleep", "60"}, &os.ProcAttr{Dir: dir, Env: []string{"TEST_VAR=test value"}, Files: []*os.File{os.Stdin, out, out}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = process.Kill()
+		_, _ = process.Wait()
+	}()
+
+	if _, err := GetProcessInfoWithTimeout(5*time.Second, 100*time.Millisecond, process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the process to have exec'ed.
+	for i := 0; ; i++ {
+		if spec, err := LaunchSpecFromProcess(process.Pid); err == nil && slices.Contains(spec.Env, "TEST_VAR=test value") {
+			if err := spec.Close(); err != nil {
+				t.Fatal(err)
+			}
+			break
+		} else if i > 50 {
+			t.Fatalf("LaunchSpecFromProcess() = %v, %v", spec, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	spec, err := LaunchSpecFromProcess(process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := spec.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	exe, err := filepath.EvalSymlinks("/bin/sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, spec.Path, exe)
+	assert.DeepEqual(t, spec.Args, []string{"sleep", "60"})
+	assert.Equal(t, spec.Dir, dir)
+	assert.DeepEqual(t, spec.Env, []string{"TEST_VAR=test value"})
+	assert.Assert(t, len(spec.Files) == 3)
+	assert.Assert(t, spec.Files[1] != out && spec.Files[1].Name() == out.Name(), "stdout = %v", spec.Files[1])
+	assert.Assert(t, spec.Files[2] == spec.Files[1], "stderr = %v", spec.Files[2])
+
+	if _, err := LaunchSpecFromProcess(-1); err == nil {
+		t.Error("LaunchSpecFromProcess() unexpectedly succeeded for an invalid PID.")
+	}
+}
+
+func TestMonitorProcessWithSpec(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	tests := []struct {
+		name    string
+		derived bool
+	}{
+		// Test cases.
+		{name: "Spec", derived: false},
+		{name: "Derived", derived: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "out")
+			out, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := &LaunchSpec{
+				Path:  "/bin/sh",
+				Args:  []string{"sh", "-c", `echo "$TEST_VAR $PWD"; exec /bin/sleep 60`},
+				Dir:   dir,
+				Env:   []string{"TEST_VAR=test value"},
+				Files: []*os.File{os.Stdin, out, out},
+			}
+			process, err := spec.Start()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Wait for the first line, so the process has exec'ed.
+			for i := 0; ; i++ {
+				if got, err := os.ReadFile(name); err == nil && len(got) > 0 {
+					break
+				} else if i > 50 {
+					t.Fatalf("The process didn't write it's first line (%v).", err)
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			var monitor *ProcessMonitor
+			if tt.derived {
+				if err := out.Close(); err != nil {
+					t.Fatal(err)
+				}
+				monitor, err = MonitorProcess(process.Pid, RecoveryModeRestart, nil)
+			} else {
+				monitor, err = MonitorProcessWithSpec(process.Pid, spec, RecoveryModeRestart, nil)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := syscall.Kill(process.Pid, syscall.SIGKILL); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; monitor.Status().Restarts < 1; i++ {
+				if i > 50 {
+					t.Fatal("The process has not been restarted.")
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			// The restarted process has the same environment, directory and files.
+			restarted, err := LaunchSpecFromProcess(int(monitor.Status().ProcessInfo.Pid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Assert(t, slices.Contains(restarted.Env, "TEST_VAR=test value"), "Env = %v", restarted.Env)
+			assert.Equal(t, restarted.Dir, dir)
+			assert.Assert(t, restarted.Files[1].Name() == name, "stdout = %v", restarted.Files[1])
+			if err := restarted.Close(); err != nil {
+				t.Error(err)
+			}
+
+			if !tt.derived {
+				want := "test value " + dir + "\n"
+				for i := 0; ; i++ {
+					if got, err := os.ReadFile(name); err != nil {
+						t.Fatal(err)
+					} else if strings.Count(string(got), "\n") > 1 {
+						assert.Equal(t, string(got), want+want)
+						break
+					} else if i > 50 {
+						t.Fatalf("The restarted process didn't write it's line (%q).", got)
+					}
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+
+			if err := CancelProcess(monitor, 5*time.Second); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	if _, err := MonitorProcessWithSpec(os.Getpid(), nil, RecoveryModeIgnore, nil); err == nil {
+		t.Error("MonitorProcessWithSpec() unexpectedly succeeded without a launch specification.")
+	}
+}
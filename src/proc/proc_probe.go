@@ -0,0 +1,238 @@
+//go:build linux
+
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// region Package globals
+
+const (
+	LIVENESS_SEPARATOR                 = ","
+	LIVENESS_KEY_INTERVAL              = "interval"
+	LIVENESS_KEY_TIMEOUT               = "timeout"
+	LIVENESS_KEY_FAILURE_THRESHOLD     = "failures"
+	DEFAULT_LIVENESS_INTERVAL          = 30 * time.Second
+	DEFAULT_LIVENESS_TIMEOUT           = 10 * time.Second
+	DEFAULT_LIVENESS_FAILURE_THRESHOLD = 3
+	// The name of the environment variable passing the PID of the monitored
+	// process to the command of an ExecProbe.
+	LIVENESS_PID_ENV = "PROBE_PID"
+)
+
+// The liveness policy settings used if none are specified (without any probes).
+var DefaultLivenessPolicy = LivenessPolicy{
+	Interval:         DEFAULT_LIVENESS_INTERVAL,
+	Timeout:          DEFAULT_LIVENESS_TIMEOUT,
+	FailureThreshold: DEFAULT_LIVENESS_FAILURE_THRESHOLD,
+}
+
+// region LivenessProbe interface
+
+// Checks whether a monitored process, which didn't terminate, is still alive.
+type LivenessProbe interface {
+	// Returns an error if [processInfo], as just read from procfs, doesn't
+	// appear to be alive. Must return once [ctx] is done.
+	Probe(ctx context.Context, processInfo *ProcessInfo) error
+	// Describes the probe for logging.
+	String() string
+}
+
+// Fails if Path (e.g. the mount point of a FUSE file system) cannot be stat'ed
+// before the timeout elapses.
+//
+// Since a stat call hanging on a dead file system cannot be interrupted, it
+// keeps running in the background after the timeout. The probe keeps failing
+// without issuing further stat calls until it returns.
+type StatProbe struct {
+	Path    string
+	pending chan error
+}
+
+func (p *StatProbe) Probe(ctx context.Context, processInfo *ProcessInfo) error {
+	if p.pending == nil {
+		p.pending = make(chan error, 1)
+		go func(pending chan<- error) {
+			_, err := os.Stat(p.Path)
+			pending <- err
+		}(p.pending)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("stat [%s] did not return in time: %w", p.Path, ctx.Err())
+	case err := <-p.pending:
+		p.pending = nil
+		return err
+	}
+}
+
+func (p *StatProbe) String() string {
+	return fmt.Sprintf("stat %s", p.Path)
+}
+
+// Fails if the process is in one of States, which defaults to Zombie and
+// Waiting (in uninterruptible disk sleep).
+//
+// Processes just passing through one of these states are not considered dead,
+// since a LivenessPolicy only gives up on a process after a number of
+// consecutive failures.
+type StateProbe struct {
+	States []ProcessStatus
+}
+
+func (p *StateProbe) Probe(ctx context.Context, processInfo *ProcessInfo) error {
+	states := p.States
+	if len(states) < 1 {
+		states = []ProcessStatus{Zombie, Waiting}
+	}
+
+	if slices.Contains(states, processInfo.State) {
+		return fmt.Errorf("process is in state %s", processInfo.State.String())
+	}
+
+	return nil
+}
+
+func (p *StateProbe) String() string {
+	return "state"
+}
+
+// Fails if the command Path (with Args, starting with the program name) exits
+// with a non-zero exit code or doesn't exit before the timeout elapses. The PID
+// of the monitored process is passed in the environment variable
+// LIVENESS_PID_ENV.
+type ExecProbe struct {
+	Path string
+	Args []string
+}
+
+func (p *ExecProbe) Probe(ctx context.Context, processInfo *ProcessInfo) error {
+	cmd := exec.CommandContext(ctx, p.Path)
+	if len(p.Args) > 0 {
+		cmd.Args = p.Args
+	}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", LIVENESS_PID_ENV, processInfo.Pid))
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func (p *ExecProbe) String() string {
+	if len(p.Args) < 1 {
+		return fmt.Sprintf("exec %s", p.Path)
+	}
+
+	return fmt.Sprintf("exec %s", strings.Join(p.Args, " "))
+}
+
+// region LivenessPolicy struct
+
+// Controls how a process monitor checks whether the monitored process is still
+// alive although it didn't terminate.
+//
+// Every Interval, all Probes are run with Timeout. After FailureThreshold
+// consecutive rounds with at least one failing probe, the process is killed,
+// so it is recovered according to the recovery mode just like a crashed one.
+type LivenessPolicy struct {
+	Probes           []LivenessProbe
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold uint
+}
+
+// Returns an error if the liveness policy is not valid.
+func (p LivenessPolicy) Validate() error {
+	if p.Interval <= 0 {
+		return fmt.Errorf("liveness interval must be positive (specified value is %s)", p.Interval)
+	}
+	if p.Timeout <= 0 || p.Timeout > p.Interval {
+		return fmt.Errorf("liveness timeout must be positive and not exceed the interval %s (specified value is %s)", p.Interval, p.Timeout)
+	}
+	if p.FailureThreshold < 1 {
+		return fmt.Errorf("liveness failure threshold must not be less than 1 (specified value is %d)", p.FailureThreshold)
+	}
+
+	return nil
+}
+
+// Returns the settings of the liveness policy (without the probes) in the
+// format accepted by LivenessPolicyParse(), e.g.
+// `interval=30s,timeout=10s,failures=3`.
+func (p LivenessPolicy) String() string {
+	return strings.Join([]string{
+		LIVENESS_KEY_INTERVAL + "=" + p.Interval.String(),
+		LIVENESS_KEY_TIMEOUT + "=" + p.Timeout.String(),
+		LIVENESS_KEY_FAILURE_THRESHOLD + "=" + strconv.FormatUint(uint64(p.FailureThreshold), 10),
+	}, LIVENESS_SEPARATOR)
+}
+
+// Parses the settings of a liveness policy from a comma separated list of
+// `key=value` pairs (see LivenessPolicy.String() for the keys). Keys not present
+// as well as the probes are taken from [defaultPolicy].
+func LivenessPolicyParse(value string, defaultPolicy LivenessPolicy) (LivenessPolicy, error) {
+	policy := defaultPolicy
+
+	for _, pair := range strings.Split(value, LIVENESS_SEPARATOR) {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return defaultPolicy, fmt.Errorf("liveness policy item [%s] is not a key=value pair", pair)
+		}
+		key, val = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(val)
+
+		var err error
+		switch key {
+		case LIVENESS_KEY_INTERVAL:
+			policy.Interval, err = time.ParseDuration(val)
+		case LIVENESS_KEY_TIMEOUT:
+			policy.Timeout, err = time.ParseDuration(val)
+		case LIVENESS_KEY_FAILURE_THRESHOLD:
+			var failures uint64
+			failures, err = strconv.ParseUint(val, 10, 32)
+			policy.FailureThreshold = uint(failures)
+		default:
+			return defaultPolicy, fmt.Errorf("liveness policy key [%s] is unknown", key)
+		}
+		if err != nil {
+			return defaultPolicy, fmt.Errorf("liveness policy item [%s] is not valid: %w", pair, err)
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return defaultPolicy, err
+	}
+
+	return policy, nil
+}
+
+// Runs all probes of [policy] against [processInfo] and returns the errors of
+// the failing ones.
+func (p LivenessPolicy) probe(processInfo *ProcessInfo) error {
+	errs := []error{}
+	for _, probe := range p.Probes {
+		ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+		if err := probe.Probe(ctx, processInfo); err != nil {
+			errs = append(errs, fmt.Errorf("liveness probe [%s] failed: %w", probe.String(), err))
+		}
+		cancel()
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package proc
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestLivenessPolicyParse(t *testing.T) {
+	assert.Assert(t, DefaultLivenessPolicy.Validate() == nil)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    LivenessPolicy
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Empty", value: "", want: DefaultLivenessPolicy},
+		{name: "Default", value: DefaultLivenessPolicy.String(), want: DefaultLivenessPolicy},
+		{name: "Partial", value: " Failures = 5 ,", want: LivenessPolicy{Interval: 30 * time.Second, Timeout: 10 * time.Second, FailureThreshold: 5}},
+		{name: "Complete", value: "interval=1m,timeout=1m,failures=1", want: LivenessPolicy{Interval: time.Minute, Timeout: time.Minute, FailureThreshold: 1}},
+		{name: "No pair", value: "interval", want: DefaultLivenessPolicy, wantErr: true},
+		{name: "Unknown key", value: "unknown=1", want: DefaultLivenessPolicy, wantErr: true},
+		{name: "Invalid value", value: "timeout=soon", want: DefaultLivenessPolicy, wantErr: true},
+		{name: "Zero interval", value: "interval=0s", want: DefaultLivenessPolicy, wantErr: true},
+		{name: "Large timeout", value: "timeout=1m", want: DefaultLivenessPolicy, wantErr: true},
+		{name: "Zero failures", value: "failures=0", want: DefaultLivenessPolicy, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LivenessPolicyParse(tt.value, DefaultLivenessPolicy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LivenessPolicyParse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.DeepEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestLivenessProbe(t *testing.T) {
+	processInfo := &ProcessInfo{Pid: 42, State: Sleeping}
+	waiting := &ProcessInfo{Pid: 42, State: Waiting}
+
+	tests := []struct {
+		name        string
+		probe       LivenessProbe
+		processInfo *ProcessInfo
+		wantErr     bool
+	}{
+		// Test cases.
+		{name: "Stat", probe: &StatProbe{Path: t.TempDir()}, processInfo: processInfo},
+		{name: "Stat missing", probe: &StatProbe{Path: "/nonexistent"}, processInfo: processInfo, wantErr: true},
+		{name: "State", probe: &StateProbe{}, processInfo: processInfo},
+		{name: "State waiting", probe: &StateProbe{}, processInfo: waiting, wantErr: true},
+		{name: "State custom", probe: &StateProbe{States: []ProcessStatus{Sleeping}}, processInfo: processInfo, wantErr: true},
+		{name: "Exec", probe: &ExecProbe{Path: "/bin/sh", Args: []string{"sh", "-c", `test "$` + LIVENESS_PID_ENV + `" = 42`}}, processInfo: processInfo},
+		{name: "Exec failing", probe: &ExecProbe{Path: "/bin/false"}, processInfo: processInfo, wantErr: true},
+		{name: "Exec timeout", probe: &ExecProbe{Path: "/bin/sleep", Args: []string{"sleep", "10"}}, processInfo: processInfo, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			if err := tt.probe.Probe(ctx, tt.processInfo); (err != nil) != tt.wantErr {
+				t.Errorf("%s.Probe() error = %v, wantErr %v", tt.probe.String(), err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMonitorProcessWithOptions_Liveness(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	process, err := os.StartProcess("/bin/sleep", []string{"sleep", "60"}, &os.ProcAttr{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetProcessInfoWithTimeout(5*time.Second, 100*time.Millisecond, process.Pid); err != nil {
+		t.Fatal(err)
+	}
+
+	monitor, err := MonitorProcessWithOptions(process.Pid, nil, MonitorOptions{
+		RecoveryMode: RecoveryModeRestart,
+		Liveness:     &LivenessPolicy{Probes: []LivenessProbe{&ExecProbe{Path: "/bin/false"}}, Interval: 200 * time.Millisecond, Timeout: 100 * time.Millisecond, FailureThreshold: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The process is killed and restarted just like a crashed one.
+	for i := 0; monitor.Status().Restarts < 1; i++ {
+		if i > 50 {
+			t.Fatalf("The hanging process has not been restarted (%#v).", monitor.Status())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	status := monitor.Status()
+	assert.Assert(t, status.LivenessKills >= 1, "LivenessKills = %d", status.LivenessKills)
+	assert.Assert(t, status.ProcessInfo.Pid != uint64(process.Pid))
+
+	if err := CancelProcess(monitor, 5*time.Second); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := MonitorProcessWithOptions(os.Getpid(), nil, MonitorOptions{Liveness: &LivenessPolicy{Probes: []LivenessProbe{&StateProbe{}}}}); err == nil {
+		t.Error("MonitorProcessWithOptions() unexpectedly succeeded with an invalid liveness policy.")
+	}
+}
@@ -17,14 +17,30 @@ const (
 	RecoveryModeIgnore RecoveryMode = iota
 	// Restart the process persistently.
 	RecoveryModeRestart
-	// Panic on unexpected (i.e. uncancelled) process termination.
-	RecoveryModePanic
+	// Stop monitoring on unexpected (i.e. uncancelled) process termination,
+	// reporting it as failed (see ProcessEventFailed) rather than restarting
+	// it.
+	RecoveryModeFail
+	// Restart the process after a delay growing with each consecutive restart
+	// (see BackoffPolicy).
+	RecoveryModeBackoff
 )
 
+// Deprecated: RecoveryModePanic used to panic, taking down the whole process
+// along with the process monitor. Use RecoveryModeFail instead, which it is an
+// alias of now.
+const RecoveryModePanic = RecoveryModeFail
+
 var recoveryModeNames = map[RecoveryMode]string{
 	RecoveryModeIgnore:  "Ignore",
 	RecoveryModeRestart: "Restart",
-	RecoveryModePanic:   "Panic",
+	RecoveryModeFail:    "Fail",
+	RecoveryModeBackoff: "Backoff",
+}
+
+// Names still accepted by RecoveryModeParse() for compatibility.
+var recoveryModeAliases = map[string]RecoveryMode{
+	"panic": RecoveryModeFail,
 }
 
 func RecoveryModeNames() map[RecoveryMode]string {
@@ -51,6 +67,9 @@ func RecoveryModeParse(name string, defaultRecoveryMode RecoveryMode) RecoveryMo
 			return k
 		}
 	}
+	if k, ok := recoveryModeAliases[name]; ok {
+		return k
+	}
 
 	return defaultRecoveryMode
 }
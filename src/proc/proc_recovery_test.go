@@ -25,7 +25,8 @@ func TestRecoveryMode(t *testing.T) {
 	}{
 		// Test cases.
 		{name: "Empty", args: args{name: "", defaultRecoveryMode: RecoveryMode(-1)}, want: RecoveryMode(-1)},
-		{name: "Mixedcase", args: args{name: "\tpANiC ", defaultRecoveryMode: RecoveryModePanic}, want: RecoveryModePanic, assertName: 2},
+		{name: "Mixedcase", args: args{name: "\tfAiL ", defaultRecoveryMode: RecoveryModeFail}, want: RecoveryModeFail, assertName: 2},
+		{name: "Alias", args: args{name: "Panic", defaultRecoveryMode: RecoveryModeRestart}, want: RecoveryModeFail},
 		{name: "Unknown", args: args{name: "unknown", defaultRecoveryMode: RecoveryModeRestart}, want: RecoveryModeRestart},
 		{name: "Default", args: args{name: "Ignore", defaultRecoveryMode: RecoveryModeRestart}, want: RecoveryModeIgnore, assertName: 1},
 	}
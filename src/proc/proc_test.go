@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -298,9 +299,7 @@ func TestMonitorProcess(t *testing.T) {
 		// Test cases.
 		{name: "Default", args: args{process: processes[0], recoveryMode: RecoveryModeIgnore}, action: func(t *testing.T, wantErr bool, monitor *ProcessMonitor) {
 			time.Sleep(2 * time.Second)
-			monitor.cancel = true
-
-			if err := monitor.Process.Signal(os.Interrupt); err != nil {
+			if err := monitor.setCancel(os.Interrupt); err != nil {
 				t.Errorf("Signal() error = %v, wantErr %v", err, wantErr)
 				return
 			}
@@ -321,13 +320,20 @@ func TestMonitorProcess(t *testing.T) {
 		{name: "Restart", args: args{process: processes[1], recoveryMode: RecoveryModeRestart}, action: func(t *testing.T, wantErr bool, monitor *ProcessMonitor) {
 			time.Sleep(2 * time.Second)
 
-			if err := monitor.Process.Signal(os.Interrupt); err != nil {
+			if err := monitor.signal(os.Interrupt); err != nil {
 				t.Errorf("Signal() error = %v, wantErr %v", err, wantErr)
 				return
 			}
 
 			time.Sleep(2 * time.Second)
 
+			status := monitor.Status()
+			assert.Assert(t, status.Restarts == 1, "Restarts = %d", status.Restarts)
+			assert.Assert(t, status.RestartRate == 1, "RestartRate = %d", status.RestartRate)
+			assert.Assert(t, status.RestartRateDuration == time.Minute)
+			assert.Assert(t, status.RecoveryMode == RecoveryModeRestart)
+			assert.Assert(t, status.ProcessInfo.Pid != uint64(processes[1].Pid))
+
 			if err := CancelProcess(monitor, 10*time.Second); err != nil {
 				t.Errorf("CancelProces() error = %v, wantErr %v", err, wantErr)
 				return
@@ -343,7 +349,7 @@ func TestMonitorProcess(t *testing.T) {
 		}},
 		{name: "Restart too often", args: args{process: processes[3], recoveryMode: RecoveryModeRestart}, action: func(t *testing.T, wantErr bool, monitor *ProcessMonitor) {
 			for i := 0; i < 4; i++ {
-				if err := monitor.Process.Signal(os.Interrupt); err != nil {
+				if err := monitor.signal(os.Interrupt); err != nil {
 					t.Errorf("Signal() error = %v, wantErr %v", err, wantErr)
 					break
 				}
@@ -375,3 +381,48 @@ func TestMonitorProcess(t *testing.T) {
 		})
 	}
 }
+
+func TestCancelProcess_Restarting(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	for i := 0; i < 5; i++ {
+		process, err := os.StartProcess("/bin/sleep", []string{"sleep", "60"}, &os.ProcAttr{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GetProcessInfoWithTimeout(5*time.Second, 100*time.Millisecond, process.Pid); err != nil {
+			t.Fatal(err)
+		}
+
+		monitor, err := MonitorProcessWithOptions(process.Pid, nil, MonitorOptions{RecoveryMode: RecoveryModeRestart})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, _ := monitor.Subscribe(0)
+
+		// Cancel the process monitor while it restarts the process.
+		if err := process.Kill(); err != nil {
+			t.Fatal(err)
+		}
+		for restarting := false; !restarting; {
+			select {
+			case event := <-events:
+				restarting = event.Kind == ProcessEventRestarting
+			case <-time.After(5 * time.Second):
+				t.Fatal("The process is not being restarted.")
+			}
+		}
+		if err := CancelProcess(monitor, 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+
+		// The restarted process, if any, must not be left running.
+		pid := int(monitor.Status().ProcessInfo.Pid)
+		if err := syscall.Kill(pid, 0); err == nil {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("The process %d has been left running after cancelling the process monitor.", pid)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+//go:build linux
+
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// region Package globals
+
+const (
+	// The number of the pidfd_open system call, which is the same on all
+	// architectures, but not defined by package syscall.
+	SYS_PIDFD_OPEN = 434
+	// How often procfs is polled for the termination of processes which are not
+	// children of the current process, if pidfds are not available.
+	DEFAULT_FOREIGN_POLL_INTERVAL = 1 * time.Second
+)
+
+var (
+	// How often waitForeign() polls procfs, if pidfds are not available.
+	ForeignPollInterval = DEFAULT_FOREIGN_POLL_INTERVAL
+	// Returned by waitPidfd() if the process cannot be watched by means of a
+	// pidfd.
+	errPidfdUnavailable = errors.New("pidfd is not available")
+)
+
+// region Waiting for processes
+
+// Waits for the monitored process to terminate and returns it's exit code and a
+// description of how it terminated.
+//
+// Only the parent of a process can wait for it, while os.Process.Wait() fails
+// with ECHILD for other processes (e.g. volume processes picked up after a
+// plugin restart, which have been reparented). These are watched by
+// waitForeign() instead, so their exit status is unknown.
+func (m *ProcessMonitor) wait() (int, string, error) {
+	m.mutex.Lock()
+	process, processInfo := m.Process, m.ProcessInfo
+	m.mutex.Unlock()
+
+	processState, err := process.Wait()
+	if err == nil {
+		Logger.Debug(processState.String(), "pid", process.Pid, "processState", fmt.Sprintf("%#v", processState))
+		return processState.ExitCode(), processState.String(), nil
+	} else if !errors.Is(err, syscall.ECHILD) {
+		return 0, "", err
+	}
+
+	Logger.Debug("Monitored process is not a child process, watching it's termination.", "pid", process.Pid)
+	if err := waitForeign(processInfo); err != nil {
+		return 0, "", err
+	}
+
+	return -1, "terminated (exit status unknown, not a child process)", nil
+}
+
+// Waits for [processInfo], which is not a child of the current process, to
+// terminate (including becoming a zombie).
+//
+// The process is watched by means of a pidfd becoming readable once it
+// terminates. If pidfds are not available (before Linux 5.3 or if pidfd_open
+// is blocked by seccomp), procfs is polled every ForeignPollInterval instead.
+func waitForeign(processInfo *ProcessInfo) error {
+	if err := waitPidfd(processInfo); !errors.Is(err, errPidfdUnavailable) {
+		return err
+	}
+
+	return waitPoll(processInfo.UniqueId(), ForeignPollInterval)
+}
+
+// Waits for [processInfo] to terminate by polling a pidfd referring to it.
+// Returns an error wrapping errPidfdUnavailable if no pidfd can be opened.
+func waitPidfd(processInfo *ProcessInfo) error {
+	fd, _, errno := syscall.Syscall(SYS_PIDFD_OPEN, uintptr(processInfo.Pid), 0, 0)
+	if errno == syscall.ESRCH {
+		return nil
+	} else if errno != 0 {
+		return fmt.Errorf("%w: %w", errPidfdUnavailable, os.NewSyscallError("pidfd_open", errno))
+	}
+	defer syscall.Close(int(fd))
+
+	// The PID may have been reused before the pidfd has been opened.
+	if _, err := GetProcessInfoFromUniqueId(processInfo.UniqueId()); err != nil {
+		Logger.Debug("Process has terminated before it's pidfd has been opened.", "pid", processInfo.Pid, "err", err)
+		return nil
+	}
+
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("epoll_create1", err)
+	}
+	defer syscall.Close(epfd)
+
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, int(fd), &event); err != nil {
+		return os.NewSyscallError("epoll_ctl", err)
+	}
+
+	events := make([]syscall.EpollEvent, 1)
+	for {
+		if n, err := syscall.EpollWait(epfd, events, -1); err != nil && !errors.Is(err, syscall.EINTR) {
+			return os.NewSyscallError("epoll_wait", err)
+		} else if n > 0 {
+			return nil
+		}
+	}
+}
+
+// Waits for the process [uniqueId] to terminate by checking every [interval]
+// whether it still exists, i.e. neither it's PID is gone or has been reused
+// (see GetProcessInfoFromUniqueId()), nor it has become a zombie.
+func waitPoll(uniqueId string, interval time.Duration) error {
+	for {
+		if processInfo, err := GetProcessInfoFromUniqueId(uniqueId); err != nil {
+			Logger.Debug("Polled process has terminated.", "uniqueId", uniqueId, "err", err)
+			return nil
+		} else if processInfo.State == Zombie || processInfo.State == Dead {
+			return nil
+		}
+
+		time.Sleep(interval)
+	}
+}
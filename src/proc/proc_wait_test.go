@@ -0,0 +1,131 @@
+//go:build linux
+
+package proc
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+// Starts [command] in the background of a shell, which exits right away, so
+// the process started is not a child of the current process.
+func startForeignProcess(t *testing.T, command string) *ProcessInfo {
+	output, err := exec.Command("/bin/sh", "-c", command+" </dev/null >/dev/null 2>&1 & echo $!").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = syscall.Kill(pid, syscall.SIGKILL) })
+
+	processInfo, err := GetProcessInfoWithTimeout(5*time.Second, 100*time.Millisecond, pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return processInfo
+}
+
+func TestWaitForeign(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	tests := []struct {
+		name string
+		wait func(processInfo *ProcessInfo) error
+	}{
+		// Test cases.
+		{name: "Pidfd", wait: waitPidfd},
+		{name: "Poll", wait: func(processInfo *ProcessInfo) error { return waitPoll(processInfo.UniqueId(), 100*time.Millisecond) }},
+		{name: "Default", wait: waitForeign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processInfo := startForeignProcess(t, "sleep 60")
+
+			done := make(chan error, 1)
+			go func() { done <- tt.wait(processInfo) }()
+
+			select {
+			case err := <-done:
+				if errors.Is(err, errPidfdUnavailable) {
+					t.Skip(err)
+				}
+				t.Fatalf("Waiting returned before the process terminated (%v).", err)
+			case <-time.After(500 * time.Millisecond):
+			}
+
+			if err := syscall.Kill(int(processInfo.Pid), syscall.SIGKILL); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case err := <-done:
+				if errors.Is(err, errPidfdUnavailable) {
+					t.Skip(err)
+				}
+				assert.NilError(t, err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("Waiting didn't return after the process terminated.")
+			}
+
+			// Waiting for a process which is gone already returns right away.
+			assert.NilError(t, tt.wait(processInfo))
+		})
+	}
+}
+
+func TestMonitorProcess_Foreign(t *testing.T) {
+	if Logger == nil {
+		Logger = logger
+	}
+
+	processInfo := startForeignProcess(t, "sleep 60")
+
+	monitor, err := MonitorProcessWithOptions(int(processInfo.Pid), nil, MonitorOptions{RecoveryMode: RecoveryModeRestart})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _ := monitor.Subscribe(0)
+
+	// Waiting for a process which is not a child process used to fail right
+	// away, so the process monitor gave up.
+	select {
+	case event := <-events:
+		t.Fatalf("The process monitor emitted an event although the process is still running (%#v).", event)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := syscall.Kill(int(processInfo.Pid), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := []ProcessEventKind{}
+	for len(kinds) < 3 {
+		select {
+		case event := <-events:
+			kinds = append(kinds, event.Kind)
+			if event.Kind == ProcessEventExited {
+				assert.Assert(t, event.ExitCode == -1 && strings.Contains(event.Detail, "exit status unknown"), "%#v", event)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("The process has not been restarted (%v).", kinds)
+		}
+	}
+	assert.DeepEqual(t, kinds, []ProcessEventKind{ProcessEventExited, ProcessEventRestarting, ProcessEventStarted})
+	assert.Assert(t, monitor.Status().ProcessInfo.Pid != processInfo.Pid)
+
+	if err := CancelProcess(monitor, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thorbenw/docker-volume-plugin/proc"
+)
+
+const (
+	DefaultReconcileInterval = 5 * time.Minute
+)
+
+// region ReconcileMode enum
+
+// What the reconciler does about drifts between the volume information, the
+// file system and the volume processes.
+type ReconcileMode int
+
+const (
+	// Don't reconcile at all.
+	ReconcileModeOff ReconcileMode = iota
+	// Only log the drifts found (dry run).
+	ReconcileModeReport
+	// Log and repair the drifts found.
+	ReconcileModeRepair
+)
+
+var reconcileModeNames = map[ReconcileMode]string{
+	ReconcileModeOff:    "Off",
+	ReconcileModeReport: "Report",
+	ReconcileModeRepair: "Repair",
+}
+
+func ReconcileModeNames() map[ReconcileMode]string {
+	return reconcileModeNames
+}
+
+func (m ReconcileMode) String() string {
+	if v, ok := reconcileModeNames[m]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(m))
+	}
+}
+
+func ReconcileModeParse(name string, defaultReconcileMode ReconcileMode) ReconcileMode {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultReconcileMode
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range reconcileModeNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultReconcileMode
+}
+
+// region ReconcileDrift struct
+
+type ReconcileDriftKind string
+
+const (
+	// A folder in the propagated mount that no volume refers to.
+	ReconcileDriftOrphanFolder ReconcileDriftKind = "OrphanFolder"
+	// A volume whose folder doesn't exist.
+	ReconcileDriftMissingFolder ReconcileDriftKind = "MissingFolder"
+	// A mount with a reference count below 1.
+	ReconcileDriftStaleMount ReconcileDriftKind = "StaleMount"
+	// A mount whose lease has expired (see pluginDriverMount).
+	ReconcileDriftExpiredMount ReconcileDriftKind = "ExpiredMount"
+	// A volume whose volume process is not running anymore.
+	ReconcileDriftDeadProcess ReconcileDriftKind = "DeadProcess"
+	// A volume whose volume process has been restarted by it's process
+	// monitor, so the PUID refers to the previous process.
+	ReconcileDriftRestartedProcess ReconcileDriftKind = "RestartedProcess"
+)
+
+// A single drift found by pluginDriver.Reconcile().
+type ReconcileDrift struct {
+	Kind ReconcileDriftKind
+	// The name of the volume, if any.
+	Volume string
+	// The (absolute) path of the folder concerned.
+	Path string
+	// What has been found (and done).
+	Detail   string
+	Repaired bool
+	Err      error
+}
+
+// Returns whether the process identified by [puid] exists and has not
+// terminated yet.
+func reconcile_Alive(puid string) bool {
+	if prc, err := proc.GetProcessInfoFromUniqueId(puid); err != nil {
+		return false
+	} else {
+		return prc.State != proc.Zombie && prc.State != proc.Dead
+	}
+}
+
+// region pluginDriver reconciliation
+
+// Compares the volume information to the file system and the volume processes,
+// logs all drifts found and, if [mode] is ReconcileModeRepair, repairs them.
+//
+// Orphan folders are only removed if empty, and are not looked for at all with
+// VolumeScopeGlobal, since they may belong to volumes of other nodes. Files and
+// folders whose names start with a dot are never considered orphans.
+func (d pluginDriver) Reconcile(mode ReconcileMode) []ReconcileDrift {
+	drifts := []ReconcileDrift{}
+	if mode == ReconcileModeOff {
+		return drifts
+	}
+
+	repair := mode == ReconcileModeRepair
+	if repair {
+		d.RWMutex.Lock()
+		defer d.RWMutex.Unlock()
+	} else {
+		d.RWMutex.RLock()
+		defer d.RWMutex.RUnlock()
+	}
+
+	if d.Scope != VolumeScopeGlobal {
+		drifts = append(drifts, d.reconcileFolders(repair)...)
+	}
+
+	names := make([]string, 0, len(d.Volumes))
+	for name := range d.Volumes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		vol := d.Volumes[name]
+		volumeDrifts := d.reconcileVolume(name, &vol, repair)
+		if len(volumeDrifts) < 1 {
+			continue
+		}
+		drifts = append(drifts, volumeDrifts...)
+
+		if repair {
+			d.Volumes[name] = vol
+			if err := d.Store.Put(name, vol); err != nil {
+				d.Logger.Error("Persisting the repaired volume failed.", "err", err, "volume", name)
+			}
+		}
+	}
+
+	repaired := 0
+	for _, drift := range drifts {
+		args := []any{"mode", mode.String(), "kind", drift.Kind, "volume", drift.Volume, "path", drift.Path, "detail", drift.Detail, "repaired", drift.Repaired}
+		if drift.Err != nil {
+			args = append(args, "err", drift.Err)
+		}
+		d.Logger.Warn("Reconciler found a drift.", args...)
+
+		if drift.Repaired {
+			repaired++
+		}
+	}
+
+	if len(drifts) > 0 {
+		d.Logger.Info("Reconciled volumes.", "mode", mode.String(), "volumes", len(d.Volumes), "drifts", len(drifts), "repaired", repaired)
+	} else {
+		d.Logger.Debug("Reconciled volumes.", "mode", mode.String(), "volumes", len(d.Volumes), "drifts", 0)
+	}
+
+	return drifts
+}
+
+// Looks for folders in the propagated mount that no volume refers to.
+func (d pluginDriver) reconcileFolders(repair bool) []ReconcileDrift {
+	drifts := []ReconcileDrift{}
+
+	entries, err := os.ReadDir(d.PropagatedMount)
+	if err != nil {
+		d.Logger.Error("Reconciler failed reading the propagated mount.", "err", err)
+		return drifts
+	}
+
+	known := map[string]bool{}
+	for _, vol := range d.Volumes {
+		known[vol.Path] = true
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || known[entry.Name()] {
+			continue
+		}
+
+		drift := ReconcileDrift{Kind: ReconcileDriftOrphanFolder, Path: filepath.Join(d.PropagatedMount, entry.Name()), Detail: "no volume refers to the folder"}
+		if marker, err := pluginDriverVolumeMarker_Read(drift.Path); err == nil {
+			drift.Volume = marker.Name
+			if marker.RemovedAt != nil {
+				drift.Detail = fmt.Sprintf("the folder has been retained when removing the volume at %s", marker.RemovedAt.Format(time.RFC3339))
+			}
+		}
+		if repair {
+			if drift.Err = removal_RemoveEmptyFolder(drift.Path); drift.Err == nil {
+				drift.Detail = "removed the empty folder"
+				drift.Repaired = true
+			} else {
+				drift.Detail = "left the folder alone, since it can't be removed (e.g. because it's not empty)"
+			}
+		}
+		drifts = append(drifts, drift)
+	}
+
+	return drifts
+}
+
+// Checks the folder, the mounts and the volume process of the volume [name].
+func (d pluginDriver) reconcileVolume(name string, vol *pluginDriverVolume, repair bool) []ReconcileDrift {
+	drifts := []ReconcileDrift{}
+
+	if _, err := os.Lstat(vol.MountPoint()); errors.Is(err, fs.ErrNotExist) {
+		drift := ReconcileDrift{Kind: ReconcileDriftMissingFolder, Volume: name, Path: vol.MountPoint(), Detail: "the volume folder doesn't exist"}
+		if repair {
+			if drift.Err = os.MkdirAll(vol.MountPoint(), DefaultVolumeFolderMode); drift.Err == nil {
+				if drift.Err = vol.Marker(name).Write(vol.MountPoint()); drift.Err == nil {
+					drift.Detail = "recreated the volume folder"
+					drift.Repaired = true
+				}
+			}
+		}
+		drifts = append(drifts, drift)
+	}
+
+	if vol.Mounts != nil && len(*vol.Mounts) > 0 {
+		mounts := *vol.Mounts
+		ids := []string{}
+		for id := range mounts {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+
+		now := time.Now()
+		for _, id := range ids {
+			mount := mounts[id]
+			var drift ReconcileDrift
+			if mount.ReferenceCount < 1 {
+				drift = ReconcileDrift{Kind: ReconcileDriftStaleMount, Volume: name, Path: vol.MountPoint(), Detail: fmt.Sprintf("mount [%s] has a reference count of %d", id, mount.ReferenceCount)}
+			} else if mount.Expired(d.MountLease, now) {
+				drift = ReconcileDrift{Kind: ReconcileDriftExpiredMount, Volume: name, Path: vol.MountPoint(), Detail: fmt.Sprintf("mount [%s] has not been renewed since %s", id, mount.RenewedAt.Format(time.RFC3339))}
+			} else {
+				continue
+			}
+
+			if repair {
+				delete(mounts, id)
+				drift.Detail = fmt.Sprintf("unregistered mount [%s]", id)
+				drift.Repaired = true
+			}
+			drifts = append(drifts, drift)
+		}
+
+		// Like Unmount() does when the last mount is unregistered.
+		if repair && len(drifts) > 0 && vol.ReferenceCount() < 1 && strings.TrimSpace(vol.Puid) != "" {
+			if lifecycle, err := vol.Lifecycle(&d); err == nil && lifecycle == VolumeProcessLifecycleMount {
+				if err := vol.StopProcess(&d); err != nil {
+					d.Logger.Warn("Failed terminating volume process.", "err", err, "volume", name)
+				}
+			}
+		}
+	}
+
+	if strings.TrimSpace(vol.Puid) == "" {
+		return drifts
+	}
+
+	current := vol.Puid
+	var nextRestart time.Time
+	gaveUp := false
+	if processMonitor, ok := processMonitors_Load(vol.Puid); ok {
+		status := processMonitor.Status()
+		current = status.ProcessInfo.UniqueId()
+		nextRestart = status.NextRestart
+		if events := processMonitor.Events(); len(events) > 0 {
+			gaveUp = events[len(events)-1].Kind == proc.ProcessEventGaveUp
+		}
+	}
+
+	// The process monitor is about to restart the volume process, so it must
+	// not be replaced.
+	if !nextRestart.IsZero() {
+		d.Logger.Debug("Reconciler skipped a volume process waiting to be restarted.", "volume", name, "next", nextRestart.Format(time.RFC3339))
+		return drifts
+	}
+
+	if current != vol.Puid && reconcile_Alive(current) {
+		drift := ReconcileDrift{Kind: ReconcileDriftRestartedProcess, Volume: name, Path: vol.MountPoint(), Detail: fmt.Sprintf("the volume process has been restarted as [%s]", current)}
+		if repair {
+			processMonitors_Move(vol.Puid, current)
+			vol.Puid = current
+			drift.Detail = fmt.Sprintf("updated the PUID to the restarted volume process [%s]", current)
+			drift.Repaired = true
+		}
+		drifts = append(drifts, drift)
+	} else if !reconcile_Alive(current) {
+		drift := ReconcileDrift{Kind: ReconcileDriftDeadProcess, Volume: name, Path: vol.MountPoint(), Detail: fmt.Sprintf("the volume process [%s] is not running", current)}
+
+		// Only volume processes meant to be recovered are replaced, unless
+		// their process monitor gave up doing so.
+		recoveryMode, err := vol.RecoveryMode(&d)
+		if err != nil {
+			recoveryMode = d.VolumeProcessRecoveryMode
+		}
+		if recoveryMode != proc.RecoveryModeRestart && recoveryMode != proc.RecoveryModeBackoff {
+			drift.Detail = fmt.Sprintf("%s, which is left alone with recovery mode %s", drift.Detail, recoveryMode)
+		} else if gaveUp {
+			drift.Detail = fmt.Sprintf("%s, which is left alone since it's process monitor gave up recovering it", drift.Detail)
+		} else if repair {
+			if err := vol.StopProcess(&d); err != nil {
+				d.Logger.Debug("Stopping the dead volume process failed.", "err", err, "volume", name)
+			}
+			drift.Detail = "forgot the dead volume process"
+			drift.Repaired = true
+
+			lifecycle, err := vol.Lifecycle(&d)
+			if err != nil {
+				lifecycle = d.VolumeProcessLifecycle
+			}
+			if lifecycle == VolumeProcessLifecycleVolume || vol.ReferenceCount() > 0 {
+				if drift.Err = vol.SetupProcess(&d); drift.Err == nil && strings.TrimSpace(vol.Puid) != "" {
+					drift.Detail = fmt.Sprintf("replaced the dead volume process with [%s]", vol.Puid)
+				} else {
+					drift.Repaired = false
+				}
+			}
+		}
+		drifts = append(drifts, drift)
+	}
+
+	return drifts
+}
+
+// Calls Reconcile() with [mode] right away and then every [interval] until the
+// returned function is called, which waits for a reconciliation in progress to
+// complete.
+func (d pluginDriver) ReconcilePeriodically(interval time.Duration, mode ReconcileMode) (stop func()) {
+	if mode == ReconcileModeOff || interval <= 0 {
+		return func() {}
+	}
+
+	chStop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		d.Reconcile(mode)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-chStop:
+				return
+			case <-ticker.C:
+				d.Reconcile(mode)
+			}
+		}
+	}()
+
+	return func() {
+		close(chStop)
+		<-done
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/metric"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func TestReconcileMode(t *testing.T) {
+	assert.Assert(t, len(ReconcileModeNames()) == len(reconcileModeNames))
+
+	tests := []struct {
+		name string
+		args string
+		want ReconcileMode
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: ReconcileMode(-1)},
+		{name: "Mixedcase", args: "\tRePaIr ", want: ReconcileModeRepair},
+		{name: "Unknown", args: "unknown", want: ReconcileMode(-1)},
+		{name: "Default", args: "off", want: ReconcileModeOff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReconcileModeParse(tt.args, ReconcileMode(-1)); got != tt.want {
+				t.Errorf("ReconcileModeParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_Reconcile(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	driver, err := pluginDriver_New(volumeFolder, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	kinds := func(drifts []ReconcileDrift) map[ReconcileDriftKind]int {
+		result := map[ReconcileDriftKind]int{}
+		for _, drift := range drifts {
+			result[drift.Kind]++
+		}
+		return result
+	}
+
+	for _, name := range []string{"test_missing", "test_dead"} {
+		if err := driver.Create(&volume.CreateRequest{Name: name, Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "restart"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Assert(t, len(driver.Reconcile(ReconcileModeRepair)) == 0)
+
+	for _, name := range []string{"orphan", "orphan_full", ".hidden"} {
+		if err := os.Mkdir(filepath.Join(volumeFolder, name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(volumeFolder, "orphan_full", "file"), []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := driver.Volumes["test_missing"]
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_missing"}); err != nil {
+		t.Fatal(err)
+	}
+	missing.Puid = ""
+	(*missing.Mounts)["test_stale"] = pluginDriverMount{ReferenceCount: 0}
+	driver.Volumes["test_missing"] = missing
+
+	dead := driver.Volumes["test_dead"]
+	if processMonitor, ok := processMonitors_LoadAndDelete(dead.Puid); !ok {
+		t.Fatalf("Volume [%s] has no process monitor.", "test_dead")
+	} else if err := proc.CancelProcess(processMonitor, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Assert(t, len(driver.Reconcile(ReconcileModeOff)) == 0)
+
+	want := map[ReconcileDriftKind]int{
+		ReconcileDriftOrphanFolder:  2,
+		ReconcileDriftMissingFolder: 1,
+		ReconcileDriftStaleMount:    1,
+		ReconcileDriftDeadProcess:   1,
+	}
+	drifts := driver.Reconcile(ReconcileModeReport)
+	assert.DeepEqual(t, kinds(drifts), want)
+	for _, drift := range drifts {
+		assert.Assert(t, !drift.Repaired, "Drift %s has been repaired in report mode.", drift.Kind)
+	}
+	assert.Assert(t, len(*driver.Volumes["test_missing"].Mounts) == 1)
+	assert.Assert(t, driver.Volumes["test_dead"].Puid == dead.Puid)
+
+	drifts = driver.Reconcile(ReconcileModeRepair)
+	assert.DeepEqual(t, kinds(drifts), want)
+	for _, drift := range drifts {
+		assert.Assert(t, drift.Repaired == (drift.Path != filepath.Join(volumeFolder, "orphan_full")), "Drift %s at [%s] has unexpectedly (not) been repaired.", drift.Kind, drift.Path)
+	}
+	if _, err := os.Lstat(filepath.Join(volumeFolder, "orphan")); err == nil {
+		t.Error("The empty orphan folder has not been removed.")
+	}
+	if _, err := os.Lstat(missing.MountPoint()); err != nil {
+		t.Errorf("The missing volume folder has not been recreated (%s).", err.Error())
+	}
+	if marker, err := pluginDriverVolumeMarker_Read(missing.MountPoint()); err != nil {
+		t.Errorf("The marker of the missing volume folder has not been recreated (%s).", err.Error())
+	} else {
+		assert.Assert(t, marker.Name == "test_missing", "Name = %s", marker.Name)
+	}
+	assert.Assert(t, len(*driver.Volumes["test_missing"].Mounts) == 0)
+	puid := driver.Volumes["test_dead"].Puid
+	assert.Assert(t, puid != "" && puid != dead.Puid)
+	assert.Assert(t, reconcile_Alive(puid))
+
+	// Only the non-empty orphan folder is left.
+	assert.DeepEqual(t, kinds(driver.Reconcile(ReconcileModeRepair)), map[ReconcileDriftKind]int{ReconcileDriftOrphanFolder: 1})
+
+	// The repairs have been persisted.
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	driver, err = pluginDriver_New(volumeFolder, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, driver.Volumes["test_dead"].Puid == puid)
+	assert.Assert(t, len(*driver.Volumes["test_missing"].Mounts) == 0)
+
+	for _, name := range []string{"test_missing", "test_dead"} {
+		if err := driver.Remove(&volume.RemoveRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_pluginDriver_Reconcile_RestartedProcess(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	driver, err := pluginDriver_NewWithVolumeProcess(volumeFolder, *logger, nil, nil, proc.RecoveryModeRestart, &metric.MetricRateLimit{Limit: 3, Duration: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"c": "-v"}}); err != nil {
+		t.Fatal(err)
+	}
+	puid := driver.Volumes["test_volume"].Puid
+	processMonitor, ok := processMonitors_Load(puid)
+	if !ok {
+		t.Fatalf("Volume [%s] has no process monitor.", "test_volume")
+	}
+
+	prc, err := proc.GetProcessInfoFromUniqueId(puid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(int(prc.Pid), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; processMonitor.Status().Restarts < 1; i++ {
+		if i > 50 {
+			t.Fatal("The volume process has not been restarted.")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	restarted := processMonitor.Status().ProcessInfo.UniqueId()
+
+	drifts := driver.Reconcile(ReconcileModeReport)
+	assert.Assert(t, len(drifts) == 1 && drifts[0].Kind == ReconcileDriftRestartedProcess)
+	assert.Assert(t, driver.Volumes["test_volume"].Puid == puid)
+
+	drifts = driver.Reconcile(ReconcileModeRepair)
+	assert.Assert(t, len(drifts) == 1 && drifts[0].Repaired)
+	assert.Assert(t, driver.Volumes["test_volume"].Puid == restarted)
+	if m, ok := processMonitors_Load(restarted); !ok || m != processMonitor {
+		t.Error("The process monitor has not been registered for the restarted volume process.")
+	}
+	assert.Assert(t, len(driver.Reconcile(ReconcileModeRepair)) == 0)
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proc.GetProcessInfoFromUniqueId(restarted); err == nil {
+		t.Errorf("Volume process [%s] is still running after removing the volume.", restarted)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_pluginDriver_Reconcile_WaitingProcess(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	driver, err := pluginDriver_New(volumeFolder, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: proc.RecoveryModeBackoff.String(), VolumeOptionRecoveryBackoff: "initial=1m"}}); err != nil {
+		t.Fatal(err)
+	}
+	puid := driver.Volumes["test_volume"].Puid
+	processMonitor, ok := processMonitors_Load(puid)
+	if !ok {
+		t.Fatalf("Volume [%s] has no process monitor.", "test_volume")
+	}
+
+	prc, err := proc.GetProcessInfoFromUniqueId(puid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(int(prc.Pid), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; processMonitor.Status().NextRestart.IsZero(); i++ {
+		if i > 50 {
+			t.Fatal("The volume process is not waiting to be restarted.")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The volume process is left to the process monitor.
+	assert.Assert(t, len(driver.Reconcile(ReconcileModeRepair)) == 0)
+	assert.Assert(t, driver.Volumes["test_volume"].Puid == puid)
+	if m, ok := processMonitors_Load(puid); !ok || m != processMonitor {
+		t.Error("The process monitor of the volume process waiting to be restarted has been replaced.")
+	}
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_pluginDriver_Reconcile_RecoveryMode(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	driver, err := pluginDriver_New(volumeFolder, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginDriver_SetTestVolumeProcess(t, driver)
+
+	kill := func(name string) {
+		processMonitor, ok := processMonitors_Load(driver.Volumes[name].Puid)
+		if !ok {
+			t.Fatalf("Volume [%s] has no process monitor.", name)
+		}
+		events, _ := processMonitor.Subscribe(10)
+		if err := syscall.Kill(int(processMonitor.Status().ProcessInfo.Pid), syscall.SIGKILL); err != nil {
+			t.Fatal(err)
+		}
+		for event := range events {
+			logger.Debug("Got process event.", "volume", name, "event", event.Kind)
+		}
+	}
+
+	// The volume process is not meant to be recovered.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_ignore", Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "ignore"}}); err != nil {
+		t.Fatal(err)
+	}
+	// The process monitor gives up recovering the volume process on the
+	// second crash.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_gaveup", Options: map[string]string{"c": "-v", VolumeOptionRecoveryMode: "restart", VolumeOptionRecoveryMaxPerMin: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	puids := map[string]string{"test_ignore": driver.Volumes["test_ignore"].Puid}
+
+	kill("test_ignore")
+	processMonitor, ok := processMonitors_Load(driver.Volumes["test_gaveup"].Puid)
+	if !ok {
+		t.Fatalf("Volume [%s] has no process monitor.", "test_gaveup")
+	}
+	if err := syscall.Kill(int(processMonitor.Status().ProcessInfo.Pid), syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; processMonitor.Status().Restarts < 1; i++ {
+		if i > 50 {
+			t.Fatal("The volume process has not been restarted.")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	kill("test_gaveup")
+	events := processMonitor.Events()
+	assert.Assert(t, events[len(events)-1].Kind == proc.ProcessEventGaveUp, "Last event = %s", events[len(events)-1].Kind)
+	puids["test_gaveup"] = driver.Volumes["test_gaveup"].Puid
+
+	for i := 0; i < 2; i++ {
+		drifts := driver.Reconcile(ReconcileModeRepair)
+		assert.Assert(t, len(drifts) == 2, "%d drifts", len(drifts))
+		for _, drift := range drifts {
+			assert.Assert(t, drift.Kind == ReconcileDriftDeadProcess && !drift.Repaired, "Drift %s of volume [%s] has been repaired.", drift.Kind, drift.Volume)
+			assert.Assert(t, strings.Contains(drift.Detail, "left alone"), drift.Detail)
+			assert.Assert(t, driver.Volumes[drift.Volume].Puid == puids[drift.Volume])
+		}
+	}
+
+	for name := range puids {
+		if err := driver.Remove(&volume.RemoveRequest{Name: name}); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thorbenw/docker-volume-plugin/proc"
+)
+
+const (
+	// The suffix appended to control files (including previous generations)
+	// that have been set aside since none of them could be loaded.
+	ControlFileCorruptSuffix = ".corrupt"
+)
+
+// region ControlFileRecovery enum
+
+// What to do if there is no control file, or none can be loaded.
+type ControlFileRecovery int
+
+const (
+	// Start without any volumes if there is no control file, and refuse to
+	// start if it cannot be loaded.
+	ControlFileRecoveryOff ControlFileRecovery = iota
+	// Rebuild the volume information from the marker files in the volume
+	// folders.
+	ControlFileRecoveryRebuild
+	// Refuse to start if there is no control file.
+	ControlFileRecoveryRequire
+)
+
+var controlFileRecoveryNames = map[ControlFileRecovery]string{
+	ControlFileRecoveryOff:     "Off",
+	ControlFileRecoveryRebuild: "Rebuild",
+	ControlFileRecoveryRequire: "Require",
+}
+
+func ControlFileRecoveryNames() map[ControlFileRecovery]string {
+	return controlFileRecoveryNames
+}
+
+func (r ControlFileRecovery) String() string {
+	if v, ok := controlFileRecoveryNames[r]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(r))
+	}
+}
+
+func ControlFileRecoveryParse(name string, defaultControlFileRecovery ControlFileRecovery) ControlFileRecovery {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultControlFileRecovery
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range controlFileRecoveryNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultControlFileRecovery
+}
+
+// region Control file recovery
+
+// Returns whether the control file [fileName] or it's most recent previous
+// generation exists, or the journal [journalFile] isn't empty (e.g. because the
+// plugin has been killed before compacting it for the first time).
+func pluginDriver_ControlFileExists(fileName string, journalFile string) bool {
+	for generation := uint(0); generation < 2; generation++ {
+		if _, err := os.Lstat(pluginDriver_Generation(fileName, generation)); err == nil {
+			return true
+		}
+	}
+
+	if fileInfo, err := os.Lstat(journalFile); err == nil && fileInfo.Size() > 0 {
+		return true
+	}
+
+	return false
+}
+
+// Renames the control file [fileName] and all of it's previous generations by
+// appending ControlFileCorruptSuffix, so a new control file can be started.
+func pluginDriver_SetAsideControlFile(fileName string) error {
+	for generation := uint(0); ; generation++ {
+		name := pluginDriver_Generation(fileName, generation)
+		if err := os.Rename(name, name+ControlFileCorruptSuffix); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				if generation < 1 {
+					continue
+				}
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Adds a volume to [volumes] for each folder in [propagatedMount] whose marker
+// file refers to a volume not in [volumes] yet, and returns the names of the
+// volumes added.
+//
+// Folders without a marker file and folders retained on removal (see
+// RemovePolicyRetain) are skipped. Mounts and volume processes cannot be
+// recovered.
+func pluginDriver_Rebuild(propagatedMount string, volumes map[string]pluginDriverVolume, logger slog.Logger) ([]string, error) {
+	entries, err := os.ReadDir(propagatedMount)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, vol := range volumes {
+		known[vol.Path] = true
+	}
+
+	added := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || known[entry.Name()] {
+			continue
+		}
+
+		folder := filepath.Join(propagatedMount, entry.Name())
+		marker, err := pluginDriverVolumeMarker_Read(folder)
+		if err != nil {
+			logger.Warn("Skipping a folder without a valid marker file.", "folder", folder, "err", err)
+			continue
+		}
+		if marker.RemovedAt != nil {
+			logger.Debug("Skipping a folder retained on removal.", "folder", folder, "volume", marker.Name)
+			continue
+		}
+		if other, ok := volumes[marker.Name]; ok {
+			logger.Warn("Skipping a folder whose volume is already known.", "folder", folder, "volume", marker.Name, "path", other.Path)
+			continue
+		}
+
+		options := marker.Options
+		vol := pluginDriverVolume{
+			BasePath:  propagatedMount,
+			Path:      entry.Name(),
+			CreatedAt: marker.CreatedAt,
+			Mounts:    &map[string]pluginDriverMount{},
+			Options:   &options,
+		}
+		if mountInfo, err := proc.GetMountInfoFromMountPoint(folder); err == nil {
+			logger.Warn("A file system is still mounted at the folder of a rebuilt volume, so it's volume process may still be running.", "folder", folder, "volume", marker.Name, "fsType", mountInfo.FsType)
+		}
+
+		volumes[marker.Name] = vol
+		added = append(added, marker.Name)
+	}
+	slices.Sort(added)
+
+	return added, nil
+}
+
+// Loads [store] according to [recovery] (see ControlFileRecovery).
+//
+// If volumes are rebuilt, the result is saved to [store] right away.
+func pluginDriver_LoadWithRecovery(store StateStore, propagatedMount string, recovery ControlFileRecovery, logger slog.Logger) (map[string]pluginDriverVolume, error) {
+	controlFile := filepath.Join(propagatedMount, DefaultControlFileName)
+	exists := pluginDriver_ControlFileExists(controlFile, filepath.Join(propagatedMount, DefaultJournalFileName))
+	if !exists && recovery == ControlFileRecoveryRequire {
+		return nil, fmt.Errorf("control file [%s] does not exist", controlFile)
+	}
+
+	rebuild := !exists && recovery == ControlFileRecoveryRebuild
+	volumes, err := store.Load()
+	if err != nil {
+		if recovery != ControlFileRecoveryRebuild {
+			return nil, err
+		}
+
+		logger.Error("The control file could not be loaded, setting it aside in order to rebuild it.", "controlFile", controlFile, "suffix", ControlFileCorruptSuffix, "err", err)
+		if err := pluginDriver_SetAsideControlFile(controlFile); err != nil {
+			return nil, err
+		}
+		if volumes, err = store.Load(); err != nil {
+			return nil, err
+		}
+		rebuild = true
+	}
+
+	if rebuild {
+		added, err := pluginDriver_Rebuild(propagatedMount, volumes, logger)
+		if err != nil {
+			return nil, err
+		}
+		if len(added) > 0 {
+			if err := store.Save(volumes); err != nil {
+				return nil, err
+			}
+			logger.Warn("Rebuilt the control file from the marker files in the volume folders.", "controlFile", controlFile, "volumes", added)
+		}
+	}
+
+	return volumes, nil
+}
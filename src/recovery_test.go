@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func TestControlFileRecovery(t *testing.T) {
+	assert.Assert(t, len(ControlFileRecoveryNames()) == len(controlFileRecoveryNames))
+
+	tests := []struct {
+		name string
+		args string
+		want ControlFileRecovery
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: ControlFileRecovery(-1)},
+		{name: "Mixedcase", args: "\tReBuIlD ", want: ControlFileRecoveryRebuild},
+		{name: "Unknown", args: "unknown", want: ControlFileRecovery(-1)},
+		{name: "Default", args: "off", want: ControlFileRecoveryOff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ControlFileRecoveryParse(tt.args, ControlFileRecovery(-1)); got != tt.want {
+				t.Errorf("ControlFileRecoveryParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_ControlFileRecovery(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	controlFile := filepath.Join(volumeFolder, DefaultControlFileName)
+	newDriver := func(recovery ControlFileRecovery) (*pluginDriver, error) {
+		return pluginDriver_NewWithOptions(volumeFolder, *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{FolderNaming: FolderNamingNameHash, ControlFileRecovery: recovery})
+	}
+	removeControlFiles := func() {
+		for _, pattern := range []string{DefaultControlFileName + "*", DefaultJournalFileName + "*"} {
+			files, err := filepath.Glob(filepath.Join(volumeFolder, pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				if err := os.Remove(file); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	driver, err := newDriver(ControlFileRecoveryRequire)
+	if err == nil {
+		t.Fatal("Creating a driver without a control file succeeded unexpectedly.")
+	}
+
+	driver, err = newDriver(ControlFileRecoveryOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"o": "ro"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Create(&volume.CreateRequest{Name: "test_retained", Options: map[string]string{VolumeOptionRemovePolicy: "retain"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_retained"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(volumeFolder, "test_nomarker"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	want := driver.Volumes["test_volume"]
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose the control file.
+	removeControlFiles()
+	if driver, err = newDriver(ControlFileRecoveryOff); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(driver.Volumes) == 0)
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	removeControlFiles()
+	if driver, err = newDriver(ControlFileRecoveryRebuild); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(driver.Volumes) == 1)
+	got := driver.Volumes["test_volume"]
+	assert.Assert(t, got.Path == want.Path && got.CreatedAt.Equal(want.CreatedAt))
+	assert.DeepEqual(t, *got.Options, *want.Options)
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if driver, err = newDriver(ControlFileRecoveryRequire); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(driver.Volumes) == 1)
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the journal is left behind (e.g. because the plugin has been killed
+	// before compacting it for the first time).
+	journalFile := filepath.Join(volumeFolder, DefaultJournalFileName)
+	removeControlFiles()
+	if err := os.WriteFile(journalFile, []byte{}, DefaultControlFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newDriver(ControlFileRecoveryRequire); err == nil {
+		t.Error("Creating a driver with an empty journal only succeeded unexpectedly.")
+	}
+	j, err := journal_Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(journalRecord{Op: journalOpPut, Name: "test_volume", Volume: &want}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if driver, err = newDriver(ControlFileRecoveryRequire); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(driver.Volumes) == 1)
+	assert.Assert(t, driver.Volumes["test_volume"].Path == want.Path)
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the control file.
+	removeControlFiles()
+	if err := os.WriteFile(controlFile, []byte("{corrupt"), DefaultControlFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newDriver(ControlFileRecoveryOff); err == nil {
+		t.Error("Creating a driver with a corrupt control file succeeded unexpectedly.")
+	}
+	if driver, err = newDriver(ControlFileRecoveryRebuild); err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(driver.Volumes) == 1)
+	if _, err := os.Lstat(controlFile + ControlFileCorruptSuffix); err != nil {
+		t.Errorf("The corrupt control file has not been set aside (%s).", err.Error())
+	}
+
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err != nil {
+		t.Error(err)
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
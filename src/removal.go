@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thorbenw/docker-volume-plugin/proc"
+)
+
+// The name of the volume option selecting the removal policy (e.g.
+// `docker volume create -o remove-policy=purge ...`).
+const VolumeOptionRemovePolicy = "remove-policy"
+
+// region RemovePolicy enum
+
+// What Remove() does with the folder of a volume.
+type RemovePolicy int
+
+const (
+	// Remove the folder, which fails if it is not empty or still mounted.
+	RemovePolicyRefuse RemovePolicy = iota
+	// Remove the folder including all of it's contents. Fails if something is
+	// still mounted at the folder, since that would purge the mounted data.
+	RemovePolicyPurge
+	// Detach anything still mounted at the folder (i.e. unmount it lazily),
+	// then remove the folder, which fails if it is not empty.
+	RemovePolicyLazyUnmount
+	// Keep the folder and it's contents and only drop the volume information.
+	RemovePolicyRetain
+)
+
+var removePolicyNames = map[RemovePolicy]string{
+	RemovePolicyRefuse:      "Refuse",
+	RemovePolicyPurge:       "Purge",
+	RemovePolicyLazyUnmount: "Lazy-Unmount",
+	RemovePolicyRetain:      "Retain",
+}
+
+func RemovePolicyNames() map[RemovePolicy]string {
+	return removePolicyNames
+}
+
+func (p RemovePolicy) String() string {
+	if v, ok := removePolicyNames[p]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(p))
+	}
+}
+
+func RemovePolicyParse(name string, defaultRemovePolicy RemovePolicy) RemovePolicy {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultRemovePolicy
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range removePolicyNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultRemovePolicy
+}
+
+// region pluginDriverVolume removal
+
+// Returns the removal policy of the volume, which is taken from the volume
+// option VolumeOptionRemovePolicy if present, or from the driver otherwise.
+func (v *pluginDriverVolume) RemovePolicy(d *pluginDriver) (RemovePolicy, error) {
+	if v.Options != nil {
+		if name, ok := (*v.Options)[VolumeOptionRemovePolicy]; ok {
+			invalidRemovePolicy := RemovePolicy(-1)
+			if policy := RemovePolicyParse(name, invalidRemovePolicy); policy != invalidRemovePolicy {
+				return policy, nil
+			}
+			return invalidRemovePolicy, fmt.Errorf("remove policy [%s] is not valid", name)
+		}
+	}
+
+	return d.RemovePolicy, nil
+}
+
+// Removes the folder of the volume [name] according to [policy]. If the folder
+// doesn't exist, an error wrapping fs.ErrNotExist is returned, so the caller
+// can decide whether that's fine.
+func (v *pluginDriverVolume) RemoveFolder(d *pluginDriver, name string, policy RemovePolicy) error {
+	mountPoint := v.MountPoint()
+
+	switch policy {
+	case RemovePolicyRetain:
+		// Have the marker tell the folder doesn't belong to a volume anymore.
+		marker, err := pluginDriverVolumeMarker_Read(mountPoint)
+		if err != nil {
+			m := v.Marker(name)
+			marker = &m
+		}
+		removedAt := time.Now()
+		marker.RemovedAt = &removedAt
+		if err := marker.Write(mountPoint); err != nil {
+			return err
+		}
+
+		d.Logger.Info(fmt.Sprintf("Retaining the folder [%s] of the removed volume [%s].", mountPoint, name))
+		return nil
+	case RemovePolicyPurge:
+		if mountInfo, err := proc.GetMountInfoFromMountPoint(mountPoint); err == nil {
+			return fmt.Errorf("refusing to purge [%s], since a file system of type [%s] is still mounted", mountPoint, mountInfo.FsType)
+		} else if !errors.Is(err, proc.ErrNotMounted) {
+			return err
+		}
+		if _, err := os.Lstat(mountPoint); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(mountPoint); err != nil {
+			return err
+		}
+		return pluginDriverVolumeMarker_Remove(mountPoint)
+	case RemovePolicyLazyUnmount:
+		if mountInfo, err := proc.GetMountInfoFromMountPoint(mountPoint); err == nil {
+			if err := syscall.Unmount(mountPoint, syscall.MNT_DETACH); err != nil {
+				return fmt.Errorf("lazily unmounting [%s] failed: %w", mountPoint, err)
+			}
+			d.Logger.Info(fmt.Sprintf("Lazily unmounted [%s].", mountPoint), "mountInfo", mountInfo)
+		} else if !errors.Is(err, proc.ErrNotMounted) {
+			return err
+		}
+		return removal_RemoveEmptyFolder(mountPoint)
+	default:
+		return removal_RemoveEmptyFolder(mountPoint)
+	}
+}
+
+// Removes [folder] if it is empty, along with it's marker file.
+func removal_RemoveEmptyFolder(folder string) error {
+	if err := os.Remove(folder); err != nil {
+		return err
+	}
+
+	return pluginDriverVolumeMarker_Remove(folder)
+}
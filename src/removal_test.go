@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func TestRemovePolicy(t *testing.T) {
+	assert.Assert(t, len(RemovePolicyNames()) == len(removePolicyNames))
+
+	tests := []struct {
+		name string
+		args string
+		want RemovePolicy
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: RemovePolicy(-1)},
+		{name: "Mixedcase", args: "\tPuRgE ", want: RemovePolicyPurge},
+		{name: "Dash", args: "lazy-unmount", want: RemovePolicyLazyUnmount},
+		{name: "Unknown", args: "unknown", want: RemovePolicy(-1)},
+		{name: "Default", args: "refuse", want: RemovePolicyRefuse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RemovePolicyParse(tt.args, RemovePolicy(-1)); got != tt.want {
+				t.Errorf("RemovePolicyParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_RemovePolicy(t *testing.T) {
+	proc.Logger = logger
+
+	driver, err := pluginDriver_NewWithOptions(t.TempDir(), *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{RemovePolicy: RemovePolicyPurge})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := driver.Create(&volume.CreateRequest{Name: "test_invalid", Options: map[string]string{VolumeOptionRemovePolicy: "shred"}}); err == nil {
+		t.Error("Creating a volume with an invalid remove policy succeeded unexpectedly.")
+	}
+
+	tests := []struct {
+		name       string
+		policy     string
+		wantErr    bool
+		wantFolder bool
+	}{
+		// Test cases.
+		{name: "test_refuse", policy: "refuse", wantErr: true, wantFolder: true},
+		{name: "test_lazy", policy: "lazy-unmount", wantErr: true, wantFolder: true},
+		{name: "test_retain", policy: "retain", wantErr: false, wantFolder: true},
+		{name: "test_purge", policy: "purge", wantErr: false, wantFolder: false},
+		{name: "test_default", policy: "", wantErr: false, wantFolder: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := map[string]string{}
+			if tt.policy != "" {
+				options[VolumeOptionRemovePolicy] = tt.policy
+			}
+			if err := driver.Create(&volume.CreateRequest{Name: tt.name, Options: options}); err != nil {
+				t.Fatal(err)
+			}
+			mountPoint := filepath.Join(driver.PropagatedMount, driver.Volumes[tt.name].Path)
+			if err := os.WriteFile(filepath.Join(mountPoint, "data"), []byte(tt.name), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := driver.Remove(&volume.RemoveRequest{Name: tt.name})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Remove() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			_, ok := driver.Volumes[tt.name]
+			assert.Assert(t, ok == tt.wantErr, "Volume [%s] has unexpectedly (not) been removed.", tt.name)
+			_, err = os.Lstat(mountPoint)
+			assert.Assert(t, (err == nil) == tt.wantFolder, "Folder [%s] has unexpectedly (not) been removed.", mountPoint)
+			if tt.wantFolder {
+				// The marker file is kept or marked as removed.
+				marker, err := pluginDriverVolumeMarker_Read(mountPoint)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Assert(t, marker.Name == tt.name && (marker.RemovedAt != nil) == !tt.wantErr)
+			}
+
+			if tt.wantErr {
+				// Empty folders can be removed.
+				if err := os.Remove(filepath.Join(mountPoint, "data")); err != nil {
+					t.Fatal(err)
+				}
+				if err := driver.Remove(&volume.RemoveRequest{Name: tt.name}); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+
+	// Mounted file systems are never purged.
+	vol := pluginDriverVolume{BasePath: "/", Path: "proc"}
+	if err := vol.RemoveFolder(driver, "test_proc", RemovePolicyPurge); err == nil || !strings.Contains(err.Error(), "refusing to purge") {
+		t.Errorf("RemoveFolder() error = %v, want refusal", err)
+	}
+
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// region VolumeScope enum
+
+// The scope of the volumes provided by the plugin, as reported by
+// pluginDriver.Capabilities().
+type VolumeScope int
+
+const (
+	// Volumes are only known to the node they have been created on.
+	VolumeScopeLocal VolumeScope = iota
+	// Volumes refer to cluster wide data (e.g. an S3 bucket), so the same
+	// volume may be created and removed on every node.
+	VolumeScopeGlobal
+)
+
+var volumeScopeNames = map[VolumeScope]string{
+	VolumeScopeLocal:  "Local",
+	VolumeScopeGlobal: "Global",
+}
+
+func VolumeScopeNames() map[VolumeScope]string {
+	return volumeScopeNames
+}
+
+func (s VolumeScope) String() string {
+	if v, ok := volumeScopeNames[s]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(s))
+	}
+}
+
+func VolumeScopeParse(name string, defaultVolumeScope VolumeScope) VolumeScope {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultVolumeScope
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range volumeScopeNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultVolumeScope
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"github.com/thorbenw/docker-volume-plugin/utils"
+	"gotest.tools/assert"
+)
+
+func TestVolumeScope(t *testing.T) {
+	assert.Assert(t, len(VolumeScopeNames()) == len(volumeScopeNames))
+
+	tests := []struct {
+		name string
+		args string
+		want VolumeScope
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: VolumeScope(-1)},
+		{name: "Mixedcase", args: "\tGlObAl ", want: VolumeScopeGlobal},
+		{name: "Unknown", args: "unknown", want: VolumeScope(-1)},
+		{name: "Default", args: "local", want: VolumeScopeLocal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VolumeScopeParse(tt.args, VolumeScope(-1)); got != tt.want {
+				t.Errorf("VolumeScopeParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_Scope(t *testing.T) {
+	t.Parallel()
+
+	if driver, err := pluginDriver_New(t.TempDir(), *logger); err != nil {
+		t.Fatal(err)
+	} else {
+		assert.Assert(t, driver.Capabilities().Capabilities.Scope == "local")
+		if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err == nil {
+			t.Error("Removing an unknown volume in local scope succeeded unexpectedly.")
+		}
+	}
+
+	propagatedMount := t.TempDir()
+	driver, err := pluginDriver_NewWithOptions(propagatedMount, *logger, nil, nil, nil, proc.RecoveryModeIgnore, nil, pluginDriverOptions{Scope: VolumeScopeGlobal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, driver.Capabilities().Capabilities.Scope == "global")
+
+	options := map[string]string{"o": "bucket=test"}
+	for i := 0; i < 2; i++ {
+		if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: options}); err != nil {
+			t.Errorf("Creating volume [test_volume] with identical options failed (%s).", err.Error())
+		}
+	}
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"o": "bucket=other"}}); err == nil {
+		t.Error("Creating volume [test_volume] with different options succeeded unexpectedly.")
+	}
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume"}); err == nil {
+		t.Error("Creating volume [test_volume] without options succeeded unexpectedly.")
+	}
+
+	// Nil and empty options are considered identical.
+	for _, options := range []map[string]string{nil, {}} {
+		if err := driver.Create(&volume.CreateRequest{Name: "test_empty", Options: options}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Existing folders are adopted, e.g. if the propagated mount is shared.
+	if err := os.Mkdir(filepath.Join(propagatedMount, utils.SHA256StringToString("test_adopted")), DefaultVolumeFolderMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Create(&volume.CreateRequest{Name: "test_adopted"}); err != nil {
+		t.Error(err)
+	}
+
+	if res, err := driver.List(); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, len(res.Volumes) == 3)
+	}
+
+	for _, volumeName := range []string{"test_volume", "test_empty", "test_adopted"} {
+		for i := 0; i < 2; i++ {
+			if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+				t.Errorf("Removing volume [%s] failed (%s).", volumeName, err.Error())
+			}
+		}
+	}
+	if err := driver.Store.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -18,11 +18,47 @@ type VersionInfo struct {
 	Build      []any
 }
 
-/*
-	 func (vi VersionInfo) String() string {
-		return ""
+// Returns the version information in the form
+// `Major.Minor.Patch[-PreRelease][+Build]`, which can be passed to Parse().
+func (vi VersionInfo) String() string {
+	join := func(elements []any) string {
+		identifiers := make([]string, 0, len(elements))
+		for _, v := range MakeComparableSlice(elements) {
+			identifiers = append(identifiers, fmt.Sprintf("%v", v))
+		}
+
+		return strings.Join(identifiers, ".")
+	}
+
+	result := fmt.Sprintf("%d.%d.%d", vi.Major, vi.Minor, vi.Patch)
+
+	if len(vi.PreRelease) > 0 {
+		result += "-" + join(vi.PreRelease)
+	}
+
+	if len(vi.Build) > 0 {
+		result += "+" + join(vi.Build)
 	}
-*/
+
+	return result
+}
+
+// Implements encoding.TextMarshaler, so version information is represented as
+// a string (e.g. in JSON documents).
+func (vi VersionInfo) MarshalText() ([]byte, error) {
+	return []byte(vi.String()), nil
+}
+
+// Implements encoding.TextUnmarshaler using Parse().
+func (vi *VersionInfo) UnmarshalText(text []byte) error {
+	result, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	*vi = *result
+	return nil
+}
 
 // Converts an arbitrary slice into a slice containing only `string` and
 // `uint64` elements.
@@ -76,3 +76,59 @@ func TestCompare(t *testing.T) {
 		})
 	}
 }
+
+func TestVersionInfo_String(t *testing.T) {
+	tests := []struct {
+		name string
+		vi   VersionInfo
+		want string
+	}{
+		// Test cases.
+		{name: "Zero", vi: VersionInfo{}, want: "0.0.0"},
+		{name: "Release", vi: VersionInfo{Major: 1, Minor: 2, Patch: 3}, want: "1.2.3"},
+		{name: "PreRelease", vi: VersionInfo{Major: 1, Minor: 2, Patch: 3, PreRelease: []any{"pre", uint64(4)}}, want: "1.2.3-pre.4"},
+		{name: "Build", vi: VersionInfo{Major: 1, Minor: 2, Patch: 3, Build: []any{"build", -5}}, want: "1.2.3+build.-5"},
+		{name: "Full", vi: VersionInfo{Major: 1, Minor: 2, Patch: 3, PreRelease: []any{"pre", uint64(4)}, Build: []any{"build", uint64(5)}}, want: "1.2.3-pre.4+build.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.vi.String(); got != tt.want {
+				t.Errorf("VersionInfo.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionInfo_Text(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    VersionInfo
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Valid", text: "1.2.3-pre.4+build.5", want: VersionInfo{Major: 1, Minor: 2, Patch: 3, PreRelease: []any{"pre", uint64(4)}, Build: []any{"build", uint64(5)}}},
+		{name: "Invalid", text: "a.b.c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got VersionInfo
+			if err := got.UnmarshalText([]byte(tt.text)); (err != nil) != tt.wantErr {
+				t.Errorf("VersionInfo.UnmarshalText() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			} else if err != nil {
+				logger.Debug("VersionInfo.UnmarshalText() failed expectedly.", "err", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VersionInfo.UnmarshalText() = %v, want %v", got, tt.want)
+			}
+
+			if text, err := got.MarshalText(); err != nil {
+				t.Error(err)
+			} else if string(text) != tt.text {
+				t.Errorf("VersionInfo.MarshalText() = %s, want %s", text, tt.text)
+			}
+		})
+	}
+}
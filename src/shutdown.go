@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// region ShutdownPolicy enum
+
+// What to do with volume processes when the plugin shuts down.
+type ShutdownPolicy int
+
+const (
+	// Leave volume processes running, so they are picked up again when the
+	// plugin is restarted.
+	ShutdownPolicyRetain ShutdownPolicy = iota
+	// Cancel volume processes using proc.CancelProcess().
+	ShutdownPolicyCancel
+)
+
+var shutdownPolicyNames = map[ShutdownPolicy]string{
+	ShutdownPolicyRetain: "Retain",
+	ShutdownPolicyCancel: "Cancel",
+}
+
+func ShutdownPolicyNames() map[ShutdownPolicy]string {
+	return shutdownPolicyNames
+}
+
+func (p ShutdownPolicy) String() string {
+	if v, ok := shutdownPolicyNames[p]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(p))
+	}
+}
+
+func ShutdownPolicyParse(name string, defaultShutdownPolicy ShutdownPolicy) ShutdownPolicy {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultShutdownPolicy
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range shutdownPolicyNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultShutdownPolicy
+}
+
+// region pluginDriver shutdown
+
+// Shuts the driver down after the plugin stopped accepting requests.
+//
+// Shutdown() waits for all requests in progress to complete, including Mount()
+// requests waiting for the volume process without holding the driver's lock
+// (while no further ones start waiting), then applies [policy] to all volume
+// processes, and finally closes the state store, which flushes all pending
+// changes. The driver's lock is never released again, so requests arriving on
+// connections accepted before are blocked until the plugin exits. Therefore,
+// Shutdown() must only be called once.
+func (d pluginDriver) Shutdown(policy ShutdownPolicy) error {
+	d.RWMutex.Lock()
+	d.shuttingDown.Store(true)
+	d.RWMutex.Unlock()
+	d.mounting.Wait()
+	d.RWMutex.Lock()
+
+	errs := []error{}
+	retained, cancelled, failed := 0, 0, 0
+	for name, vol := range d.Volumes {
+		if strings.TrimSpace(vol.Puid) == "" {
+			continue
+		}
+
+		switch policy {
+		case ShutdownPolicyCancel:
+			if err := vol.StopProcess(&d); err != nil {
+				d.Logger.Warn("Failed terminating volume process.", "err", err, "volume", vol)
+				failed++
+			} else {
+				cancelled++
+			}
+
+			d.Volumes[name] = vol
+			if err := d.Store.Put(name, vol); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			retained++
+		}
+	}
+
+	if err := d.Store.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	err := errors.Join(errs...)
+	d.Logger.Info("Shut down the driver.", "policy", policy.String(), "volumes", len(d.Volumes), "retained", retained, "cancelled", cancelled, "failed", failed, "err", err)
+
+	return err
+}
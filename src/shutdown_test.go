@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"github.com/thorbenw/docker-volume-plugin/proc"
+	"gotest.tools/assert"
+)
+
+func TestShutdownPolicy(t *testing.T) {
+	assert.Assert(t, len(ShutdownPolicyNames()) == len(shutdownPolicyNames))
+
+	tests := []struct {
+		name string
+		args string
+		want ShutdownPolicy
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: ShutdownPolicy(-1)},
+		{name: "Mixedcase", args: "\tCaNcEl ", want: ShutdownPolicyCancel},
+		{name: "Unknown", args: "unknown", want: ShutdownPolicy(-1)},
+		{name: "Default", args: "retain", want: ShutdownPolicyRetain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShutdownPolicyParse(tt.args, ShutdownPolicy(-1)); got != tt.want {
+				t.Errorf("ShutdownPolicyParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pluginDriver_Shutdown(t *testing.T) {
+	proc.Logger = logger
+
+	volumeFolder := t.TempDir()
+	newDriver := func() *pluginDriver {
+		driver, err := pluginDriver_New(volumeFolder, *logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pluginDriver_SetTestVolumeProcess(t, driver)
+		return driver
+	}
+
+	// Retained volume processes are picked up by the next driver.
+	driver := newDriver()
+	if err := driver.Create(&volume.CreateRequest{Name: "test_volume", Options: map[string]string{"c": "-v"}}); err != nil {
+		t.Fatal(err)
+	}
+	puid := driver.Volumes["test_volume"].Puid
+	assert.Assert(t, puid != "")
+	if err := driver.Shutdown(ShutdownPolicyRetain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proc.GetProcessInfoFromUniqueId(puid); err != nil {
+		t.Errorf("Volume process [%s] is not running after shutting down with policy %s (%s).", puid, ShutdownPolicyRetain, err.Error())
+	}
+
+	driver = newDriver()
+	assert.Assert(t, driver.Volumes["test_volume"].Puid == puid)
+
+	// Cancelled volume processes are terminated and the change is persisted.
+	if err := driver.Shutdown(ShutdownPolicyCancel); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proc.GetProcessInfoFromUniqueId(puid); err == nil {
+		t.Errorf("Volume process [%s] is still running after shutting down with policy %s.", puid, ShutdownPolicyCancel)
+	}
+
+	driver = newDriver()
+	assert.Assert(t, driver.Volumes["test_volume"].Puid == "")
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_volume"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mounts waiting for the volume process are waited for, so their volume
+	// process isn't left running without a mount.
+	if err := driver.Create(&volume.CreateRequest{Name: "test_waiting", Options: map[string]string{"c": "-v", VolumeOptionLifecycle: "mount", VolumeOptionMountTimeout: "1s"}}); err != nil {
+		t.Fatal(err)
+	}
+	mounted := make(chan error, 1)
+	go func() {
+		_, err := driver.Mount(&volume.MountRequest{Name: "test_waiting", ID: "test_mount"})
+		mounted <- err
+	}()
+	puid = ""
+	for i := 0; puid == ""; i++ {
+		if i > 50 {
+			t.Fatal("The volume process has not been started.")
+		}
+		time.Sleep(10 * time.Millisecond)
+		driver.RWMutex.RLock()
+		puid = driver.Volumes["test_waiting"].Puid
+		driver.RWMutex.RUnlock()
+	}
+	if err := driver.Shutdown(ShutdownPolicyRetain); err != nil {
+		t.Error(err)
+	}
+	select {
+	case err := <-mounted:
+		assert.ErrorContains(t, err, "is not ready")
+	default:
+		t.Error("Shutdown() didn't wait for the mount in progress.")
+	}
+	if _, err := proc.GetProcessInfoFromUniqueId(puid); err == nil {
+		t.Errorf("Volume process [%s] is still running after the mount in progress has failed.", puid)
+	}
+
+	driver = newDriver()
+	if err := driver.Remove(&volume.RemoveRequest{Name: "test_waiting"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Shutdown(ShutdownPolicyCancel); err != nil {
+		t.Error(err)
+	}
+}
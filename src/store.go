@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// region StateStoreKind enum
+
+// The kind of state store used to persist volume information.
+type StateStoreKind int
+
+const (
+	// Rewrite the whole control file on every mutation (see jsonStateStore).
+	StateStoreKindJson StateStoreKind = iota
+	// Append mutations to a journal and compact it into the control file from
+	// time to time (see logStateStore).
+	StateStoreKindLog
+)
+
+var stateStoreKindNames = map[StateStoreKind]string{
+	StateStoreKindJson: "Json",
+	StateStoreKindLog:  "Log",
+}
+
+func StateStoreKindNames() map[StateStoreKind]string {
+	return stateStoreKindNames
+}
+
+func (k StateStoreKind) String() string {
+	if v, ok := stateStoreKindNames[k]; ok {
+		return v
+	} else {
+		return strconv.Itoa(int(k))
+	}
+}
+
+func StateStoreKindParse(name string, defaultStateStoreKind StateStoreKind) StateStoreKind {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultStateStoreKind
+	}
+
+	name = strings.ToLower(name)
+	for k, v := range stateStoreKindNames {
+		if name == strings.ToLower(v) {
+			return k
+		}
+	}
+
+	return defaultStateStoreKind
+}
+
+// region StateStore interface
+
+// Persists the volume information of a pluginDriver.
+//
+// Implementations are expected to be safe for concurrent use.
+type StateStore interface {
+	// Loads all volumes. Must be called once before any other method.
+	Load() (map[string]pluginDriverVolume, error)
+	// Replaces all persisted volumes with [volumes].
+	Save(volumes map[string]pluginDriverVolume) error
+	// Persists a single volume, which is either added or replaced.
+	Put(name string, volume pluginDriverVolume) error
+	// Removes a single volume.
+	Delete(name string) error
+	// Flushes pending changes and releases all resources held by the store.
+	Close() error
+}
+
+// Creates a state store of kind [kind] keeping it's files in the folder
+// [propagatedMount]. The compaction parameters only apply to journal based
+// stores (see logStateStore).
+//
+// The store doesn't access any files before StateStore.Load() is called.
+func stateStore_New(kind StateStoreKind, propagatedMount string, generations uint, compactionThreshold uint, compactionInterval time.Duration, logger slog.Logger) (StateStore, error) {
+	controlFile := filepath.Join(propagatedMount, DefaultControlFileName)
+	journalFile := filepath.Join(propagatedMount, DefaultJournalFileName)
+
+	switch kind {
+	case StateStoreKindJson:
+		return jsonStateStore_New(controlFile, journalFile, generations, logger), nil
+	case StateStoreKindLog:
+		return logStateStore_New(controlFile, journalFile, generations, int(compactionThreshold), compactionInterval, logger), nil
+	default:
+		return nil, fmt.Errorf("state store kind %s is not supported", kind)
+	}
+}
+
+// Loads the control file [controlFile] using pluginDriver_Load(), logs if a
+// previous generation had to be used, and saves migrated documents right away
+// in order to make the migration durable.
+func stateStore_LoadControlFile(controlFile string, generations uint, logger slog.Logger) (map[string]pluginDriverVolume, error) {
+	loaded, loadedFrom, err := pluginDriver_Load(controlFile)
+	if err != nil {
+		return nil, err
+	}
+	if loadedFrom != controlFile {
+		logger.Warn("The control file could not be loaded, using a previous generation instead.", "controlFile", controlFile, "loadedFrom", loadedFrom)
+	}
+
+	if loaded.migratedFrom != nil {
+		if err := pluginDriver_Save(controlFile, generations, loaded.Volumes); err != nil {
+			return nil, err
+		}
+		logger.Info("Migrated the control file.", "controlFile", controlFile, "from", loaded.migratedFrom.String(), "to", ControlFileVersion, "backup", pluginDriver_MigrationBackup(loadedFrom, *loaded.migratedFrom))
+	}
+
+	return loaded.Volumes, nil
+}
+
+// Returns a deep copy of [volume]. State stores keep copies of the volumes they
+// persist, since the driver modifies the mounts and options of it's volumes
+// under it's own lock only, while stores marshal them under theirs (e.g. when
+// compacting periodically).
+func stateStore_CloneVolume(volume pluginDriverVolume) pluginDriverVolume {
+	if volume.Mounts != nil {
+		mounts := maps.Clone(*volume.Mounts)
+		volume.Mounts = &mounts
+	}
+	if volume.Options != nil {
+		options := maps.Clone(*volume.Options)
+		volume.Options = &options
+	}
+	if volume.FailedAt != nil {
+		failedAt := *volume.FailedAt
+		volume.FailedAt = &failedAt
+	}
+
+	return volume
+}
+
+// Returns a deep copy of [volumes] (see stateStore_CloneVolume()).
+func stateStore_CloneVolumes(volumes map[string]pluginDriverVolume) map[string]pluginDriverVolume {
+	clone := make(map[string]pluginDriverVolume, len(volumes))
+	for name, volume := range volumes {
+		clone[name] = stateStore_CloneVolume(volume)
+	}
+
+	return clone
+}
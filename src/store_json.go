@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// region jsonStateStore struct
+
+// A state store rewriting the whole control file on every mutation.
+//
+// This is simple and keeps the control file always up to date, but each
+// mutation costs O(total volumes).
+type jsonStateStore struct {
+	ControlFile string
+	// The journal file left behind by a logStateStore, if any. It is replayed
+	// and removed by Load(), so switching from the log store to this store
+	// doesn't lose any mutations.
+	JournalFile string
+	Generations uint
+	logger      slog.Logger
+	volumes     map[string]pluginDriverVolume
+	mutex       sync.Mutex
+}
+
+func jsonStateStore_New(controlFile string, journalFile string, generations uint, logger slog.Logger) *jsonStateStore {
+	return &jsonStateStore{
+		ControlFile: controlFile,
+		JournalFile: journalFile,
+		Generations: generations,
+		logger:      logger,
+		volumes:     map[string]pluginDriverVolume{},
+	}
+}
+
+func (s *jsonStateStore) Load() (map[string]pluginDriverVolume, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	volumes, err := stateStore_LoadControlFile(s.ControlFile, s.Generations, s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like logStateStore.Load(), keep the records replayed before the first
+	// invalid one, which is expected to be the remainder of a crash.
+	records, err := journal_ReplayIfExists(s.JournalFile, volumes)
+	if errors.Is(err, errJournalInvalidRecord) {
+		s.logger.Warn("The journal has been replayed partially, discarding the remainder.", "journalFile", s.JournalFile, "records", records, "err", err)
+	} else if err != nil {
+		return nil, err
+	}
+	if records > 0 {
+		if err := pluginDriver_Save(s.ControlFile, s.Generations, volumes); err != nil {
+			return nil, err
+		}
+		s.logger.Info("Compacted a journal left behind into the control file.", "journalFile", s.JournalFile, "records", records)
+	}
+	if err := os.Remove(s.JournalFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	s.volumes = stateStore_CloneVolumes(volumes)
+	return volumes, nil
+}
+
+func (s *jsonStateStore) Save(volumes map[string]pluginDriverVolume) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.volumes = stateStore_CloneVolumes(volumes)
+	return pluginDriver_Save(s.ControlFile, s.Generations, s.volumes)
+}
+
+func (s *jsonStateStore) Put(name string, volume pluginDriverVolume) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.volumes[name] = stateStore_CloneVolume(volume)
+	return pluginDriver_Save(s.ControlFile, s.Generations, s.volumes)
+}
+
+func (s *jsonStateStore) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.volumes, name)
+	return pluginDriver_Save(s.ControlFile, s.Generations, s.volumes)
+}
+
+func (s *jsonStateStore) Close() error {
+	return nil
+}
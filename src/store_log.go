@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJournalCompactionThreshold = 1000
+	DefaultJournalCompactionInterval  = 5 * time.Minute
+)
+
+// region logStateStore struct
+
+// A state store appending mutations to a journal instead of rewriting the whole
+// control file, so each mutation costs O(1) regardless of the total number of
+// volumes.
+//
+// The journal is compacted into the control file (which then serves as a
+// snapshot) when it reaches CompactionThreshold records, every
+// CompactionInterval, when loading and when closing the store. A threshold or
+// interval of 0 disables the respective trigger.
+type logStateStore struct {
+	ControlFile         string
+	JournalFile         string
+	Generations         uint
+	CompactionThreshold int
+	CompactionInterval  time.Duration
+	logger              slog.Logger
+	journal             *journal
+	volumes             map[string]pluginDriverVolume
+	mutex               sync.Mutex
+	stop                chan struct{}
+	done                chan struct{}
+}
+
+func logStateStore_New(controlFile string, journalFile string, generations uint, compactionThreshold int, compactionInterval time.Duration, logger slog.Logger) *logStateStore {
+	return &logStateStore{
+		ControlFile:         controlFile,
+		JournalFile:         journalFile,
+		Generations:         generations,
+		CompactionThreshold: compactionThreshold,
+		CompactionInterval:  compactionInterval,
+		logger:              logger,
+		volumes:             map[string]pluginDriverVolume{},
+	}
+}
+
+func (s *logStateStore) Load() (map[string]pluginDriverVolume, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	volumes, err := stateStore_LoadControlFile(s.ControlFile, s.Generations, s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.journal == nil {
+		if s.journal, err = journal_Open(s.JournalFile); err != nil {
+			return nil, err
+		}
+	}
+
+	records, err := s.journal.Replay(volumes)
+	if err != nil {
+		s.logger.Warn("The journal has been replayed partially, discarding the remainder.", "journalFile", s.JournalFile, "records", records, "err", err)
+	}
+	s.logger.Debug("Replayed the journal.", "journalFile", s.JournalFile, "records", records)
+
+	s.volumes = stateStore_CloneVolumes(volumes)
+	if s.journal.Len() > 0 {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.CompactionInterval > 0 && s.stop == nil {
+		s.stop, s.done = make(chan struct{}), make(chan struct{})
+		go s.compactPeriodically(s.CompactionInterval, s.stop, s.done)
+	}
+
+	return volumes, nil
+}
+
+func (s *logStateStore) Save(volumes map[string]pluginDriverVolume) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.volumes = stateStore_CloneVolumes(volumes)
+	return s.compact()
+}
+
+func (s *logStateStore) Put(name string, volume pluginDriverVolume) error {
+	volume = stateStore_CloneVolume(volume)
+	return s.append(journalRecord{Op: journalOpPut, Name: name, Volume: &volume})
+}
+
+func (s *logStateStore) Delete(name string) error {
+	return s.append(journalRecord{Op: journalOpDelete, Name: name})
+}
+
+func (s *logStateStore) Close() error {
+	s.mutex.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.journal == nil {
+		return nil
+	}
+
+	err := s.compact()
+	err = errors.Join(err, s.journal.Close())
+	s.journal = nil
+
+	return err
+}
+
+func (s *logStateStore) append(record journalRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.journal == nil {
+		return errors.New("the state store has not been loaded or has already been closed")
+	}
+
+	if err := s.journal.Append(record); err != nil {
+		return err
+	}
+	if err := record.Apply(s.volumes); err != nil {
+		return err
+	}
+
+	if s.CompactionThreshold > 0 && s.journal.Len() >= s.CompactionThreshold {
+		return s.compact()
+	}
+
+	return nil
+}
+
+// Writes all volumes to the control file and discards the journal. The caller
+// must hold s.mutex.
+func (s *logStateStore) compact() error {
+	if err := pluginDriver_Save(s.ControlFile, s.Generations, s.volumes); err != nil {
+		return err
+	}
+
+	records := 0
+	if s.journal != nil {
+		records = s.journal.Len()
+		if err := s.journal.Reset(); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Debug("Compacted the journal into the control file.", "controlFile", s.ControlFile, "records", records)
+	return nil
+}
+
+// Compacts the journal every [interval] until [stop] is closed, and closes
+// [done] when returning.
+func (s *logStateStore) compactPeriodically(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			if s.journal != nil && s.journal.Len() > 0 {
+				if err := s.compact(); err != nil {
+					s.logger.Error("Compacting the journal failed.", "journalFile", s.JournalFile, "err", err)
+				}
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/volume"
+	"gotest.tools/assert"
+)
+
+// region memoryStateStore struct
+
+// A state store keeping volume information in memory only, for testing drivers
+// without touching any control file.
+type memoryStateStore struct {
+	volumes map[string]pluginDriverVolume
+	puts    int
+	deletes int
+	closed  bool
+	mutex   sync.Mutex
+}
+
+func (s *memoryStateStore) Load() (map[string]pluginDriverVolume, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.volumes == nil {
+		s.volumes = map[string]pluginDriverVolume{}
+	}
+
+	return stateStore_CloneVolumes(s.volumes), nil
+}
+
+func (s *memoryStateStore) Save(volumes map[string]pluginDriverVolume) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.volumes = stateStore_CloneVolumes(volumes)
+	return nil
+}
+
+func (s *memoryStateStore) Put(name string, volume pluginDriverVolume) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.volumes[name] = stateStore_CloneVolume(volume)
+	s.puts++
+	return nil
+}
+
+func (s *memoryStateStore) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.volumes, name)
+	s.deletes++
+	return nil
+}
+
+func (s *memoryStateStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return errors.New("already closed")
+	}
+
+	s.closed = true
+	return nil
+}
+
+func TestStateStoreKind(t *testing.T) {
+	assert.Assert(t, len(StateStoreKindNames()) == len(stateStoreKindNames))
+
+	tests := []struct {
+		name string
+		args string
+		want StateStoreKind
+	}{
+		// Test cases.
+		{name: "Empty", args: "", want: StateStoreKind(-1)},
+		{name: "Mixedcase", args: "\tLoG ", want: StateStoreKindLog},
+		{name: "Unknown", args: "unknown", want: StateStoreKind(-1)},
+		{name: "Default", args: "json", want: StateStoreKindJson},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StateStoreKindParse(tt.args, StateStoreKind(-1)); got != tt.want {
+				t.Errorf("StateStoreKindParse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if store, err := stateStore_New(StateStoreKind(-1), t.TempDir(), DefaultControlFileGenerations, 0, 0, *logger); err == nil {
+		t.Errorf("Creating a state store of an invalid kind succeeded unexpectedly (%T).", store)
+	}
+}
+
+func Test_StateStore(t *testing.T) {
+	for kind := range StateStoreKindNames() {
+		t.Run(kind.String(), func(t *testing.T) {
+			propagatedMount := t.TempDir()
+			controlFile := filepath.Join(propagatedMount, DefaultControlFileName)
+
+			open := func() StateStore {
+				store, err := stateStore_New(kind, propagatedMount, DefaultControlFileGenerations, DefaultJournalCompactionThreshold, 0, *logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return store
+			}
+
+			store := open()
+			if volumes, err := store.Load(); err != nil {
+				t.Fatal(err)
+			} else {
+				assert.Assert(t, len(volumes) == 0)
+			}
+
+			for _, name := range []string{"test_volume1", "test_volume2", "test_volume3"} {
+				if err := store.Put(name, pluginDriverVolume{Path: name, Mounts: &map[string]pluginDriverMount{}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Put("test_volume1", pluginDriverVolume{Path: "test_volume1", Mounts: &map[string]pluginDriverMount{"test_id": {ReferenceCount: 1}}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Delete("test_volume2"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Simulate a crash by loading a second instance without closing the
+			// first one.
+			if volumes, err := open().Load(); err != nil {
+				t.Fatal(err)
+			} else {
+				assert.Assert(t, len(volumes) == 2)
+				assert.Assert(t, len(*volumes["test_volume1"].Mounts) == 1)
+				_, ok := volumes["test_volume2"]
+				assert.Assert(t, !ok)
+			}
+
+			if err := store.Close(); err != nil {
+				t.Error(err)
+			}
+
+			if controlFile, _, err := pluginDriver_Load(controlFile); err != nil {
+				t.Error(err)
+			} else {
+				assert.Assert(t, len(controlFile.Volumes) == 2)
+			}
+
+			store = open()
+			if _, err := store.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(map[string]pluginDriverVolume{}); err != nil {
+				t.Error(err)
+			}
+			if err := store.Close(); err != nil {
+				t.Error(err)
+			}
+			if volumes, err := open().Load(); err != nil {
+				t.Fatal(err)
+			} else {
+				assert.Assert(t, len(volumes) == 0)
+			}
+		})
+	}
+}
+
+func Test_logStateStore_Compaction(t *testing.T) {
+	propagatedMount := t.TempDir()
+	controlFile := filepath.Join(propagatedMount, DefaultControlFileName)
+	journalFile := filepath.Join(propagatedMount, DefaultJournalFileName)
+
+	store := logStateStore_New(controlFile, journalFile, DefaultControlFileGenerations, 3, 0, *logger)
+	if err := store.Put("test_volume", pluginDriverVolume{}); err == nil {
+		t.Error("Putting a volume before loading succeeded unexpectedly.")
+	}
+	if _, err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if err := store.Put("test_volume", pluginDriverVolume{Puid: string(rune('0' + i))}); err != nil {
+			t.Fatal(err)
+		}
+		assert.Assert(t, store.journal.Len() == i%3, "Journal has %d records after %d puts.", store.journal.Len(), i)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Error(err)
+	}
+	if fileInfo, err := os.Lstat(journalFile); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, fileInfo.Size() == 0)
+	}
+
+	// Switching to the json store must pick up a journal left behind.
+	store = logStateStore_New(controlFile, journalFile, DefaultControlFileGenerations, 0, 0, *logger)
+	if _, err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("test_volume"); err != nil {
+		t.Fatal(err)
+	}
+	if volumes, err := jsonStateStore_New(controlFile, journalFile, DefaultControlFileGenerations, *logger).Load(); err != nil {
+		t.Fatal(err)
+	} else {
+		assert.Assert(t, len(volumes) == 0)
+	}
+	if _, err := os.Lstat(journalFile); err == nil {
+		t.Errorf("Journal file [%s] has been expected to be removed.", journalFile)
+	}
+}
+
+func Test_jsonStateStore_TornJournal(t *testing.T) {
+	propagatedMount := t.TempDir()
+	controlFile := filepath.Join(propagatedMount, DefaultControlFileName)
+	journalFile := filepath.Join(propagatedMount, DefaultJournalFileName)
+
+	// Journal records left behind by the log store crashing while appending.
+	j, err := journal_Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(journalRecord{Op: journalOpPut, Name: "test_volume", Volume: &pluginDriverVolume{Path: "test_volume"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if file, err := os.OpenFile(journalFile, os.O_WRONLY|os.O_APPEND, DefaultJournalFileMode); err != nil {
+		t.Fatal(err)
+	} else {
+		if _, err := file.WriteString(`{"Op":"put","Name":"test_oth`); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := jsonStateStore_New(controlFile, journalFile, DefaultControlFileGenerations, *logger)
+	if volumes, err := store.Load(); err != nil {
+		t.Fatal(err)
+	} else {
+		assert.Assert(t, len(volumes) == 1 && volumes["test_volume"].Path == "test_volume")
+	}
+	if _, err := os.Lstat(journalFile); err == nil {
+		t.Errorf("Journal file [%s] has been expected to be removed.", journalFile)
+	}
+
+	// The records replayed have been compacted into the control file.
+	if controlFile, _, err := pluginDriver_Load(controlFile); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, len(controlFile.Volumes) == 1)
+	}
+	if err := store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_logStateStore_CompactionInterval(t *testing.T) {
+	propagatedMount := t.TempDir()
+	controlFile := filepath.Join(propagatedMount, DefaultControlFileName)
+	journalFile := filepath.Join(propagatedMount, DefaultJournalFileName)
+
+	store := logStateStore_New(controlFile, journalFile, DefaultControlFileGenerations, 0, 10*time.Millisecond, *logger)
+	if _, err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("test_volume", pluginDriverVolume{}); err != nil {
+		t.Fatal(err)
+	}
+
+	compacted := false
+	for i := 0; i < 100 && !compacted; i++ {
+		time.Sleep(10 * time.Millisecond)
+		store.mutex.Lock()
+		compacted = store.journal.Len() == 0
+		store.mutex.Unlock()
+	}
+	assert.Assert(t, compacted, "The journal has not been compacted periodically.")
+
+	if controlFile, _, err := pluginDriver_Load(controlFile); err != nil {
+		t.Error(err)
+	} else {
+		assert.Assert(t, len(controlFile.Volumes) == 1)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_logStateStore_CompactionRace(t *testing.T) {
+	propagatedMount := t.TempDir()
+
+	store, err := stateStore_New(StateStoreKindLog, propagatedMount, DefaultControlFileGenerations, 0, time.Millisecond, *logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := pluginDriver_NewWithStore(propagatedMount, *logger, store, nil, nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumeName := "test_volume"
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName, Options: map[string]string{"o": "ro"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mounting and unmounting modifies the mounts of the volume, while the
+	// store compacts the journal every millisecond (see go test -race).
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: id}); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := driver.Unmount(&volume.UnmountRequest{Name: volumeName, ID: id}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(fmt.Sprintf("test_mount_%d", i))
+	}
+	wg.Wait()
+
+	// Closing the store stops compacting periodically.
+	if err := driver.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logStore := store.(*logStateStore)
+	logStore.mutex.Lock()
+	stopped := logStore.stop == nil && logStore.done == nil
+	logStore.mutex.Unlock()
+	assert.Assert(t, stopped, "The store still compacts periodically after being closed.")
+
+	controlFile, _, err := pluginDriver_Load(filepath.Join(propagatedMount, DefaultControlFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, len(*controlFile.Volumes[volumeName].Mounts) == 0)
+	assert.DeepEqual(t, *controlFile.Volumes[volumeName].Options, map[string]string{"o": "ro"})
+}
+
+func Test_pluginDriver_NewWithStore(t *testing.T) {
+	store := &memoryStateStore{}
+	driver, err := pluginDriver_NewWithStore(t.TempDir(), *logger, store, nil, nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumeName := "Test_pluginDriver_NewWithStore"
+	if err := driver.Create(&volume.CreateRequest{Name: volumeName}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Mount(&volume.MountRequest{Name: volumeName, ID: "test_id"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Unmount(&volume.UnmountRequest{Name: volumeName, ID: "test_id"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Remove(&volume.RemoveRequest{Name: volumeName}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Assert(t, store.puts == 3)
+	assert.Assert(t, store.deletes == 1)
+	assert.Assert(t, len(store.volumes) == 0)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
@@ -28,13 +29,19 @@ type CheckAccessUserSpec string
 const CheckAccessCurrentUser = CheckAccessUserSpec("")
 
 func checkAccess(usr user.User, perm os.FileMode, file os.FileInfo) error {
+	return checkAccessIds(usr.Uid, usr.GroupIds, perm, file)
+}
+
+// Same as checkAccess(), but for the user ID [userId] being member of the group
+// IDs returned by [groupIds].
+func checkAccessIds(userId string, groupIds func() ([]string, error), perm os.FileMode, file os.FileInfo) error {
 	switch sys := file.Sys().(type) {
 	case *syscall.Stat_t:
 		mod := file.Mode() & 0o777
 		act := mod & 0o7
 		exp := perm & 0o777
 
-		uid, err := strconv.ParseUint(usr.Uid, 10, 32)
+		uid, err := strconv.ParseUint(userId, 10, 32)
 		if err != nil {
 			return err
 		}
@@ -42,7 +49,7 @@ func checkAccess(usr user.User, perm os.FileMode, file os.FileInfo) error {
 			act |= os.FileMode(mod >> 6)
 		}
 
-		gids, err := usr.GroupIds()
+		gids, err := groupIds()
 		if err != nil {
 			return err
 		}
@@ -91,6 +98,86 @@ func CheckAccess(userName CheckAccessUserSpec, perm os.FileMode, path string) er
 	return checkAccess(*usr, perm, file)
 }
 
+// Checks if a process running with [credential] (i.e. it's user, group and
+// supplementary groups rather than the ones of a user account) has `perm`
+// access to `path`. The root user is granted any access.
+func CheckAccessCredential(credential *syscall.Credential, perm os.FileMode, path string) error {
+	file, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if credential.Uid == 0 {
+		return nil
+	}
+
+	gids := []string{strconv.FormatUint(uint64(credential.Gid), 10)}
+	for _, gid := range credential.Groups {
+		gids = append(gids, strconv.FormatUint(uint64(gid), 10))
+	}
+
+	return checkAccessIds(strconv.FormatUint(uint64(credential.Uid), 10), func() ([]string, error) { return gids, nil }, perm, file)
+}
+
+// Writes [data] to the file [name] in a crash-safe manner, so that after a
+// crash or power loss the file either has it's previous or it's new contents,
+// but is never truncated or only partially written.
+//
+// The data is written to a temporary file in the same folder first, which is
+// synced to disk and then renamed to [name]. Finally, the folder itself is
+// synced in order to persist the rename operation.
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) (fail error) {
+	dir := filepath.Dir(name)
+
+	file, err := os.CreateTemp(dir, fmt.Sprintf(".%s.*.tmp", filepath.Base(name)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if fail != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	if err := file.Chmod(perm); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), name); err != nil {
+		return err
+	}
+
+	return SyncDir(dir)
+}
+
+// Flushes the directory entries of folder [name] to disk, which is required to
+// persist operations like creating, renaming or removing files.
+func SyncDir(name string) (fail error) {
+	dir, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := dir.Close(); (err != nil) && (fail == nil) {
+			fail = err
+		}
+	}()
+
+	return dir.Sync()
+}
+
 // Interprets a string as a hexadecimal expression and converts it to a sequence
 // of bytes.
 func Atob(hexString string) (bytes []byte, fail error) {
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -152,6 +153,102 @@ func TestCheckAccess(t *testing.T) {
 	}
 }
 
+func TestCheckAccessCredential(t *testing.T) {
+	testFile, err := os.OpenFile(filepath.Join(t.TempDir(), SHA256StringToString("TestCheckAccessCredential")), os.O_CREATE, os.FileMode(0o750))
+	if err != nil {
+		t.Fatal(err)
+	} else {
+		if err := testFile.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testFileInfo, err := os.Lstat(testFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, gid := testFileInfo.Sys().(*syscall.Stat_t).Uid, testFileInfo.Sys().(*syscall.Stat_t).Gid
+	otherUid, otherGid := uid+4242, gid+4242
+
+	type args struct {
+		credential syscall.Credential
+		perm       os.FileMode
+		path       string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Let LStat fail", args: args{credential: syscall.Credential{Uid: 0}, perm: os.FileMode(0o000), path: filepath.Join(t.TempDir(), "missing")}, wantErr: true},
+		{name: "Root", args: args{credential: syscall.Credential{Uid: 0}, perm: os.FileMode(0o007), path: testFile.Name()}},
+		{name: "Owner", args: args{credential: syscall.Credential{Uid: uid, Gid: otherGid}, perm: os.FileMode(0o007), path: testFile.Name()}},
+		{name: "Group", args: args{credential: syscall.Credential{Uid: otherUid, Gid: gid}, perm: os.FileMode(0o005), path: testFile.Name()}},
+		{name: "Supplementary group", args: args{credential: syscall.Credential{Uid: otherUid, Gid: otherGid, Groups: []uint32{gid}}, perm: os.FileMode(0o005), path: testFile.Name()}},
+		{name: "Group denied", args: args{credential: syscall.Credential{Uid: otherUid, Gid: gid}, perm: os.FileMode(0o007), path: testFile.Name()}, wantErr: true},
+		{name: "Other denied", args: args{credential: syscall.Credential{Uid: otherUid, Gid: otherGid}, perm: os.FileMode(0o004), path: testFile.Name()}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckAccessCredential(&tt.args.credential, tt.args.perm, tt.args.path); (err != nil) != tt.wantErr {
+				t.Errorf("CheckAccessCredential() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Parallel()
+
+	testFolder := t.TempDir()
+
+	type args struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		// Test cases.
+		{name: "Create", args: args{name: filepath.Join(testFolder, "file"), data: []byte("first"), perm: 0o640}},
+		{name: "Replace", args: args{name: filepath.Join(testFolder, "file"), data: []byte("second"), perm: 0o600}},
+		{name: "Missing folder", args: args{name: filepath.Join(testFolder, "missing", "file"), data: []byte("third"), perm: 0o600}, wantErr: true},
+		{name: "Folder", args: args{name: testFolder, data: []byte("fourth"), perm: 0o600}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := WriteFileAtomic(tt.args.name, tt.args.data, tt.args.perm); (err != nil) != tt.wantErr {
+				t.Errorf("WriteFileAtomic() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			} else if err != nil {
+				t.Logf("WriteFileAtomic() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got, err := os.ReadFile(tt.args.name); err != nil {
+				t.Error(err)
+			} else if !bytes.Equal(got, tt.args.data) {
+				t.Errorf("WriteFileAtomic() wrote %q, want %q", got, tt.args.data)
+			}
+
+			if fileInfo, err := os.Lstat(tt.args.name); err != nil {
+				t.Error(err)
+			} else if fileInfo.Mode().Perm() != tt.args.perm {
+				t.Errorf("WriteFileAtomic() mode = %s, want %s", fileInfo.Mode().Perm(), tt.args.perm)
+			}
+		})
+	}
+
+	if entries, err := os.ReadDir(testFolder); err != nil {
+		t.Error(err)
+	} else if len(entries) != 1 {
+		t.Errorf("WriteFileAtomic() left %d files in folder [%s], want 1.", len(entries), testFolder)
+	}
+}
+
 func TestAtob(t *testing.T) {
 	t.Parallel()
 